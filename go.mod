@@ -3,7 +3,7 @@ module github.com/cased/jump
 go 1.19
 
 require (
-	github.com/aws/aws-sdk-go v1.44.155
+	github.com/aws/aws-sdk-go v1.44.300
 	github.com/kylelemons/godebug v1.1.0
 	github.com/nsf/jsondiff v0.0.0-20210926074059-1e845ec5d249
 	gopkg.in/yaml.v2 v2.4.0
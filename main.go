@@ -5,51 +5,286 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/cased/jump/providers"
 	jump "github.com/cased/jump/types/v1alpha"
 )
 
-type cli struct {
-	ConfigPaths  []string
-	ManifestPath string
-}
+// Exit codes, so jump can be used in CI to gate config changes.
+const (
+	exitOK            = 0 // Success, or `plan` found no changes
+	exitError         = 1 // Discovery or I/O failed, including any query failing in `discover --once` or `plan`
+	exitUsage         = 2 // Invalid command line
+	exitInvalidConfig = 3 // Config files failed to load or validate
+	exitChanges       = 4 // `plan` found changes
+)
+
+const usage = `Usage:
+  %[1]s validate <config>...
+  %[1]s discover [--once] [--interval 30s] [--output results.json|-] [--log-level info|debug] <config>...
+  %[1]s plan [--manifest results.json] [--log-level info|debug] <config>...
+  %[1]s providers [describe <name>]
+
+Each config is a file, a directory, or a quoted glob pattern like 'conf.d/*.yaml'.
+
+For compatibility, %[1]s <config>... results.json runs discover in a loop, honoring the ONCE and LOG_LEVEL environment variables.
+
+Exit codes: 0 success, 1 error, 2 usage, 3 invalid config, 4 plan found changes.
+`
 
 func main() {
-	c := &cli{}
-	flag.Parse()
-	if flag.NArg() < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s queries.yaml [queries2.yaml ...] results.json\n", os.Args[0])
-		os.Exit(1)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
 	}
-	c.ConfigPaths = flag.Args()[:flag.NArg()-1]
-	c.ManifestPath = flag.Arg(flag.NArg() - 1)
+	flag.Parse()
 
 	providers.Register()
 
+	var code int
+	switch flag.Arg(0) {
+	case "validate":
+		code = validateCommand(flag.Args()[1:])
+	case "discover":
+		code = discoverCommand(flag.Args()[1:])
+	case "plan":
+		code = planCommand(flag.Args()[1:])
+	case "providers":
+		code = providersCommand(flag.Args()[1:])
+	default:
+		code = legacyCommand(flag.Args())
+	}
+	os.Exit(code)
+}
+
+// Sets the log level used by jump and its providers. Defaults to the LOG_LEVEL environment variable.
+func logLevelFlag(flags *flag.FlagSet) *string {
+	level := os.Getenv("LOG_LEVEL")
+	if level == "" {
+		level = "info"
+	}
+	return flags.String("log-level", level, "info or debug")
+}
+
+func setLogLevel(level string) {
+	os.Setenv("LOG_LEVEL", level)
+}
+
+func loadConfig(paths []string) (*jump.AutoDiscoveryConfig, int) {
+	config, err := jump.LoadAutoDiscoveryConfigFromPaths(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, exitInvalidConfig
+	}
+	return config, exitOK
+}
+
+// Implements `jump validate <config>...`. Checks config files without calling any provider.
+func validateCommand(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flag.Usage()
+		return exitUsage
+	}
+	config, code := loadConfig(flags.Args())
+	if code != exitOK {
+		return code
+	}
+	fmt.Printf("%d queries OK\n", len(config.Queries))
+	return exitOK
+}
+
+// Implements `jump discover`, which writes a manifest once or on an interval.
+func discoverCommand(args []string) int {
+	flags := flag.NewFlagSet("discover", flag.ContinueOnError)
+	once := flags.Bool("once", false, "write the manifest once and exit")
+	interval := flags.Duration("interval", 30*time.Second, "time to wait between discovery cycles")
+	output := flags.String("output", "results.json", "path to write the manifest to, or - for stdout")
+	logLevel := logLevelFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flag.Usage()
+		return exitUsage
+	}
+	setLogLevel(*logLevel)
+	return discover(flags.Args(), *output, *once, *interval)
+}
+
+// Implements `jump <config>... results.json`, the original command line.
+func legacyCommand(args []string) int {
+	if len(args) < 2 {
+		flag.Usage()
+		return exitUsage
+	}
+	return discover(args[:len(args)-1], args[len(args)-1], os.Getenv("ONCE") != "", 30*time.Second)
+}
+
+func discover(configPaths []string, output string, once bool, interval time.Duration) int {
 	log.Println("Greetings")
 
 	for {
-		config, err := jump.LoadAutoDiscoveryConfigFromPaths(c.ConfigPaths)
-		if err != nil {
-			panic(err)
+		config, code := loadConfig(configPaths)
+		if code != exitOK {
+			return code
 		}
-		prompts, err := config.DiscoverPrompts()
+		manifest, err := config.DiscoverManifest()
 		if err != nil {
+			// Keep the previous manifest rather than writing an invalid one
 			log.Println(err)
+			if once {
+				return exitError
+			}
+			time.Sleep(interval)
+			continue
+		}
+		if output == "-" {
+			var data []byte
+			data, err = manifest.Marshal()
+			if err == nil {
+				_, err = fmt.Println(string(data))
+			}
+		} else {
+			err = manifest.WriteToPath(output)
 		}
-		err = jump.WriteAutoDiscoveryManifestToPath(prompts, c.ManifestPath)
 		if err != nil {
-			panic(err)
+			log.Println(err)
+			return exitError
 		}
 		if os.Getenv("LOG_LEVEL") == "debug" {
-			log.Printf("Wrote %d prompts to manifest\n", len(prompts))
+			log.Printf("Wrote %d prompts to manifest\n", len(manifest.Prompts))
+		}
+
+		if once {
+			if failed := manifest.FailedQueries(); len(failed) > 0 {
+				log.Printf("Discovery failed for %d of %d queries\n", len(failed), len(manifest.Queries))
+				return exitError
+			}
+			return exitOK
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Implements `jump plan`, which shows how discovery would change an existing manifest.
+func planCommand(args []string) int {
+	flags := flag.NewFlagSet("plan", flag.ContinueOnError)
+	manifestPath := flags.String("manifest", "results.json", "path of the existing manifest")
+	logLevel := logLevelFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flag.Usage()
+		return exitUsage
+	}
+	setLogLevel(*logLevel)
+
+	config, code := loadConfig(flags.Args())
+	if code != exitOK {
+		return code
+	}
+	var before []*jump.Prompt
+	manifest, err := jump.ReadAutoDiscoveryManifestFromPath(*manifestPath)
+	if err == nil {
+		before = manifest.Prompts
+	} else if !os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	discovered, err := config.DiscoverManifest()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	changes := jump.DiffPrompts(before, discovered.Prompts)
+	symbols := map[string]string{"add": "+", "remove": "-", "change": "~"}
+	for _, change := range changes {
+		line := fmt.Sprintf("%s %s %s", symbols[change.Action], change.Prompt.Provider, change.Prompt.Hostname)
+		if change.Prompt.Name != "" {
+			line = fmt.Sprintf("%s %s %s (%s)", symbols[change.Action], change.Prompt.Provider, change.Prompt.Name, change.Prompt.Hostname)
 		}
+		if len(change.Fields) > 0 {
+			line += ": " + strings.Join(change.Fields, ", ")
+		}
+		fmt.Println(line)
+	}
+	// A failed query would show its prompts as removed, so the plan can't be trusted
+	if failed := discovered.FailedQueries(); len(failed) > 0 {
+		fmt.Fprintf(os.Stderr, "Discovery failed for %d of %d queries, the plan is incomplete.\n", len(failed), len(discovered.Queries))
+		return exitError
+	}
+	if len(changes) == 0 {
+		fmt.Println("No changes.")
+		return exitOK
+	}
+	fmt.Printf("%d changes.\n", len(changes))
+	return exitChanges
+}
 
-		if os.Getenv("ONCE") != "" {
-			return
+// Implements `jump providers` and `jump providers describe <name>`.
+func providersCommand(args []string) int {
+	if len(args) == 0 {
+		var names []string
+		for name := range jump.Providers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return exitOK
+	}
+	if len(args) != 2 || args[0] != "describe" {
+		flag.Usage()
+		return exitUsage
+	}
+	name := args[1]
+	provider, ok := jump.Providers[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown provider %q\n", name)
+		return exitUsage
+	}
+	var schema *jump.ProviderSchema
+	if describer, ok := provider.(jump.Describer); ok {
+		schema = describer.Describe()
+	}
+	if schema == nil {
+		fmt.Printf("%s: no schema available\n", name)
+		return exitOK
+	}
+	fmt.Printf("%s: %s\n", name, schema.Description)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, section := range []struct {
+		Title string
+		Keys  []jump.SchemaKey
+	}{
+		{"Filters", schema.Filters},
+		{"Options", schema.Options},
+		{"Sort keys", schema.SortKeys},
+		{"Labels", schema.Labels},
+		{"Annotations", schema.Annotations},
+	} {
+		fmt.Fprintf(w, "\n%s:\n", section.Title)
+		if len(section.Keys) == 0 {
+			fmt.Fprintln(w, "  (none)")
+		}
+		for _, key := range section.Keys {
+			description := key.Description
+			if len(key.Values) > 0 {
+				description += fmt.Sprintf(" One of: %s.", strings.Join(key.Values, ", "))
+			}
+			fmt.Fprintf(w, "  %s\t%s\n", key.Name, description)
 		}
-		time.Sleep(30 * time.Second)
 	}
+	w.Flush()
+	return exitOK
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jump "github.com/cased/jump/types/v1alpha"
+)
+
+// Fails every query, like a provider with expired credentials.
+type failingProvider struct{}
+
+func (provider *failingProvider) Initialize(interface{}) {}
+
+func (provider *failingProvider) Discover(queries []*jump.PromptQuery) ([]*jump.Prompt, error) {
+	return nil, errors.New("expired credentials")
+}
+
+func TestFailedQueriesExitWithError(t *testing.T) {
+	jump.RegisterProvider("failing", &failingProvider{}, nil)
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.yaml")
+	err := ioutil.WriteFile(config, []byte("queries:\n- provider: failing\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "results.json")
+
+	if code := discover([]string{config}, output, true, 0); code != exitError {
+		t.Errorf("discover --once: got exit code %d, want %d", code, exitError)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("discover --once: manifest not written: %s", err)
+	}
+	if code := planCommand([]string{"--manifest", output, config}); code != exitError {
+		t.Errorf("plan: got exit code %d, want %d", code, exitError)
+	}
+}
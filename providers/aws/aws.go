@@ -1,20 +1,33 @@
 package aws
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/aws/aws-sdk-go/service/sts"
+	jump "github.com/cased/jump/types/v1alpha"
 )
 
 type EC2Interface interface {
 	DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error)
+	DescribeInstanceConnectEndpoints(input *ec2.DescribeInstanceConnectEndpointsInput) (*ec2.DescribeInstanceConnectEndpointsOutput, error)
+	DescribeInstanceStatus(input *ec2.DescribeInstanceStatusInput) (*ec2.DescribeInstanceStatusOutput, error)
+}
+
+type AutoScalingInterface interface {
+	DescribeAutoScalingInstances(input *autoscaling.DescribeAutoScalingInstancesInput) (*autoscaling.DescribeAutoScalingInstancesOutput, error)
 }
 
 type ECSInterface interface {
@@ -22,6 +35,22 @@ type ECSInterface interface {
 	DescribeTasks(input *ecs.DescribeTasksInput) (*ecs.DescribeTasksOutput, error)
 	ListContainerInstances(input *ecs.ListContainerInstancesInput) (*ecs.ListContainerInstancesOutput, error)
 	DescribeContainerInstances(input *ecs.DescribeContainerInstancesInput) (*ecs.DescribeContainerInstancesOutput, error)
+	DescribeTaskDefinition(input *ecs.DescribeTaskDefinitionInput) (*ecs.DescribeTaskDefinitionOutput, error)
+	ListClusters(input *ecs.ListClustersInput) (*ecs.ListClustersOutput, error)
+}
+
+type EKSInterface interface {
+	ListClusters(input *eks.ListClustersInput) (*eks.ListClustersOutput, error)
+	DescribeCluster(input *eks.DescribeClusterInput) (*eks.DescribeClusterOutput, error)
+}
+
+type RDSInterface interface {
+	DescribeDBInstances(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error)
+	DescribeDBClusters(input *rds.DescribeDBClustersInput) (*rds.DescribeDBClustersOutput, error)
+}
+
+type SSMInterface interface {
+	DescribeInstanceInformation(input *ssm.DescribeInstanceInformationInput) (*ssm.DescribeInstanceInformationOutput, error)
 }
 
 type STSInterface interface {
@@ -50,6 +79,21 @@ func (m *MockEC2Metadata) Region() (string, error) {
 	return "us-notexist-1", nil
 }
 
+// Create the AWS clients of a region for Providers whose interfaces weren't set with Initialize. Each query builds its
+// own from the session of its region, so queries of different regions don't share clients. Tests replace these to give
+// each region its own mock.
+var (
+	NewEKSInterface        = func(regionSession *session.Session) EKSInterface { return eks.New(regionSession) }
+	NewKubernetesInterface = func(regionSession *session.Session) KubernetesInterface {
+		return &eksKubernetesClient{session: regionSession}
+	}
+	NewAutoScalingInterface = func(regionSession *session.Session) AutoScalingInterface { return autoscaling.New(regionSession) }
+	NewEC2Interface         = func(regionSession *session.Session) EC2Interface { return ec2.New(regionSession) }
+	NewECSInterface         = func(regionSession *session.Session) ECSInterface { return ecs.New(regionSession) }
+	NewRDSInterface         = func(regionSession *session.Session) RDSInterface { return rds.New(regionSession) }
+	NewSSMInterface         = func(regionSession *session.Session) SSMInterface { return ssm.New(regionSession) }
+)
+
 var regionSessions map[string]*session.Session
 var defaultRegion string
 var DefaultMetadataInterface EC2MetadataInterface
@@ -123,3 +167,67 @@ func GetAWSSession(region string) (*session.Session, error) {
 	}
 	return regionSessions[region], nil
 }
+
+// Runs query for each PromptQuery. An error doesn't stop the remaining queries from running: all errors are returned
+// together, alongside the Prompts of the queries that succeeded.
+func discoverEach(queries []*jump.PromptQuery, query func(*jump.PromptQuery) ([]*jump.Prompt, error)) ([]*jump.Prompt, error) {
+	var prompts []*jump.Prompt
+	var errs []string
+	for _, q := range queries {
+		queryPrompts, err := query(q)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		prompts = append(prompts, queryPrompts...)
+	}
+	if len(errs) > 0 {
+		return prompts, errors.New(strings.Join(errs, "; "))
+	}
+	return prompts, nil
+}
+
+// Returns labels describing the network location of an EC2 instance, used to assign proxy jumps by VPC and
+// availability zone. Missing values are left out.
+func instanceNetworkLabels(instance *ec2.Instance) map[string]string {
+	labels := make(map[string]string)
+	if instance.VpcId != nil {
+		labels["vpc-id"] = *instance.VpcId
+	}
+	if instance.SubnetId != nil {
+		labels["subnet-id"] = *instance.SubnetId
+	}
+	if instance.Placement != nil && instance.Placement.AvailabilityZone != nil {
+		labels["availability-zone"] = *instance.Placement.AvailabilityZone
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// The labels added by instanceNetworkLabels, for use in provider schemas.
+var networkLabelKeys = []jump.SchemaKey{
+	{Name: "vpc-id", Description: "The id of the VPC the instance runs in."},
+	{Name: "subnet-id", Description: "The id of the subnet the instance runs in."},
+	{Name: "availability-zone", Description: "The availability zone the instance runs in."},
+}
+
+// Returns the tags of an EC2 resource as a map, for reading Prompt configuration with Prompt.DecorateWithResource.
+func ec2TagMap(tags []*ec2.Tag) map[string]string {
+	result := make(map[string]string)
+	for _, tag := range tags {
+		if tag.Key != nil && tag.Value != nil {
+			result[*tag.Key] = *tag.Value
+		}
+	}
+	return result
+}
+
+// Returns s quoted for a POSIX shell, if it needs quoting.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.,:/@=+%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
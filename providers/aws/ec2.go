@@ -1,16 +1,19 @@
 package aws
 
 import (
-	"log"
+	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	jump "github.com/cased/jump/types/v1alpha"
 )
 
-// The EC2 auto-discovery Provider queries AWS for running EC2 instances.
+// The EC2 auto-discovery Provider queries AWS for running EC2 instances, and optionally for stopped ones.
 //
 // # Filters
 //
@@ -21,46 +24,202 @@ import (
 // In addition to the above filter keys, the EC2 Provider also accepts all keys that are valid for
 // `ec2.DescribeInstanceInput.Filters`, documentation on which is available at https://docs.aws.amazon.com/sdk-for-go/api/service/ec2/#DescribeInstancesInput.
 //
+// # Options
+//
+// The EC2 Provider accepts the following options:
+//
+// - connection-mode: How the Cased Shell host connects to instances, see Connection modes. Defaults to ssh.
+// - status-checks: One of ignore, annotate or exclude, see Instance health. Defaults to ignore.
+// - auto-scaling: One of ignore, annotate or exclude, see Instance health. Defaults to ignore.
+// - include-stopped: Set to true to also list stopping and stopped instances, as disabled Prompts.
+//
+// # Connection modes
+//
+// The connection-mode option chooses how the Cased Shell host reaches each instance:
+//
+// - ssh: Connect to the instance's private DNS name over SSH, through a proxy jump if one is set.
+// - instance-connect: Run `aws ec2-instance-connect ssh` from the Cased Shell host, which pushes a short-lived key
+// with SendSSHPublicKey and connects directly.
+// - endpoint: Run `ssh` from the Cased Shell host, tunnelled with `aws ec2-instance-connect open-tunnel` through the
+// EC2 Instance Connect Endpoint of the instance's VPC, which is discovered automatically. An endpoint in the
+// instance's subnet is preferred. Instances in a VPC without an endpoint are annotated with
+// jump.UnreachableAnnotation and left in ssh mode.
+//
+// Prompts in the instance-connect and endpoint modes set ConnectCommand, which the Cased Shell host runs instead of
+// connecting over SSH, so their proxy jump selectors are cleared. The Prompt's username is used as the OS user.
+//
+// # Instance health
+//
+// By default every running instance is listed, including instances failing their status checks and instances
+// held in an Auto Scaling lifecycle hook. Set status-checks to annotate to call DescribeInstanceStatus and annotate
+// each running instance with its instance and system status checks, or to exclude to also leave out instances where
+// either check is impaired. Set auto-scaling to annotate to call DescribeAutoScalingInstances for instances tagged
+// with an Auto Scaling group and annotate their lifecycle state and health, or to exclude to also leave out
+// instances that are Pending or Terminating, like in the Pending:Wait and Terminating:Wait hook states, and
+// instances Auto Scaling marked UNHEALTHY.
+//
+// With include-stopped set to true, stopping and stopped instances are listed as Prompts with Disabled set, so
+// the Cased Shell Dashboard shows them without allowing connections, and every Prompt is annotated with its
+// instance state.
+//
 // # Sorting
 //
-// The EC2 Provider supports sorting by the following keys:
+// The EC2 Provider sorts natively by the following keys:
 //
 // - launchTime
 //
+// Other keys are sorted by jump. The Provider only applies the query's limit when jump asks it to, see
+// PromptQuery.ProviderLimit.
+//
+// # Ids
+//
+// Prompt ids are derived from the EC2 instance id.
+//
+// # Labels
+//
+// The EC2 Provider labels each Prompt with the network location of the instance, when known:
+//
+// - vpc-id: The id of the VPC the instance runs in.
+// - subnet-id: The id of the subnet the instance runs in.
+// - availability-zone: The availability zone the instance runs in.
+//
+// The keys and values of filters are also added as labels.
+//
+// # Resource configuration
+//
+// When enabled with the query's resourceConfig, the EC2 Provider reads Prompt configuration from instance tags with
+// the `jump:` prefix, like `jump:name`, `jump:username` or `jump:featured`, and leaves out instances tagged
+// `jump:exclude=true`. See jump.ResourceConfig.
+//
 // # Annotations
 //
 // The EC2 Provider appends the following annotations to each Prompt:
 //
 // - launchTime: The EC2 instance launch time.
+// - instanceConnectEndpointId: In endpoint mode, the id of the EC2 Instance Connect Endpoint used.
+// - instanceState: With include-stopped, the EC2 instance state, like running or stopped.
+// - instanceStatus, systemStatus: With status-checks, the instance and system status checks, like ok or impaired.
+// - autoScalingGroup, lifecycleState, autoScalingHealthStatus: With auto-scaling, the instance's Auto Scaling details.
 type EC2 struct {
-	EC2Interface EC2Interface
-	STSInterface STSInterface
+	EC2Interface         EC2Interface
+	AutoScalingInterface AutoScalingInterface
+	STSInterface         STSInterface
 }
 
 type EC2ProviderConfig struct {
-	EC2Interface EC2Interface
-	STSInterface STSInterface
+	EC2Interface         EC2Interface
+	AutoScalingInterface AutoScalingInterface
+	STSInterface         STSInterface
 }
 
 func (provider *EC2) Initialize(providerConfig interface{}) {
 	if providerConfig != nil {
 		typedConfig := providerConfig.(EC2ProviderConfig)
 		provider.EC2Interface = typedConfig.EC2Interface
+		provider.AutoScalingInterface = typedConfig.AutoScalingInterface
 		provider.STSInterface = typedConfig.STSInterface
 	}
 }
 
-func (provider *EC2) Discover(queries []*jump.PromptQuery) ([]*jump.Prompt, error) {
-	var prompts []*jump.Prompt
-	for _, query := range queries {
-		queryPrompts, err := provider.Query(query)
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-		prompts = append(prompts, queryPrompts...)
+// The filter names accepted by DescribeInstances, see https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_DescribeInstances.html
+var ec2DescribeInstancesFilters = []string{
+	"affinity",
+	"architecture",
+	"availability-zone",
+	"block-device-mapping.*",
+	"boot-mode",
+	"capacity-reservation-id",
+	"client-token",
+	"dns-name",
+	"hibernation-options.configured",
+	"host-id",
+	"hypervisor",
+	"iam-instance-profile.*",
+	"image-id",
+	"instance-id",
+	"instance-lifecycle",
+	"instance-state-code",
+	"instance-state-name",
+	"instance-type",
+	"instance.group-id",
+	"instance.group-name",
+	"ip-address",
+	"ipv6-address",
+	"kernel-id",
+	"key-name",
+	"launch-index",
+	"launch-time",
+	"metadata-options.*",
+	"monitoring-state",
+	"network-interface.*",
+	"outpost-arn",
+	"owner-id",
+	"placement-group-name",
+	"placement-partition-number",
+	"platform",
+	"platform-details",
+	"private-dns-name",
+	"private-dns-name-options.*",
+	"private-ip-address",
+	"product-code",
+	"product-code.type",
+	"ramdisk-id",
+	"reason",
+	"requester-id",
+	"reservation-id",
+	"root-device-name",
+	"root-device-type",
+	"source-dest-check",
+	"spot-instance-request-id",
+	"state-reason-code",
+	"state-reason-message",
+	"subnet-id",
+	"tag:*",
+	"tag-key",
+	"tenancy",
+	"tpm-support",
+	"usage-operation",
+	"usage-operation-update-time",
+	"virtualization-type",
+	"vpc-id",
+}
+
+func (provider *EC2) Describe() *jump.ProviderSchema {
+	filters := []jump.SchemaKey{
+		{Name: "region", Description: "The AWS region to query. Defaults to the current region."},
 	}
-	return prompts, nil
+	for _, name := range ec2DescribeInstancesFilters {
+		filters = append(filters, jump.SchemaKey{Name: name, Description: "Passed to DescribeInstances."})
+	}
+	options := []jump.SchemaKey{
+		{Name: "connection-mode", Description: "How the Cased Shell host connects to instances. Defaults to ssh.", Values: []string{ec2ConnectionSSH, ec2ConnectionInstanceConnect, ec2ConnectionEndpoint}},
+		{Name: "status-checks", Description: "Whether to annotate or exclude instances by their EC2 status checks. Defaults to ignore.", Values: ec2OptionValues},
+		{Name: "auto-scaling", Description: "Whether to annotate or exclude instances by their Auto Scaling lifecycle state. Defaults to ignore.", Values: ec2OptionValues},
+		{Name: "include-stopped", Description: "Set to true to include stopped instances as disabled Prompts.", Values: []string{"true", "false"}},
+	}
+	return &jump.ProviderSchema{
+		Description: "Queries AWS for running EC2 instances.",
+		Filters:     filters,
+		Options:     options,
+		SortKeys: []jump.SchemaKey{
+			{Name: "launchTime", Description: "The EC2 instance launch time."},
+		},
+		Labels: networkLabelKeys,
+		Annotations: []jump.SchemaKey{
+			{Name: "launchTime", Description: "The EC2 instance launch time."},
+			{Name: "instanceConnectEndpointId", Description: "In endpoint mode, the id of the EC2 Instance Connect Endpoint used."},
+			{Name: "instanceState", Description: "With include-stopped, the EC2 instance state."},
+			{Name: "instanceStatus", Description: "With status-checks, the instance status check: ok, impaired, initializing or insufficient-data."},
+			{Name: "systemStatus", Description: "With status-checks, the system status check: ok, impaired, initializing or insufficient-data."},
+			{Name: "autoScalingGroup", Description: "With auto-scaling, the name of the instance's Auto Scaling group."},
+			{Name: "lifecycleState", Description: "With auto-scaling, the instance's Auto Scaling lifecycle state, like InService or Terminating:Wait."},
+			{Name: "autoScalingHealthStatus", Description: "With auto-scaling, the instance's Auto Scaling health status, HEALTHY or UNHEALTHY."},
+		},
+	}
+}
+
+func (provider *EC2) Discover(queries []*jump.PromptQuery) ([]*jump.Prompt, error) {
+	return discoverEach(queries, provider.Query)
 }
 
 func (provider *EC2) Query(query *jump.PromptQuery) ([]*jump.Prompt, error) {
@@ -70,10 +229,7 @@ func (provider *EC2) Query(query *jump.PromptQuery) ([]*jump.Prompt, error) {
 		return nil, err
 	}
 
-	// AWS EC2 endpoints
-	if provider.EC2Interface == nil {
-		provider.EC2Interface = ec2.New(regionSession)
-	}
+	provider = provider.forRegion(regionSession)
 
 	var filters []*ec2.Filter
 	for key, value := range query.Filters {
@@ -91,23 +247,103 @@ func (provider *EC2) Query(query *jump.PromptQuery) ([]*jump.Prompt, error) {
 		return nil, err
 	}
 
-	var prompts []*jump.Prompt
+	region := query.Filters["region"]
+	if region == "" {
+		region = aws.StringValue(regionSession.Config.Region)
+	}
+	// The endpoint of each VPC, described once per query
+	endpoints := make(map[string][]*ec2.Ec2InstanceConnectEndpoint)
 
+	includeStopped := query.Options["include-stopped"] == "true"
+	var instances []*ec2.Instance
 	for _, reservation := range di.Reservations {
 		for _, instance := range reservation.Instances {
-			if instance.State != nil && *instance.State.Name == "running" {
-				prompt := &jump.Prompt{
-					Kind:     "host",
-					Name:     *instance.InstanceId,
-					Hostname: *instance.PrivateDnsName,
-					Annotations: map[string]string{
-						"launchTime": instance.LaunchTime.Format(time.RFC3339),
-					},
+			if instance.State == nil {
+				continue
+			}
+			switch aws.StringValue(instance.State.Name) {
+			case ec2.InstanceStateNameRunning:
+				instances = append(instances, instance)
+			case ec2.InstanceStateNameStopping, ec2.InstanceStateNameStopped:
+				if includeStopped {
+					instances = append(instances, instance)
 				}
-				prompts = append(prompts, provider.decoratePromptWithQuery(prompt, query))
+			}
+		}
+	}
+
+	statuses, err := provider.describeInstanceStatuses(query.Options["status-checks"], instances)
+	if err != nil {
+		return nil, err
+	}
+	autoScalingInstances, err := provider.describeAutoScalingInstances(query.Options["auto-scaling"], instances)
+	if err != nil {
+		return nil, err
+	}
+
+	var prompts []*jump.Prompt
 
+	for _, instance := range instances {
+		status := statuses[*instance.InstanceId]
+		autoScalingInstance := autoScalingInstances[*instance.InstanceId]
+		if query.Options["status-checks"] == ec2OptionExclude && instanceStatusImpaired(status) {
+			continue
+		}
+		if query.Options["auto-scaling"] == ec2OptionExclude && autoScalingInstanceLeaving(autoScalingInstance) {
+			continue
+		}
+
+		prompt := &jump.Prompt{
+			ID:       jump.PromptID("ec2", query, *instance.InstanceId),
+			Kind:     "host",
+			Name:     *instance.InstanceId,
+			Hostname: aws.StringValue(instance.PrivateDnsName),
+			Labels:   instanceNetworkLabels(instance),
+			Annotations: map[string]string{
+				"launchTime": instance.LaunchTime.Format(time.RFC3339),
+			},
+		}
+		if includeStopped {
+			prompt.Annotations["instanceState"] = *instance.State.Name
+			if *instance.State.Name != ec2.InstanceStateNameRunning {
+				prompt.Disabled = aws.Bool(true)
+			}
+		}
+		if status != nil {
+			prompt.Annotations["instanceStatus"] = aws.StringValue(status.InstanceStatus.Status)
+			prompt.Annotations["systemStatus"] = aws.StringValue(status.SystemStatus.Status)
+		}
+		if autoScalingInstance != nil {
+			prompt.Annotations["autoScalingGroup"] = aws.StringValue(autoScalingInstance.AutoScalingGroupName)
+			prompt.Annotations["lifecycleState"] = aws.StringValue(autoScalingInstance.LifecycleState)
+			prompt.Annotations["autoScalingHealthStatus"] = aws.StringValue(autoScalingInstance.HealthStatus)
+		}
+		decoratedPrompt := provider.decoratePromptWithQuery(prompt, query, ec2TagMap(instance.Tags))
+		if decoratedPrompt == nil {
+			continue
+		}
+		switch query.Options["connection-mode"] {
+		case ec2ConnectionInstanceConnect:
+			decoratedPrompt.ConnectCommand = instanceConnectCommand(instance, decoratedPrompt.Username, region)
+			clearProxyJump(decoratedPrompt)
+		case ec2ConnectionEndpoint:
+			vpcID := aws.StringValue(instance.VpcId)
+			if _, ok := endpoints[vpcID]; !ok && vpcID != "" {
+				endpoints[vpcID], err = provider.describeInstanceConnectEndpoints(vpcID)
+				if err != nil {
+					return nil, err
+				}
+			}
+			endpoint := chooseInstanceConnectEndpoint(endpoints[vpcID], aws.StringValue(instance.SubnetId))
+			if endpoint == nil {
+				decoratedPrompt.Annotations[jump.UnreachableAnnotation] = fmt.Sprintf("no EC2 Instance Connect Endpoint in VPC %q", vpcID)
+				break
 			}
+			decoratedPrompt.ConnectCommand = endpointTunnelCommand(instance, *endpoint.InstanceConnectEndpointId, decoratedPrompt.Username, region)
+			decoratedPrompt.Annotations["instanceConnectEndpointId"] = *endpoint.InstanceConnectEndpointId
+			clearProxyJump(decoratedPrompt)
 		}
+		prompts = append(prompts, decoratedPrompt)
 	}
 
 	switch query.SortBy {
@@ -121,15 +357,33 @@ func (provider *EC2) Query(query *jump.PromptQuery) ([]*jump.Prompt, error) {
 		})
 	}
 
-	if query.Limit != 0 && len(prompts) > query.Limit {
-		prompts = prompts[:query.Limit]
+	if limit := query.ProviderLimit(); limit != 0 && len(prompts) > limit {
+		prompts = prompts[:limit]
 	}
 
 	return prompts, nil
 }
 
-func (provider *EC2) decoratePromptWithQuery(prompt *jump.Prompt, query *jump.PromptQuery) *jump.Prompt {
-	decoratedPrompt := prompt.DecorateWithQuery(query)
+// Returns nil if the instance's tags exclude it.
+// Returns a copy of the provider that uses the clients of a region, unless they were set with Initialize.
+func (provider *EC2) forRegion(regionSession *session.Session) *EC2 {
+	regional := *provider
+	// AWS EC2 endpoints
+	if regional.EC2Interface == nil {
+		regional.EC2Interface = NewEC2Interface(regionSession)
+	}
+	// AWS Auto Scaling endpoints, for the auto-scaling option
+	if regional.AutoScalingInterface == nil {
+		regional.AutoScalingInterface = NewAutoScalingInterface(regionSession)
+	}
+	return &regional
+}
+
+func (provider *EC2) decoratePromptWithQuery(prompt *jump.Prompt, query *jump.PromptQuery, tags map[string]string) *jump.Prompt {
+	decoratedPrompt := prompt.DecorateWithResource(query, tags)
+	if decoratedPrompt == nil {
+		return nil
+	}
 	if len(query.Filters) > 0 {
 		if decoratedPrompt.Labels == nil {
 			decoratedPrompt.Labels = map[string]string{}
@@ -141,3 +395,195 @@ func (provider *EC2) decoratePromptWithQuery(prompt *jump.Prompt, query *jump.Pr
 	decoratedPrompt.Provider = "ec2"
 	return decoratedPrompt
 }
+
+// Values of the status-checks and auto-scaling options, see the EC2 Provider's documentation.
+const (
+	ec2OptionIgnore   = "ignore"
+	ec2OptionAnnotate = "annotate"
+	ec2OptionExclude  = "exclude"
+)
+
+var ec2OptionValues = []string{ec2OptionIgnore, ec2OptionAnnotate, ec2OptionExclude}
+
+// Reports whether the value of the status-checks or auto-scaling option needs a lookup.
+func ec2OptionEnabled(value string) bool {
+	return value == ec2OptionAnnotate || value == ec2OptionExclude
+}
+
+// The maximum number of instance ids per DescribeInstanceStatus and DescribeAutoScalingInstances request.
+const (
+	ec2InstanceStatusBatch     = 100
+	autoScalingInstancesBatch  = 50
+	autoScalingGroupNameTagKey = "aws:autoscaling:groupName"
+)
+
+// Returns the status checks of the running instances, by instance id, if option enables them.
+func (provider *EC2) describeInstanceStatuses(option string, instances []*ec2.Instance) (map[string]*ec2.InstanceStatus, error) {
+	statuses := map[string]*ec2.InstanceStatus{}
+	if !ec2OptionEnabled(option) {
+		return statuses, nil
+	}
+	var ids []*string
+	for _, instance := range instances {
+		if aws.StringValue(instance.State.Name) == ec2.InstanceStateNameRunning {
+			ids = append(ids, instance.InstanceId)
+		}
+	}
+	for start := 0; start < len(ids); start += ec2InstanceStatusBatch {
+		end := start + ec2InstanceStatusBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		input := &ec2.DescribeInstanceStatusInput{InstanceIds: ids[start:end]}
+		for {
+			output, err := provider.EC2Interface.DescribeInstanceStatus(input)
+			if err != nil {
+				return nil, err
+			}
+			for _, status := range output.InstanceStatuses {
+				if status.InstanceId != nil && status.InstanceStatus != nil && status.SystemStatus != nil {
+					statuses[*status.InstanceId] = status
+				}
+			}
+			if aws.StringValue(output.NextToken) == "" {
+				break
+			}
+			input.NextToken = output.NextToken
+		}
+	}
+	return statuses, nil
+}
+
+// Returns the Auto Scaling details of the instances in Auto Scaling groups, by instance id, if option enables them.
+// Only instances tagged with their group's name are looked up.
+func (provider *EC2) describeAutoScalingInstances(option string, instances []*ec2.Instance) (map[string]*autoscaling.InstanceDetails, error) {
+	details := map[string]*autoscaling.InstanceDetails{}
+	if !ec2OptionEnabled(option) {
+		return details, nil
+	}
+	var ids []*string
+	for _, instance := range instances {
+		if _, ok := ec2TagMap(instance.Tags)[autoScalingGroupNameTagKey]; ok {
+			ids = append(ids, instance.InstanceId)
+		}
+	}
+	for start := 0; start < len(ids); start += autoScalingInstancesBatch {
+		end := start + autoScalingInstancesBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		input := &autoscaling.DescribeAutoScalingInstancesInput{InstanceIds: ids[start:end]}
+		for {
+			output, err := provider.AutoScalingInterface.DescribeAutoScalingInstances(input)
+			if err != nil {
+				return nil, err
+			}
+			for _, instance := range output.AutoScalingInstances {
+				if instance.InstanceId != nil {
+					details[*instance.InstanceId] = instance
+				}
+			}
+			if aws.StringValue(output.NextToken) == "" {
+				break
+			}
+			input.NextToken = output.NextToken
+		}
+	}
+	return details, nil
+}
+
+// Reports whether an instance fails its instance or system status check.
+func instanceStatusImpaired(status *ec2.InstanceStatus) bool {
+	return status != nil && (aws.StringValue(status.InstanceStatus.Status) == ec2.SummaryStatusImpaired ||
+		aws.StringValue(status.SystemStatus.Status) == ec2.SummaryStatusImpaired)
+}
+
+// Reports whether an Auto Scaling instance is being launched or terminated, like in the Pending:Wait or
+// Terminating:Wait lifecycle hook states, or was marked unhealthy, so it is about to be replaced.
+func autoScalingInstanceLeaving(instance *autoscaling.InstanceDetails) bool {
+	if instance == nil {
+		return false
+	}
+	state := aws.StringValue(instance.LifecycleState)
+	return strings.HasPrefix(state, "Pending") || strings.HasPrefix(state, "Terminating") ||
+		strings.EqualFold(aws.StringValue(instance.HealthStatus), "UNHEALTHY")
+}
+
+// Connection modes, see the EC2 Provider's documentation.
+const (
+	ec2ConnectionSSH             = "ssh"
+	ec2ConnectionInstanceConnect = "instance-connect"
+	ec2ConnectionEndpoint        = "endpoint"
+)
+
+// Returns the available EC2 Instance Connect Endpoints in a VPC, sorted by id.
+func (provider *EC2) describeInstanceConnectEndpoints(vpcID string) ([]*ec2.Ec2InstanceConnectEndpoint, error) {
+	var endpoints []*ec2.Ec2InstanceConnectEndpoint
+	input := &ec2.DescribeInstanceConnectEndpointsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpcID)}},
+			{Name: aws.String("state"), Values: []*string{aws.String(ec2.Ec2InstanceConnectEndpointStateCreateComplete)}},
+		},
+	}
+	for {
+		output, err := provider.EC2Interface.DescribeInstanceConnectEndpoints(input)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, output.InstanceConnectEndpoints...)
+		if aws.StringValue(output.NextToken) == "" {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		return aws.StringValue(endpoints[i].InstanceConnectEndpointId) < aws.StringValue(endpoints[j].InstanceConnectEndpointId)
+	})
+	return endpoints, nil
+}
+
+// Returns the endpoint in subnetID if there is one, otherwise the first endpoint, or nil.
+func chooseInstanceConnectEndpoint(endpoints []*ec2.Ec2InstanceConnectEndpoint, subnetID string) *ec2.Ec2InstanceConnectEndpoint {
+	for _, endpoint := range endpoints {
+		if endpoint.InstanceConnectEndpointId != nil && aws.StringValue(endpoint.SubnetId) == subnetID {
+			return endpoint
+		}
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.InstanceConnectEndpointId != nil {
+			return endpoint
+		}
+	}
+	return nil
+}
+
+// Returns the command that pushes a short-lived key to an instance and connects to it with EC2 Instance Connect.
+func instanceConnectCommand(instance *ec2.Instance, username, region string) string {
+	command := fmt.Sprintf("aws ec2-instance-connect ssh --instance-id %s --connection-type direct", *instance.InstanceId)
+	if username != "" {
+		command += " --os-user " + shellQuote(username)
+	}
+	if region != "" {
+		command += " --region " + shellQuote(region)
+	}
+	return command
+}
+
+// Returns the command that connects to an instance over SSH, tunnelled through an EC2 Instance Connect Endpoint.
+func endpointTunnelCommand(instance *ec2.Instance, endpointID, username, region string) string {
+	tunnel := fmt.Sprintf("aws ec2-instance-connect open-tunnel --instance-id %s --instance-connect-endpoint-id %s", *instance.InstanceId, endpointID)
+	if region != "" {
+		tunnel += " --region " + shellQuote(region)
+	}
+	destination := *instance.InstanceId
+	if username != "" {
+		destination = username + "@" + destination
+	}
+	return fmt.Sprintf("ssh -o ProxyCommand=%s %s", shellQuote(tunnel), shellQuote(destination))
+}
+
+// Prompts that connect from the Cased Shell host can't be proxied.
+func clearProxyJump(prompt *jump.Prompt) {
+	prompt.ProxyJumpSelector = nil
+	prompt.ProxyJumpMatchExpressions = nil
+}
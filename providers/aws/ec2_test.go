@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	aws_provider "github.com/cased/jump/providers/aws"
 	jump "github.com/cased/jump/types/v1alpha"
@@ -23,7 +25,9 @@ type MockEC2 struct {
 	Queries      []*jump.PromptQuery
 	CurrentQuery *jump.PromptQuery
 
-	DescribeInstancesFunc func(query *jump.PromptQuery, input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error)
+	DescribeInstancesFunc                func(query *jump.PromptQuery, input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error)
+	DescribeInstanceConnectEndpointsFunc func(query *jump.PromptQuery, input *ec2.DescribeInstanceConnectEndpointsInput) (*ec2.DescribeInstanceConnectEndpointsOutput, error)
+	DescribeInstanceStatusFunc           func(query *jump.PromptQuery, input *ec2.DescribeInstanceStatusInput) (*ec2.DescribeInstanceStatusOutput, error)
 }
 
 func (m *MockEC2) DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
@@ -33,13 +37,31 @@ func (m *MockEC2) DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.Des
 
 	return m.DescribeInstancesFunc(m.CurrentQuery, input)
 }
+
+func (m *MockEC2) DescribeInstanceConnectEndpoints(input *ec2.DescribeInstanceConnectEndpointsInput) (*ec2.DescribeInstanceConnectEndpointsOutput, error) {
+	return m.DescribeInstanceConnectEndpointsFunc(m.CurrentQuery, input)
+}
+
+func (m *MockEC2) DescribeInstanceStatus(input *ec2.DescribeInstanceStatusInput) (*ec2.DescribeInstanceStatusOutput, error) {
+	return m.DescribeInstanceStatusFunc(m.CurrentQuery, input)
+}
+
+type MockAutoScaling struct {
+	DescribeAutoScalingInstancesFunc func(input *autoscaling.DescribeAutoScalingInstancesInput) (*autoscaling.DescribeAutoScalingInstancesOutput, error)
+}
+
+func (m *MockAutoScaling) DescribeAutoScalingInstances(input *autoscaling.DescribeAutoScalingInstancesInput) (*autoscaling.DescribeAutoScalingInstancesOutput, error) {
+	return m.DescribeAutoScalingInstancesFunc(input)
+}
+
 func TestEC2Provider(t *testing.T) {
 
 	type ec2Test struct {
-		Name        string
-		YamlPath    string
-		MockEC2     *MockEC2
-		WantPrompts []*jump.Prompt
+		Name            string
+		YamlPath        string
+		MockEC2         *MockEC2
+		MockAutoScaling *MockAutoScaling
+		WantPrompts     []*jump.Prompt
 	}
 
 	tests := []ec2Test{
@@ -76,6 +98,7 @@ func TestEC2Provider(t *testing.T) {
 			},
 			WantPrompts: jump.Prompts([]*jump.Prompt{
 				{
+					ID:          "ec2-972fa2087f83abe9",
 					Name:        "i-12345678",
 					Description: "An EC2 instance",
 					Hostname:    "12345678.example.com",
@@ -111,6 +134,11 @@ func TestEC2Provider(t *testing.T) {
 									{
 										InstanceId:     aws.String("i-12345678"),
 										PrivateDnsName: aws.String("12345678.example.com"),
+										VpcId:          aws.String("vpc-1234"),
+										SubnetId:       aws.String("subnet-5678"),
+										Placement: &ec2.Placement{
+											AvailabilityZone: aws.String("us-south-1a"),
+										},
 										State: &ec2.InstanceState{
 											Name: aws.String("running"),
 										},
@@ -148,19 +176,381 @@ func TestEC2Provider(t *testing.T) {
 			},
 			WantPrompts: jump.Prompts([]*jump.Prompt{
 				{
+					ID:          "ec2-e65e00b044815fdc",
 					Name:        "i-12345678",
 					Description: "The most recently launched test instance in us-south-1",
 					Hostname:    "12345678.example.com",
 					Kind:        "host",
 					Provider:    "ec2",
 					Labels: map[string]string{
-						"region":   "us-south-1",
-						"tag:Name": "*test*",
+						"region":            "us-south-1",
+						"tag:Name":          "*test*",
+						"vpc-id":            "vpc-1234",
+						"subnet-id":         "subnet-5678",
+						"availability-zone": "us-south-1a",
+					},
+					Annotations: map[string]string{
+						"launchTime": "2021-07-11T00:00:00Z",
+					},
+				},
+			}),
+		},
+		{
+			Name:     "Resource tags",
+			YamlPath: "testdata/ec2_test_resource.yml",
+			MockEC2: &MockEC2{
+				DescribeInstancesFunc: func(query *jump.PromptQuery, input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+					return &ec2.DescribeInstancesOutput{
+						Reservations: []*ec2.Reservation{
+							{
+								Instances: []*ec2.Instance{
+									{
+										InstanceId:     aws.String("i-12345678"),
+										PrivateDnsName: aws.String("12345678.example.com"),
+										State: &ec2.InstanceState{
+											Name: aws.String("running"),
+										},
+										LaunchTime: aws.Time(
+											time.Date(2021, time.July, 11, 0, 0, 0, 0, time.UTC),
+										),
+										Tags: []*ec2.Tag{
+											{
+												Key:   aws.String("jump:name"),
+												Value: aws.String("web"),
+											},
+											{
+												Key:   aws.String("jump:username"),
+												Value: aws.String("deploy"),
+											},
+											{
+												Key:   aws.String("jump:featured"),
+												Value: aws.String("true"),
+											},
+										},
+									},
+									{
+										InstanceId:     aws.String("i-9101112"),
+										PrivateDnsName: aws.String("9101112.example.com"),
+										State: &ec2.InstanceState{
+											Name: aws.String("running"),
+										},
+										LaunchTime: aws.Time(
+											time.Date(2020, time.July, 11, 0, 0, 0, 0, time.UTC),
+										),
+										Tags: []*ec2.Tag{
+											{
+												Key:   aws.String("jump:exclude"),
+												Value: aws.String("true"),
+											},
+										},
+									},
+								},
+							},
+						},
+					}, nil
+				},
+			},
+			WantPrompts: jump.Prompts([]*jump.Prompt{
+				{
+					ID:          "ec2-cb0aaa50037829ed",
+					Name:        "web",
+					Description: "An EC2 instance",
+					Hostname:    "12345678.example.com",
+					Username:    "ec2-user",
+					Featured:    aws.Bool(true),
+					Kind:        "host",
+					Provider:    "ec2",
+					Annotations: map[string]string{
+						"launchTime": "2021-07-11T00:00:00Z",
+					},
+				},
+				{
+					ID:          "ec2-92dd130489428f5a",
+					Name:        "i-12345678",
+					Description: "An EC2 instance in an untrusted account",
+					Hostname:    "12345678.example.com",
+					Username:    "ec2-user",
+					Kind:        "host",
+					Provider:    "ec2",
+					Annotations: map[string]string{
+						"launchTime": "2021-07-11T00:00:00Z",
+					},
+				},
+				{
+					ID:          "ec2-9f98b0e569f9e8bb",
+					Name:        "i-9101112",
+					Description: "An EC2 instance in an untrusted account",
+					Hostname:    "9101112.example.com",
+					Username:    "ec2-user",
+					Kind:        "host",
+					Provider:    "ec2",
+					Annotations: map[string]string{
+						"launchTime": "2020-07-11T00:00:00Z",
+					},
+				},
+			}),
+		},
+		{
+			Name:     "Connection modes",
+			YamlPath: "testdata/ec2_test_connection_modes.yml",
+			MockEC2: &MockEC2{
+				DescribeInstancesFunc: func(query *jump.PromptQuery, input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+					if len(input.Filters) != 0 {
+						t.Errorf("Expected connection-mode not to be passed to DescribeInstances, got %s", input.Filters)
+					}
+					instances := []*ec2.Instance{
+						{
+							InstanceId:     aws.String("i-12345678"),
+							PrivateDnsName: aws.String("12345678.example.com"),
+							VpcId:          aws.String("vpc-1234"),
+							SubnetId:       aws.String("subnet-b"),
+							State: &ec2.InstanceState{
+								Name: aws.String("running"),
+							},
+							LaunchTime: aws.Time(
+								time.Date(2021, time.July, 11, 0, 0, 0, 0, time.UTC),
+							),
+						},
+					}
+					if query.Options["connection-mode"] == "endpoint" {
+						instances = append(instances, &ec2.Instance{
+							InstanceId:     aws.String("i-9101112"),
+							PrivateDnsName: aws.String("9101112.example.com"),
+							VpcId:          aws.String("vpc-9999"),
+							State: &ec2.InstanceState{
+								Name: aws.String("running"),
+							},
+							LaunchTime: aws.Time(
+								time.Date(2020, time.July, 11, 0, 0, 0, 0, time.UTC),
+							),
+						})
+					}
+					return &ec2.DescribeInstancesOutput{
+						Reservations: []*ec2.Reservation{{Instances: instances}},
+					}, nil
+				},
+				DescribeInstanceConnectEndpointsFunc: func(query *jump.PromptQuery, input *ec2.DescribeInstanceConnectEndpointsInput) (*ec2.DescribeInstanceConnectEndpointsOutput, error) {
+					if *input.Filters[0].Name != "vpc-id" {
+						t.Fatalf("Expected a vpc-id filter, got %s", input.Filters)
+					}
+					if *input.Filters[0].Values[0] != "vpc-1234" {
+						return &ec2.DescribeInstanceConnectEndpointsOutput{}, nil
+					}
+					return &ec2.DescribeInstanceConnectEndpointsOutput{
+						InstanceConnectEndpoints: []*ec2.Ec2InstanceConnectEndpoint{
+							{
+								InstanceConnectEndpointId: aws.String("eice-a"),
+								SubnetId:                  aws.String("subnet-a"),
+							},
+							{
+								InstanceConnectEndpointId: aws.String("eice-b"),
+								SubnetId:                  aws.String("subnet-b"),
+							},
+						},
+					}, nil
+				},
+			},
+			WantPrompts: jump.Prompts([]*jump.Prompt{
+				{
+					ID:             "ec2-3385780c8fe41dea",
+					Name:           "i-12345678",
+					Hostname:       "12345678.example.com",
+					Username:       "ec2-user",
+					ConnectCommand: "aws ec2-instance-connect ssh --instance-id i-12345678 --connection-type direct --os-user ec2-user --region us-notexist-1",
+					Kind:           "host",
+					Provider:       "ec2",
+					Labels: map[string]string{
+						"vpc-id":    "vpc-1234",
+						"subnet-id": "subnet-b",
 					},
 					Annotations: map[string]string{
 						"launchTime": "2021-07-11T00:00:00Z",
 					},
 				},
+				{
+					ID:             "ec2-be49261c37df1c6b",
+					Name:           "i-12345678",
+					Hostname:       "12345678.example.com",
+					Username:       "ec2-user",
+					ConnectCommand: "ssh -o ProxyCommand='aws ec2-instance-connect open-tunnel --instance-id i-12345678 --instance-connect-endpoint-id eice-b --region us-south-1' ec2-user@i-12345678",
+					Kind:           "host",
+					Provider:       "ec2",
+					Labels: map[string]string{
+						"region":    "us-south-1",
+						"vpc-id":    "vpc-1234",
+						"subnet-id": "subnet-b",
+					},
+					Annotations: map[string]string{
+						"launchTime":                "2021-07-11T00:00:00Z",
+						"instanceConnectEndpointId": "eice-b",
+					},
+				},
+				{
+					ID:       "ec2-22381a29030cedfe",
+					Name:     "i-9101112",
+					Hostname: "9101112.example.com",
+					Username: "ec2-user",
+					Kind:     "host",
+					Provider: "ec2",
+					ProxyJumpSelector: map[string]string{
+						"role": "bastion",
+					},
+					Labels: map[string]string{
+						"region": "us-south-1",
+						"vpc-id": "vpc-9999",
+					},
+					Annotations: map[string]string{
+						"launchTime":  "2020-07-11T00:00:00Z",
+						"unreachable": `no EC2 Instance Connect Endpoint in VPC "vpc-9999"`,
+					},
+				},
+			}),
+		},
+		{
+			Name:     "Instance health",
+			YamlPath: "testdata/ec2_test_health.yml",
+			MockEC2: &MockEC2{
+				DescribeInstancesFunc: func(query *jump.PromptQuery, input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+					if len(input.Filters) != 0 {
+						t.Errorf("Got filters %v, wanted none", input.Filters)
+					}
+					return &ec2.DescribeInstancesOutput{
+						Reservations: []*ec2.Reservation{
+							{
+								Instances: []*ec2.Instance{
+									healthInstance("i-healthy", "running", "web"),
+									healthInstance("i-impaired", "running", ""),
+									healthInstance("i-terminating", "running", "web"),
+									healthInstance("i-stopped", "stopped", ""),
+								},
+							},
+						},
+					}, nil
+				},
+				DescribeInstanceStatusFunc: func(query *jump.PromptQuery, input *ec2.DescribeInstanceStatusInput) (*ec2.DescribeInstanceStatusOutput, error) {
+					wantIds := aws.StringSlice([]string{"i-healthy", "i-impaired", "i-terminating"})
+					if !reflect.DeepEqual(input.InstanceIds, wantIds) {
+						t.Error(pretty.Compare(input.InstanceIds, wantIds))
+					}
+					// One status per page
+					statuses := map[string]*ec2.DescribeInstanceStatusOutput{
+						"": {
+							InstanceStatuses: []*ec2.InstanceStatus{instanceStatus("i-healthy", "ok", "ok")},
+							NextToken:        aws.String("impaired"),
+						},
+						"impaired": {
+							InstanceStatuses: []*ec2.InstanceStatus{instanceStatus("i-impaired", "impaired", "ok")},
+							NextToken:        aws.String("terminating"),
+						},
+						"terminating": {
+							InstanceStatuses: []*ec2.InstanceStatus{instanceStatus("i-terminating", "ok", "ok")},
+						},
+					}
+					return statuses[aws.StringValue(input.NextToken)], nil
+				},
+			},
+			MockAutoScaling: &MockAutoScaling{
+				DescribeAutoScalingInstancesFunc: func(input *autoscaling.DescribeAutoScalingInstancesInput) (*autoscaling.DescribeAutoScalingInstancesOutput, error) {
+					wantIds := aws.StringSlice([]string{"i-healthy", "i-terminating"})
+					if !reflect.DeepEqual(input.InstanceIds, wantIds) {
+						t.Error(pretty.Compare(input.InstanceIds, wantIds))
+					}
+					return &autoscaling.DescribeAutoScalingInstancesOutput{
+						AutoScalingInstances: []*autoscaling.InstanceDetails{
+							{
+								InstanceId:           aws.String("i-healthy"),
+								AutoScalingGroupName: aws.String("web"),
+								LifecycleState:       aws.String("InService"),
+								HealthStatus:         aws.String("HEALTHY"),
+							},
+							{
+								InstanceId:           aws.String("i-terminating"),
+								AutoScalingGroupName: aws.String("web"),
+								LifecycleState:       aws.String("Terminating:Wait"),
+								HealthStatus:         aws.String("HEALTHY"),
+							},
+						},
+					}, nil
+				},
+			},
+			WantPrompts: jump.Prompts([]*jump.Prompt{
+				{
+					ID:          "ec2-8cf740adec67235e",
+					Name:        "i-healthy",
+					Description: "Every instance, with its health",
+					Hostname:    "i-healthy.example.com",
+					Kind:        "host",
+					Provider:    "ec2",
+					Annotations: map[string]string{
+						"launchTime":              "2021-07-11T00:00:00Z",
+						"instanceState":           "running",
+						"instanceStatus":          "ok",
+						"systemStatus":            "ok",
+						"autoScalingGroup":        "web",
+						"lifecycleState":          "InService",
+						"autoScalingHealthStatus": "HEALTHY",
+					},
+				},
+				{
+					ID:          "ec2-6bb745c4cc954895",
+					Name:        "i-impaired",
+					Description: "Every instance, with its health",
+					Hostname:    "i-impaired.example.com",
+					Kind:        "host",
+					Provider:    "ec2",
+					Annotations: map[string]string{
+						"launchTime":     "2021-07-11T00:00:00Z",
+						"instanceState":  "running",
+						"instanceStatus": "impaired",
+						"systemStatus":   "ok",
+					},
+				},
+				{
+					ID:          "ec2-b46105e6421c66db",
+					Name:        "i-terminating",
+					Description: "Every instance, with its health",
+					Hostname:    "i-terminating.example.com",
+					Kind:        "host",
+					Provider:    "ec2",
+					Annotations: map[string]string{
+						"launchTime":              "2021-07-11T00:00:00Z",
+						"instanceState":           "running",
+						"instanceStatus":          "ok",
+						"systemStatus":            "ok",
+						"autoScalingGroup":        "web",
+						"lifecycleState":          "Terminating:Wait",
+						"autoScalingHealthStatus": "HEALTHY",
+					},
+				},
+				{
+					ID:          "ec2-4d0aa2fad4b3e12e",
+					Name:        "i-stopped",
+					Description: "Every instance, with its health",
+					Hostname:    "i-stopped.example.com",
+					Kind:        "host",
+					Provider:    "ec2",
+					Disabled:    aws.Bool(true),
+					Annotations: map[string]string{
+						"launchTime":    "2021-07-11T00:00:00Z",
+						"instanceState": "stopped",
+					},
+				},
+				{
+					ID:          "ec2-f7fc27b837f2a8fe",
+					Name:        "i-healthy",
+					Description: "Healthy instances",
+					Hostname:    "i-healthy.example.com",
+					Kind:        "host",
+					Provider:    "ec2",
+					Annotations: map[string]string{
+						"launchTime":              "2021-07-11T00:00:00Z",
+						"instanceStatus":          "ok",
+						"systemStatus":            "ok",
+						"autoScalingGroup":        "web",
+						"lifecycleState":          "InService",
+						"autoScalingHealthStatus": "HEALTHY",
+					},
+				},
 			}),
 		},
 	}
@@ -180,6 +570,9 @@ func TestEC2Provider(t *testing.T) {
 			}
 			test.MockEC2.Queries = c.Queries
 			provider.EC2Interface = test.MockEC2
+			if test.MockAutoScaling != nil {
+				provider.AutoScalingInterface = test.MockAutoScaling
+			}
 			provider.STSInterface = &aws_provider.MockSTS{}
 			got, err := provider.Discover(c.Queries)
 			if err != nil {
@@ -199,3 +592,94 @@ func TestEC2Provider(t *testing.T) {
 	}
 
 }
+
+func TestEC2ProviderRegions(t *testing.T) {
+	c := &jump.AutoDiscoveryConfig{}
+	configFile, err := ioutil.ReadFile("testdata/ec2_test_regions.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(configFile, c); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each region has an instance in service and one terminating, in an Auto Scaling group only its own client knows
+	ec2Clients := map[string]*MockEC2{}
+	autoScalingClients := map[string]*MockAutoScaling{}
+	for i, region := range []string{"us-east-1", "us-west-2"} {
+		inService, terminating := "i-in-service-"+region, "i-terminating-"+region
+		ec2Clients[region] = &MockEC2{
+			Queries: c.Queries[i : i+1],
+			DescribeInstancesFunc: func(query *jump.PromptQuery, input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+				return &ec2.DescribeInstancesOutput{
+					Reservations: []*ec2.Reservation{
+						{Instances: []*ec2.Instance{healthInstance(inService, "running", "web"), healthInstance(terminating, "running", "web")}},
+					},
+				}, nil
+			},
+		}
+		autoScalingClients[region] = &MockAutoScaling{
+			DescribeAutoScalingInstancesFunc: func(input *autoscaling.DescribeAutoScalingInstancesInput) (*autoscaling.DescribeAutoScalingInstancesOutput, error) {
+				return &autoscaling.DescribeAutoScalingInstancesOutput{
+					AutoScalingInstances: []*autoscaling.InstanceDetails{
+						{InstanceId: aws.String(inService), AutoScalingGroupName: aws.String("web"), LifecycleState: aws.String("InService"), HealthStatus: aws.String("HEALTHY")},
+						{InstanceId: aws.String(terminating), AutoScalingGroupName: aws.String("web"), LifecycleState: aws.String("Terminating:Wait"), HealthStatus: aws.String("HEALTHY")},
+					},
+				}, nil
+			},
+		}
+	}
+	newEC2, newAutoScaling := aws_provider.NewEC2Interface, aws_provider.NewAutoScalingInterface
+	defer func() { aws_provider.NewEC2Interface, aws_provider.NewAutoScalingInterface = newEC2, newAutoScaling }()
+	aws_provider.NewEC2Interface = func(regionSession *session.Session) aws_provider.EC2Interface {
+		return ec2Clients[*regionSession.Config.Region]
+	}
+	aws_provider.NewAutoScalingInterface = func(regionSession *session.Session) aws_provider.AutoScalingInterface {
+		return autoScalingClients[*regionSession.Config.Region]
+	}
+
+	provider := &aws_provider.EC2{}
+	provider.Initialize(aws_provider.EC2ProviderConfig{STSInterface: &aws_provider.MockSTS{}})
+	got, err := provider.Discover(c.Queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range got {
+		names = append(names, p.Name)
+	}
+	if want := []string{"i-in-service-us-east-1", "i-in-service-us-west-2"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Got prompts %v, wanted %v", names, want)
+	}
+}
+
+// Returns a launched instance in state, tagged with the name of its Auto Scaling group unless group is empty.
+func healthInstance(id, state, group string) *ec2.Instance {
+	instance := &ec2.Instance{
+		InstanceId:     aws.String(id),
+		PrivateDnsName: aws.String(id + ".example.com"),
+		State: &ec2.InstanceState{
+			Name: aws.String(state),
+		},
+		LaunchTime: aws.Time(
+			time.Date(2021, time.July, 11, 0, 0, 0, 0, time.UTC),
+		),
+	}
+	if group != "" {
+		instance.Tags = []*ec2.Tag{
+			{
+				Key:   aws.String("aws:autoscaling:groupName"),
+				Value: aws.String(group),
+			},
+		}
+	}
+	return instance
+}
+
+func instanceStatus(id, instance, system string) *ec2.InstanceStatus {
+	return &ec2.InstanceStatus{
+		InstanceId:     aws.String(id),
+		InstanceStatus: &ec2.InstanceStatusSummary{Status: aws.String(instance)},
+		SystemStatus:   &ec2.InstanceStatusSummary{Status: aws.String(system)},
+	}
+}
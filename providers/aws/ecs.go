@@ -3,52 +3,351 @@ package aws
 import (
 	"errors"
 	"fmt"
-	"log"
 	"sort"
+	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ssm"
 	jump "github.com/cased/jump/types/v1alpha"
 )
 
 // The ECS auto-discovery Provider queries ECS for running containers on EC2 instances and constructs the `docker exec` arguments necessary to run a command inside those containers.
 //
+// Containers on ECS Anywhere external instances are included too. Their `mi-` managed instance ids are resolved with
+// SSM DescribeInstanceInformation, which gives the Hostname, the instance's computer name, and the IpAddress.
+// Container instances that can't be resolved are skipped with a warning, see jump.PromptQuery.Warn.
+//
 // # Filters
 //
 // The ECS Provider accepts the following filters:
 //
 // - region: The AWS region to query. Defaults to the current region.
 // - cluster: The ECS cluster to query. Defaults to the 'default cluster'.
-// - task-group: The name of the ECS Task Group.
+// - task-group: The name of the ECS Task Group, like `service:api`.
+// - service: The name of the ECS Service that started the task.
+// - task-definition-family: The family of the task's definition.
+// - launch-type: The launch type of the task, EC2 or EXTERNAL.
+// - tag:<key>: The value of a task tag.
 // - container-name: The name of a running Container.
+// - essential: If true, only containers marked essential in their task definition.
+// - health-status: The health status of the task, HEALTHY, UNHEALTHY or UNKNOWN. Defaults to `!UNHEALTHY`.
+// - container-instance-status: The status of the container instance, like ACTIVE. Defaults to `!DRAINING`.
+//
+// Tasks that are stopping, with a desired status of STOPPED, are always left out. To prefer healthy tasks without
+// requiring them, sort by `annotations.healthStatus` first, as HEALTHY sorts before UNKNOWN.
+//
+// Every filter other than region and essential accepts a pattern: a glob, like `service:api-*`, or a regular
+// expression between slashes, like `/^(envoy|datadog-agent)$/`, negated by a leading `!`. A task without a service,
+// or without a tag, matches the pattern as an empty string. A cluster pattern, like `*` or `prod-*`, queries every
+// matching cluster in the region, in parallel. A matching cluster that can't be queried is skipped with a warning,
+// unless every matching cluster fails.
+//
+// # Options
+//
+// The ECS Provider accepts the following options:
+//
+// - runtime: The container runtime to run commands with, see Container runtimes. Defaults to docker.
+//
+// # Container runtimes
+//
+// The JumpCommand and PreDownloadCommand of each Prompt find the container by the labels the ECS agent gives it, and
+// run `exec` and `cp` with the query's runtime: docker, nerdctl or podman, each optionally prefixed by `sudo `.
+//
+// For other runtimes, set jumpCommand and preDownloadCommand in the query's Prompt template. They may use the
+// placeholders `{container}`, a shell expression printing the container's id with the query's runtime, `{taskArn}`
+// and `{containerName}`, which are replaced with shell-quoted values.
 //
 // # Sorting
 //
-// The ECS Provider supports sorting by the following keys:
+// The ECS Provider sorts natively by the following keys:
 //
 // - startedAt
 //
+// Other keys are sorted by jump. The Provider only applies the query's limit when jump asks it to, see
+// PromptQuery.ProviderLimit.
+//
+// # Ids
+//
+// Prompt ids are derived from the task ARN and container name, so a restarted task gets a new id.
+//
+// # Labels
+//
+// The ECS Provider labels each Prompt with the network location of the EC2 container instance it runs on, when known:
+//
+// - vpc-id: The id of the VPC the container instance runs in.
+// - subnet-id: The id of the subnet the container instance runs in.
+// - availability-zone: The availability zone the container instance runs in.
+//
+// Prompts are labeled with their cluster, when the query names one or selects several with a pattern, and with the
+// region filter. For each of the task-group, service, task-definition-family, launch-type and container-name filters
+// the query sets, the task or container's value is added as a label.
+//
+// # Resource configuration
+//
+// When enabled with the query's resourceConfig, the ECS Provider reads Prompt configuration from the Docker labels
+// of each container in its task definition with the `jump:` prefix, like `jump:name` or `jump:featured`, and leaves
+// out containers labeled `jump:exclude=true`. See jump.ResourceConfig.
+//
 // # Annotations
 //
-// The ECS Provider appends the following annotations to each Prompt:
+// The ECS Provider appends the following annotations to each Prompt, when known, recording why it was included:
 //
 // - startedAt: The time the container was started.
+// - healthStatus: The health status of the task.
+// - containerHealthStatus: The health status of the container.
+// - desiredStatus: The desired status of the task, RUNNING.
+// - containerInstanceStatus: The status of the container instance.
 type ECS struct {
-	cache *ecsCache
-
 	EC2Interface EC2Interface
 	ECSInterface ECSInterface
+	SSMInterface SSMInterface
 	STSInterface STSInterface
 }
+
+// The state of the discovery of one cluster. Clusters are discovered in parallel, each with its own ecsCache.
 type ecsCache struct {
-	ec2InstancePrivateDnsNames map[string]string
-	taskContainerArns          map[string]string
+	hosts             map[string]*ecsHost
+	taskContainerArns map[string]string
+	taskDefinitions   map[string]*ecs.TaskDefinition
+	warnings          []string // Reported to the query once every cluster is discovered, see PromptQuery.Warn.
+}
+
+func newECSCache() *ecsCache {
+	return &ecsCache{
+		hosts:             make(map[string]*ecsHost),
+		taskContainerArns: make(map[string]string),
+		taskDefinitions:   make(map[string]*ecs.TaskDefinition),
+	}
+}
+
+func (cache *ecsCache) warn(format string, args ...interface{}) {
+	cache.warnings = append(cache.warnings, fmt.Sprintf(format, args...))
+}
+
+// A cluster to discover. name is passed to the ECS API, and is empty for the default cluster. label is the value of
+// the cluster label of its Prompts.
+type ecsCluster struct {
+	name  string
+	label string
+}
+
+// The filters a query's tasks and containers must match, and the container runtime to run commands with, parsed
+// once per query.
+type ecsTaskFilters struct {
+	patterns  map[string]*filterPattern // By filter key, including tags. A missing pattern matches everything.
+	essential bool
+	runtime   string // One of ecsRuntimes
+}
+
+// The container runtimes the ECS Provider can run commands with, by the value of the runtime option. Each is the
+// command line of its CLI, which must accept the Docker CLI's ps, exec and cp commands.
+var ecsRuntimes = []string{"docker", "sudo docker", "nerdctl", "sudo nerdctl", "podman", "sudo podman"}
+
+// The filters matched as patterns, other than tags.
+var ecsPatternFilterKeys = map[string]bool{
+	"task-group":                true,
+	"service":                   true,
+	"task-definition-family":    true,
+	"launch-type":               true,
+	"container-name":            true,
+	"health-status":             true,
+	"container-instance-status": true,
+}
+
+// The patterns of filters the query doesn't set. Unhealthy tasks, and tasks on draining container instances, which
+// are about to be stopped, are left out unless the query asks for them.
+var ecsPatternFilterDefaults = map[string]string{
+	"health-status":             "!UNHEALTHY",
+	"container-instance-status": "!DRAINING",
+}
+
+func parseECSTaskFilters(filters, options map[string]string) (*ecsTaskFilters, error) {
+	taskFilters := &ecsTaskFilters{patterns: map[string]*filterPattern{}}
+	values := map[string]string{}
+	for key, value := range ecsPatternFilterDefaults {
+		values[key] = value
+	}
+	for key, value := range filters {
+		if value == "" || !(ecsPatternFilterKeys[key] || strings.HasPrefix(key, "tag:")) {
+			continue
+		}
+		values[key] = value
+	}
+	for key, value := range values {
+		pattern, err := parseFilterPattern(key, value)
+		if err != nil {
+			return nil, err
+		}
+		taskFilters.patterns[key] = pattern
+	}
+	switch filters["essential"] {
+	case "", "false":
+	case "true":
+		taskFilters.essential = true
+	default:
+		return nil, fmt.Errorf("filter essential must be true or false, got %q", filters["essential"])
+	}
+	taskFilters.runtime = "docker"
+	if runtime := options["runtime"]; runtime != "" {
+		taskFilters.runtime = ""
+		for _, name := range ecsRuntimes {
+			if runtime == name {
+				taskFilters.runtime = runtime
+			}
+		}
+		if taskFilters.runtime == "" {
+			return nil, fmt.Errorf("option runtime must be one of %s, got %q", strings.Join(ecsRuntimes, ", "), runtime)
+		}
+	}
+	return taskFilters, nil
+}
+
+// Reports whether a task matches the task filters, and isn't stopping. Tasks that aren't part of a service have an
+// empty service name, and missing tags an empty value.
+func (filters *ecsTaskFilters) matchTask(task *ecs.Task) bool {
+	// Stopping tasks are still RUNNING until their containers exit
+	if aws.StringValue(task.DesiredStatus) == ecs.DesiredStatusStopped {
+		return false
+	}
+	if !filters.patterns["task-group"].Match(aws.StringValue(task.Group)) ||
+		!filters.patterns["health-status"].Match(aws.StringValue(task.HealthStatus)) ||
+		!filters.patterns["service"].Match(ecsTaskService(task)) ||
+		!filters.patterns["task-definition-family"].Match(ecsTaskDefinitionFamily(task)) ||
+		!filters.patterns["launch-type"].Match(aws.StringValue(task.LaunchType)) {
+		return false
+	}
+	for key, pattern := range filters.patterns {
+		if !strings.HasPrefix(key, "tag:") {
+			continue
+		}
+		value := ""
+		for _, tag := range task.Tags {
+			if aws.StringValue(tag.Key) == strings.TrimPrefix(key, "tag:") {
+				value = aws.StringValue(tag.Value)
+			}
+		}
+		if !pattern.Match(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Reports whether a container instance matches the container instance filters.
+func (filters *ecsTaskFilters) matchContainerInstance(containerInstance *ecs.ContainerInstance) bool {
+	return filters.patterns["container-instance-status"].Match(aws.StringValue(containerInstance.Status))
+}
+
+// Reports whether the query has tag filters, for which tasks must be described with their tags.
+func (filters *ecsTaskFilters) hasTags() bool {
+	for key := range filters.patterns {
+		if strings.HasPrefix(key, "tag:") {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether a container matches the container filters. taskDefinition may be nil, in which case every container
+// is considered essential, as it is by default.
+func (filters *ecsTaskFilters) matchContainer(container *ecs.Container, taskDefinition *ecs.TaskDefinition) bool {
+	if !filters.patterns["container-name"].Match(aws.StringValue(container.Name)) {
+		return false
+	}
+	if filters.essential {
+		if definition := containerDefinition(taskDefinition, aws.StringValue(container.Name)); definition != nil && definition.Essential != nil && !*definition.Essential {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the annotations of a container: when it was started, and the statuses it was included for, when known.
+func ecsStatusAnnotations(task *ecs.Task, container *ecs.Container, containerInstance *ecs.ContainerInstance) map[string]string {
+	annotations := map[string]string{
+		"startedAt": task.StartedAt.String(),
+	}
+	statuses := map[string]*string{
+		"healthStatus":            task.HealthStatus,
+		"containerHealthStatus":   container.HealthStatus,
+		"desiredStatus":           task.DesiredStatus,
+		"containerInstanceStatus": containerInstance.Status,
+	}
+	for key, status := range statuses {
+		if aws.StringValue(status) != "" {
+			annotations[key] = *status
+		}
+	}
+	return annotations
+}
+
+// Returns a shell expression printing the id of a container, found by the labels the ECS agent gives it, like
+// `$(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=... -q | head -n1)`.
+func ecsContainerLookup(runtime, taskArn, containerName string) string {
+	return fmt.Sprintf("$(%s ps --filter %s --filter %s -q | head -n1)",
+		runtime,
+		shellQuote("label=com.amazonaws.ecs.container-name="+containerName),
+		shellQuote("label=com.amazonaws.ecs.task-arn="+taskArn),
+	)
+}
+
+// Replaces the placeholders documented on the ECS Provider in the Prompt's JumpCommand and PreDownloadCommand, which
+// may come from the query's Prompt template or the container's Docker labels.
+func expandContainerPlaceholders(prompt *jump.Prompt, lookup, taskArn, containerName string) {
+	replacer := strings.NewReplacer(
+		"{container}", lookup,
+		"{taskArn}", shellQuote(taskArn),
+		"{containerName}", shellQuote(containerName),
+	)
+	prompt.JumpCommand = replacer.Replace(prompt.JumpCommand)
+	prompt.PreDownloadCommand = replacer.Replace(prompt.PreDownloadCommand)
+}
+
+// Returns the name of the service that started the task, from its group `service:<name>`, or an empty string.
+func ecsTaskService(task *ecs.Task) string {
+	group := aws.StringValue(task.Group)
+	if !strings.HasPrefix(group, "service:") {
+		return ""
+	}
+	return strings.TrimPrefix(group, "service:")
+}
+
+// Returns the family of the task's definition, from its ARN `...:task-definition/<family>:<revision>`.
+func ecsTaskDefinitionFamily(task *ecs.Task) string {
+	arn := aws.StringValue(task.TaskDefinitionArn)
+	family := arn[strings.LastIndex(arn, "/")+1:]
+	if i := strings.LastIndex(family, ":"); i >= 0 {
+		family = family[:i]
+	}
+	return family
+}
+
+// The maximum number of clusters discovered at once by a query.
+const ecsClusterConcurrency = 8
+
+// Where the containers of a container instance run.
+type ecsHost struct {
+	hostname  string
+	ipAddress string
+	instance  *ec2.Instance // nil for external instances
+}
+
+// Returns new network labels for a Prompt on the host, if it is an EC2 instance.
+func (host *ecsHost) labels() map[string]string {
+	if host.instance == nil {
+		return nil
+	}
+	return instanceNetworkLabels(host.instance)
 }
 
 type ECSProviderConfig struct {
 	EC2Interface EC2Interface
 	ECSInterface ECSInterface
+	SSMInterface SSMInterface
 	STSInterface STSInterface
 }
 
@@ -57,49 +356,167 @@ func (provider *ECS) Initialize(providerConfig interface{}) {
 		typedConfig := providerConfig.(ECSProviderConfig)
 		provider.EC2Interface = typedConfig.EC2Interface
 		provider.ECSInterface = typedConfig.ECSInterface
+		provider.SSMInterface = typedConfig.SSMInterface
 		provider.STSInterface = typedConfig.STSInterface
 	}
 }
 
-func (provider *ECS) Discover(queries []*jump.PromptQuery) ([]*jump.Prompt, error) {
-	var prompts []*jump.Prompt
-	for _, query := range queries {
-		queryPrompts, err := provider.Query(query)
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-		prompts = append(prompts, queryPrompts...)
+func (provider *ECS) Describe() *jump.ProviderSchema {
+	return &jump.ProviderSchema{
+		Description: "Queries ECS for running containers on EC2 instances and constructs the `docker exec` arguments necessary to run a command inside those containers.",
+		Filters: []jump.SchemaKey{
+			{Name: "region", Description: "The AWS region to query. Defaults to the current region."},
+			{Name: "cluster", Description: "The ECS cluster to query. Defaults to the 'default cluster'. A pattern, like `prod-*`, queries every matching cluster in the region."},
+			{Name: "task-group", Description: "The name of the ECS Task Group."},
+			{Name: "service", Description: "The name of the ECS Service that started the task."},
+			{Name: "task-definition-family", Description: "The family of the task's definition."},
+			{Name: "launch-type", Description: "The launch type of the task, EC2 or EXTERNAL."},
+			{Name: "tag:*", Description: "The value of a task tag."},
+			{Name: "container-name", Description: "The name of a running Container."},
+			{Name: "essential", Description: "If true, only containers marked essential in their task definition.", Values: []string{"true", "false"}},
+			{Name: "health-status", Description: "The health status of the task, HEALTHY, UNHEALTHY or UNKNOWN. Defaults to `!UNHEALTHY`."},
+			{Name: "container-instance-status", Description: "The status of the container instance, like ACTIVE. Defaults to `!DRAINING`."},
+		},
+		Options: []jump.SchemaKey{
+			{Name: "runtime", Description: "The container runtime to run commands with. Defaults to docker.", Values: ecsRuntimes},
+		},
+		SortKeys: []jump.SchemaKey{
+			{Name: "startedAt", Description: "The time the container was started."},
+		},
+		Labels: networkLabelKeys,
+		Annotations: []jump.SchemaKey{
+			{Name: "startedAt", Description: "The time the container was started."},
+			{Name: "healthStatus", Description: "The health status of the task."},
+			{Name: "containerHealthStatus", Description: "The health status of the container."},
+			{Name: "desiredStatus", Description: "The desired status of the task."},
+			{Name: "containerInstanceStatus", Description: "The status of the container instance."},
+		},
 	}
-	return prompts, nil
+}
+
+func (provider *ECS) Discover(queries []*jump.PromptQuery) ([]*jump.Prompt, error) {
+	return discoverEach(queries, provider.Query)
 }
 
 func (provider *ECS) Query(query *jump.PromptQuery) ([]*jump.Prompt, error) {
-	cache := &ecsCache{
-		ec2InstancePrivateDnsNames: make(map[string]string),
-		taskContainerArns:          make(map[string]string),
+	regionSession, err := GetAWSSession(query.Filters["region"])
+	if err != nil {
+		return nil, err
 	}
-	provider.cache = cache
 
-	regionSession, err := GetAWSSession(query.Filters["region"])
+	provider = provider.forRegion(regionSession)
+
+	filters, err := parseECSTaskFilters(query.Filters, query.Options)
+	if err != nil {
+		return nil, err
+	}
+	clusters, err := provider.listClusters(query.Filters["cluster"])
 	if err != nil {
 		return nil, err
 	}
 
-	// AWS ECS endpoints
-	if provider.ECSInterface == nil {
-		provider.ECSInterface = ecs.New(regionSession)
+	// Each cluster is discovered in parallel, and the results merged in cluster order
+	clusterPrompts := make([][]*jump.Prompt, len(clusters))
+	clusterCaches := make([]*ecsCache, len(clusters))
+	clusterQueries := make([]*jump.PromptQuery, len(clusters))
+	clusterErrs := make([]error, len(clusters))
+	semaphore := make(chan struct{}, ecsClusterConcurrency)
+	var wg sync.WaitGroup
+	for i, cluster := range clusters {
+		wg.Add(1)
+		go func(i int, cluster ecsCluster) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			clusterCaches[i] = newECSCache()
+			clusterQueries[i] = query.Fork()
+			clusterPrompts[i], clusterErrs[i] = provider.queryCluster(clusterQueries[i], filters, cluster, clusterCaches[i])
+		}(i, cluster)
 	}
+	wg.Wait()
 
-	// AWS EC2 endpoints
-	if provider.EC2Interface == nil {
-		provider.EC2Interface = ec2.New(regionSession)
+	failed := 0
+	for _, err := range clusterErrs {
+		if err != nil {
+			failed++
+		}
+	}
+	var prompts []*jump.Prompt
+	for i, cluster := range clusters {
+		for _, warning := range append(clusterCaches[i].warnings, clusterQueries[i].Warnings()...) {
+			query.Warn("%s", warning)
+		}
+		if clusterErrs[i] != nil {
+			// A cluster named by the query fails it. Clusters matched by a pattern are skipped with a warning, unless
+			// they all fail, so one cluster the credentials can't read doesn't hide the others.
+			if cluster.name == query.Filters["cluster"] {
+				return nil, clusterErrs[i]
+			}
+			if failed == len(clusters) {
+				return nil, fmt.Errorf("ecs cluster %s: %w", cluster.name, clusterErrs[i])
+			}
+			query.Warn("skipping ecs cluster %s: %s", cluster.name, clusterErrs[i])
+			continue
+		}
+		prompts = append(prompts, clusterPrompts[i]...)
 	}
 
-	// List all ECS containers, filter by cluster if provided
+	switch query.SortBy {
+	case "startedAt":
+		sort.SliceStable(prompts, func(i, j int) bool {
+			if query.SortOrder == "desc" {
+				return prompts[i].Annotations["startedAt"] > prompts[j].Annotations["startedAt"]
+			} else {
+				return prompts[i].Annotations["startedAt"] < prompts[j].Annotations["startedAt"]
+			}
+		})
+	}
+
+	if limit := query.ProviderLimit(); limit != 0 && len(prompts) > limit {
+		prompts = prompts[:limit]
+	}
+
+	return prompts, nil
+}
+
+// Returns the names of the clusters to query. A cluster filter that is a pattern, like `*` or `prod-*`, selects every
+// matching cluster in the region; any other value is a single cluster, and no value the default cluster.
+func (provider *ECS) listClusters(filter string) ([]ecsCluster, error) {
+	if !isFilterPattern(filter) {
+		return []ecsCluster{{name: filter, label: filter}}, nil
+	}
+	pattern, err := parseFilterPattern("cluster", filter)
+	if err != nil {
+		return nil, err
+	}
+	var clusters []ecsCluster
+	input := &ecs.ListClustersInput{}
+	for {
+		output, err := provider.ECSInterface.ListClusters(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, arn := range aws.StringValueSlice(output.ClusterArns) {
+			// arn:aws:ecs:region:account:cluster/name
+			name := arn[strings.LastIndex(arn, "/")+1:]
+			if pattern.Match(name) {
+				clusters = append(clusters, ecsCluster{name: name, label: name})
+			}
+		}
+		if aws.StringValue(output.NextToken) == "" {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+	return clusters, nil
+}
+
+// Returns the Prompts of the containers running in one cluster, before sorting and limiting.
+func (provider *ECS) queryCluster(query *jump.PromptQuery, filters *ecsTaskFilters, cluster ecsCluster, cache *ecsCache) ([]*jump.Prompt, error) {
+	// List all ECS containers of the cluster
 	listContainerInstancesInput := &ecs.ListContainerInstancesInput{}
-	if query.Filters["cluster"] != "" {
-		listContainerInstancesInput.Cluster = aws.String(query.Filters["cluster"])
+	if cluster.name != "" {
+		listContainerInstancesInput.Cluster = aws.String(cluster.name)
 	}
 	containers, err := provider.ECSInterface.ListContainerInstances(listContainerInstancesInput)
 	if err != nil {
@@ -116,9 +533,8 @@ func (provider *ECS) Query(query *jump.PromptQuery) ([]*jump.Prompt, error) {
 			ContainerInstance: containerArn,
 			DesiredStatus:     aws.String("RUNNING"),
 		}
-		// Filter by cluster if provided
-		if query.Filters["cluster"] != "" {
-			listTasksInput.Cluster = aws.String(query.Filters["cluster"])
+		if cluster.name != "" {
+			listTasksInput.Cluster = aws.String(cluster.name)
 		}
 		result, err := provider.ECSInterface.ListTasks(listTasksInput)
 		if err != nil {
@@ -129,8 +545,11 @@ func (provider *ECS) Query(query *jump.PromptQuery) ([]*jump.Prompt, error) {
 		describeTasksInput := &ecs.DescribeTasksInput{
 			Tasks: result.TaskArns,
 		}
-		if query.Filters["cluster"] != "" {
-			describeTasksInput.Cluster = aws.String(query.Filters["cluster"])
+		if cluster.name != "" {
+			describeTasksInput.Cluster = aws.String(cluster.name)
+		}
+		if filters.hasTags() {
+			describeTasksInput.Include = []*string{aws.String(ecs.TaskFieldTags)}
 		}
 		tasks, err := provider.ECSInterface.DescribeTasks(describeTasksInput)
 		if err != nil {
@@ -142,17 +561,15 @@ func (provider *ECS) Query(query *jump.PromptQuery) ([]*jump.Prompt, error) {
 				continue
 			}
 
-			if query.Filters["task-group"] != "" {
-				if *task.Group != query.Filters["task-group"] {
-					continue
-				}
+			if !filters.matchTask(task) {
+				continue
 			}
 
 			describeContainerInstancesInput := &ecs.DescribeContainerInstancesInput{
 				ContainerInstances: []*string{aws.String(*task.ContainerInstanceArn)},
 			}
-			if query.Filters["cluster"] != "" {
-				describeContainerInstancesInput.Cluster = aws.String(query.Filters["cluster"])
+			if cluster.name != "" {
+				describeContainerInstancesInput.Cluster = aws.String(cluster.name)
 			}
 			ci, err := provider.ECSInterface.DescribeContainerInstances(describeContainerInstancesInput)
 			if err != nil {
@@ -162,92 +579,229 @@ func (provider *ECS) Query(query *jump.PromptQuery) ([]*jump.Prompt, error) {
 			// Not the cleanest API, but looked at Web Inspector how AWS event does it,
 			// surprisingly kind of clunky
 			containerInstance := ci.ContainerInstances[0]
+			if !filters.matchContainerInstance(containerInstance) {
+				continue
+			}
 
-			if provider.cache.ec2InstancePrivateDnsNames[*containerInstance.Ec2InstanceId] == "" {
-				di, err := provider.EC2Interface.DescribeInstances(&ec2.DescribeInstancesInput{
-					Filters: []*ec2.Filter{
-						{
-							Name: aws.String("instance-id"),
-							Values: []*string{
-								containerInstance.Ec2InstanceId,
-							},
-						},
-					},
-				})
+			host, err := provider.containerInstanceHost(cache, containerInstance)
+			if err != nil {
+				return nil, err
+			}
+			if host == nil {
+				continue
+			}
+
+			var taskDefinition *ecs.TaskDefinition
+			if query.ReadsResourceConfig() || filters.essential {
+				taskDefinition, err = provider.describeTaskDefinition(cache, task.TaskDefinitionArn)
 				if err != nil {
 					return nil, err
 				}
-
-				if len(di.Reservations) == 0 {
-					return nil, errors.New("could not find any reservations")
-				}
-
-				// If we cared about a particular EC2 instance, we could let the user pick
-				res := di.Reservations[0]
-				if len(res.Instances) == 0 {
-					return nil, errors.New("could not find any instances")
-				}
-
-				i := res.Instances[0]
-
-				provider.cache.ec2InstancePrivateDnsNames[*containerInstance.Ec2InstanceId] = *i.PrivateDnsName
 			}
 
 			for _, container := range task.Containers {
-				if query.Filters["container-name"] != "" {
-					if *container.Name != query.Filters["container-name"] {
-						continue
-					}
+				if !filters.matchContainer(container, taskDefinition) {
+					continue
 				}
 
 				taskContainer := fmt.Sprintf("%s/%s", *task.Group, *container.Name)
+				lookup := ecsContainerLookup(filters.runtime, *container.TaskArn, *container.Name)
 				prompt := &jump.Prompt{
+					ID:                 jump.PromptID("ecs", query, *container.TaskArn, *container.Name),
 					Kind:               "container",
 					Name:               fmt.Sprintf("%s/%s", *task.Group, *container.Name),
-					Hostname:           provider.cache.ec2InstancePrivateDnsNames[*containerInstance.Ec2InstanceId],
-					JumpCommand:        fmt.Sprintf("docker exec -it $(docker ps --filter \"label=com.amazonaws.ecs.container-name=%s\" --filter \"label=com.amazonaws.ecs.task-arn=%s\" -q | head -n1)", *container.Name, *container.TaskArn),
-					PreDownloadCommand: fmt.Sprintf("sh -c 'mkdir -p /tmp/cased-downloads; docker cp $(docker ps --filter \"label=com.amazonaws.ecs.container-name=%s\" --filter \"label=com.amazonaws.ecs.task-arn=%s\" -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'", *container.Name, *container.TaskArn),
-					Annotations: map[string]string{
-						"startedAt": task.StartedAt.String(),
-					},
+					Hostname:           host.hostname,
+					IpAddress:          host.ipAddress,
+					Labels:             host.labels(),
+					JumpCommand:        fmt.Sprintf("%s exec -it %s", filters.runtime, lookup),
+					PreDownloadCommand: "sh -c " + shellQuote(fmt.Sprintf("mkdir -p /tmp/cased-downloads; %s cp %s:{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}", filters.runtime, lookup)),
+					Annotations:        ecsStatusAnnotations(task, container, containerInstance),
 				}
-				prompts = append(prompts, provider.decoratePromptWithQuery(prompt, query))
-				provider.cache.taskContainerArns[taskContainer] = *container.ContainerArn
+				decoratedPrompt := provider.decoratePromptWithQuery(prompt, query, ecsFilterLabels(query, cluster, task, container), containerDockerLabels(taskDefinition, *container.Name))
+				if decoratedPrompt == nil {
+					continue
+				}
+				expandContainerPlaceholders(decoratedPrompt, lookup, *container.TaskArn, *container.Name)
+				prompts = append(prompts, decoratedPrompt)
+				cache.taskContainerArns[taskContainer] = *container.ContainerArn
 			}
 		}
 	}
 
-	switch query.SortBy {
-	case "startedAt":
-		sort.SliceStable(prompts, func(i, j int) bool {
-			if query.SortOrder == "desc" {
-				return prompts[i].Annotations["startedAt"] > prompts[j].Annotations["startedAt"]
-			} else {
-				return prompts[i].Annotations["startedAt"] < prompts[j].Annotations["startedAt"]
+	return prompts, nil
+}
+
+// Returns where the containers of a container instance run, described once per cluster. EC2 instances are described
+// with EC2, and ECS Anywhere external instances, whose ids are SSM managed instance ids, with SSM. Returns nil, and
+// warns, if the container instance should be skipped.
+func (provider *ECS) containerInstanceHost(cache *ecsCache, containerInstance *ecs.ContainerInstance) (*ecsHost, error) {
+	id := aws.StringValue(containerInstance.Ec2InstanceId)
+	if id == "" {
+		cache.warn("skipping container instance %s: it has no EC2 or managed instance id", aws.StringValue(containerInstance.ContainerInstanceArn))
+		return nil, nil
+	}
+	if host, ok := cache.hosts[id]; ok {
+		return host, nil
+	}
+
+	var host *ecsHost
+	if strings.HasPrefix(id, "mi-") {
+		output, err := provider.SSMInterface.DescribeInstanceInformation(&ssm.DescribeInstanceInformationInput{
+			Filters: []*ssm.InstanceInformationStringFilter{
+				{Key: aws.String("InstanceIds"), Values: []*string{aws.String(id)}},
+			},
+		})
+		if err != nil {
+			cache.warn("skipping external container instance %s: %s", id, err)
+		} else if len(output.InstanceInformationList) == 0 {
+			cache.warn("skipping external container instance %s: it isn't a managed instance known to SSM", id)
+		} else {
+			instance := output.InstanceInformationList[0]
+			host = &ecsHost{
+				hostname:  aws.StringValue(instance.ComputerName),
+				ipAddress: aws.StringValue(instance.IPAddress),
+			}
+			if host.hostname == "" {
+				host.hostname = host.ipAddress
+			}
+			if host.hostname == "" {
+				cache.warn("skipping external container instance %s: SSM reports no computer name or IP address", id)
+				host = nil
 			}
+		}
+	} else {
+		di, err := provider.EC2Interface.DescribeInstances(&ec2.DescribeInstancesInput{
+			Filters: []*ec2.Filter{
+				{
+					Name: aws.String("instance-id"),
+					Values: []*string{
+						aws.String(id),
+					},
+				},
+			},
 		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(di.Reservations) == 0 {
+			return nil, errors.New("could not find any reservations")
+		}
+
+		// If we cared about a particular EC2 instance, we could let the user pick
+		res := di.Reservations[0]
+		if len(res.Instances) == 0 {
+			return nil, errors.New("could not find any instances")
+		}
+		instance := res.Instances[0]
+		host = &ecsHost{
+			hostname: aws.StringValue(instance.PrivateDnsName),
+			instance: instance,
+		}
 	}
+	cache.hosts[id] = host
+	return host, nil
+}
+
+// Returns the task definition with the given ARN, described once per cluster. Returns nil if arn is nil.
+func (provider *ECS) describeTaskDefinition(cache *ecsCache, arn *string) (*ecs.TaskDefinition, error) {
+	if arn == nil {
+		return nil, nil
+	}
+	if taskDefinition, ok := cache.taskDefinitions[*arn]; ok {
+		return taskDefinition, nil
+	}
+	output, err := provider.ECSInterface.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: arn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var taskDefinition *ecs.TaskDefinition
+	if output != nil {
+		taskDefinition = output.TaskDefinition
+	}
+	cache.taskDefinitions[*arn] = taskDefinition
+	return taskDefinition, nil
+}
 
-	if query.Limit != 0 && len(prompts) > query.Limit {
-		prompts = prompts[:query.Limit]
+// Returns the Docker labels of the named container in a task definition, or nil if it isn't found.
+func containerDockerLabels(taskDefinition *ecs.TaskDefinition, name string) map[string]string {
+	definition := containerDefinition(taskDefinition, name)
+	if definition == nil {
+		return nil
 	}
+	return aws.StringValueMap(definition.DockerLabels)
+}
 
-	return prompts, nil
+// Returns the labels of a container for the filters of the query: the region, the cluster, unless its label is empty,
+// and, for each of the other filters the query sets, the container's value, as filters may be patterns.
+func ecsFilterLabels(query *jump.PromptQuery, cluster ecsCluster, task *ecs.Task, container *ecs.Container) map[string]string {
+	labels := map[string]string{}
+	if query.Filters["region"] != "" {
+		labels["region"] = query.Filters["region"]
+	}
+	if cluster.label != "" {
+		labels["cluster"] = cluster.label
+	}
+	values := map[string]string{
+		"task-group":             aws.StringValue(task.Group),
+		"service":                ecsTaskService(task),
+		"task-definition-family": ecsTaskDefinitionFamily(task),
+		"launch-type":            aws.StringValue(task.LaunchType),
+		"container-name":         aws.StringValue(container.Name),
+	}
+	for key, value := range values {
+		if query.Filters[key] != "" && value != "" {
+			labels[key] = value
+		}
+	}
+	return labels
 }
 
-func (provider *ECS) decoratePromptWithQuery(prompt *jump.Prompt, query *jump.PromptQuery) *jump.Prompt {
-	decoratedPrompt := prompt.DecorateWithQuery(query)
-	filterKeysToLabels := []string{
-		"region",
-		"cluster",
-		"task-group",
-		"container-name",
+// Returns the definition of the named container in a task definition, or nil if it isn't found.
+func containerDefinition(taskDefinition *ecs.TaskDefinition, name string) *ecs.ContainerDefinition {
+	if taskDefinition == nil {
+		return nil
 	}
-	for _, filterKey := range filterKeysToLabels {
-		if query.Filters[filterKey] != "" {
-			decoratedPrompt.Labels[filterKey] = query.Filters[filterKey]
+	for _, definition := range taskDefinition.ContainerDefinitions {
+		if definition.Name != nil && *definition.Name == name {
+			return definition
 		}
 	}
+	return nil
+}
+
+// Labels the Prompt with labels, see ecsFilterLabels. Returns nil if the container's Docker labels exclude it.
+// Returns a copy of the provider that uses the clients of a region, unless they were set with Initialize.
+func (provider *ECS) forRegion(regionSession *session.Session) *ECS {
+	regional := *provider
+	// AWS ECS endpoints
+	if regional.ECSInterface == nil {
+		regional.ECSInterface = NewECSInterface(regionSession)
+	}
+	// AWS EC2 endpoints
+	if regional.EC2Interface == nil {
+		regional.EC2Interface = NewEC2Interface(regionSession)
+	}
+	// AWS SSM endpoints, for ECS Anywhere external instances
+	if regional.SSMInterface == nil {
+		regional.SSMInterface = NewSSMInterface(regionSession)
+	}
+	return &regional
+}
+
+func (provider *ECS) decoratePromptWithQuery(prompt *jump.Prompt, query *jump.PromptQuery, labels map[string]string, dockerLabels map[string]string) *jump.Prompt {
+	decoratedPrompt := prompt.DecorateWithResource(query, dockerLabels)
+	if decoratedPrompt == nil {
+		return nil
+	}
+	if len(labels) > 0 && decoratedPrompt.Labels == nil {
+		decoratedPrompt.Labels = map[string]string{}
+	}
+	for key, value := range labels {
+		decoratedPrompt.Labels[key] = value
+	}
 	decoratedPrompt.Provider = "ecs"
 	return decoratedPrompt
 }
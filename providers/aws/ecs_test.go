@@ -1,16 +1,19 @@
 package aws_test
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ssm"
 	aws_provider "github.com/cased/jump/providers/aws"
 	jump "github.com/cased/jump/types/v1alpha"
 	"github.com/kylelemons/godebug/pretty"
@@ -18,6 +21,9 @@ import (
 )
 
 type MockECS struct {
+	// Clusters are discovered in parallel
+	mu sync.Mutex
+
 	Queries      []*jump.PromptQuery
 	CurrentQuery *jump.PromptQuery
 
@@ -25,22 +31,32 @@ type MockECS struct {
 	TestDescribeTasksInput              func(*ecs.DescribeTasksInput)
 	TestListContainerInstancesInput     func(*ecs.ListContainerInstancesInput)
 	TestDescribeContainerInstancesInput func(*ecs.DescribeContainerInstancesInput)
+	TestDescribeTaskDefinitionInput     func(*ecs.DescribeTaskDefinitionInput)
+	TestListClustersInput               func(*ecs.ListClustersInput)
 
 	ListTasksOutput                  *ecs.ListTasksOutput
 	DescribeTasksOutput              *ecs.DescribeTasksOutput
 	ListContainerInstancesOutput     *ecs.ListContainerInstancesOutput
 	DescribeContainerInstancesOutput *ecs.DescribeContainerInstancesOutput
+	DescribeTaskDefinitionOutput     *ecs.DescribeTaskDefinitionOutput
+	ListClustersOutput               *ecs.ListClustersOutput
 
 	ListTasksFunc                  func(*jump.PromptQuery, *ecs.ListTasksInput) (*ecs.ListTasksOutput, error)
 	DescribeTasksFunc              func(*jump.PromptQuery, *ecs.DescribeTasksInput) (*ecs.DescribeTasksOutput, error)
 	ListContainerInstancesFunc     func(*jump.PromptQuery, *ecs.ListContainerInstancesInput) (*ecs.ListContainerInstancesOutput, error)
 	DescribeContainerInstancesFunc func(*jump.PromptQuery, *ecs.DescribeContainerInstancesInput) (*ecs.DescribeContainerInstancesOutput, error)
+	DescribeTaskDefinitionFunc     func(*jump.PromptQuery, *ecs.DescribeTaskDefinitionInput) (*ecs.DescribeTaskDefinitionOutput, error)
+	ListClustersFunc               func(*jump.PromptQuery, *ecs.ListClustersInput) (*ecs.ListClustersOutput, error)
 }
 
 func (m *MockECS) ListTasks(input *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
 	// ORDERING DEPENDENT LOGIC ALERT
 	// Call the first query that calls this function the current query
-	m.CurrentQuery, m.Queries = m.Queries[0], m.Queries[1:]
+	m.mu.Lock()
+	if len(m.Queries) > 0 {
+		m.CurrentQuery, m.Queries = m.Queries[0], m.Queries[1:]
+	}
+	m.mu.Unlock()
 
 	if m.TestListTasksInput != nil {
 		m.TestListTasksInput(input)
@@ -81,14 +97,110 @@ func (m *MockECS) DescribeContainerInstances(input *ecs.DescribeContainerInstanc
 	return m.DescribeContainerInstancesOutput, nil
 }
 
+func (m *MockECS) DescribeTaskDefinition(input *ecs.DescribeTaskDefinitionInput) (*ecs.DescribeTaskDefinitionOutput, error) {
+	if m.TestDescribeTaskDefinitionInput != nil {
+		m.TestDescribeTaskDefinitionInput(input)
+	}
+	if m.DescribeTaskDefinitionFunc != nil {
+		return m.DescribeTaskDefinitionFunc(m.CurrentQuery, input)
+	}
+	return m.DescribeTaskDefinitionOutput, nil
+}
+
+func (m *MockECS) ListClusters(input *ecs.ListClustersInput) (*ecs.ListClustersOutput, error) {
+	if m.TestListClustersInput != nil {
+		m.TestListClustersInput(input)
+	}
+	if m.ListClustersFunc != nil {
+		return m.ListClustersFunc(m.CurrentQuery, input)
+	}
+	return m.ListClustersOutput, nil
+}
+
+// A mock EC2 for queries that call DescribeInstances once per cluster, in parallel, so calls can't be matched to
+// queries by their order like MockEC2 does.
+type MockClusterEC2 struct {
+	DescribeInstancesFunc func(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error)
+}
+
+func (m *MockClusterEC2) DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	return m.DescribeInstancesFunc(input)
+}
+
+func (m *MockClusterEC2) DescribeInstanceConnectEndpoints(input *ec2.DescribeInstanceConnectEndpointsInput) (*ec2.DescribeInstanceConnectEndpointsOutput, error) {
+	return nil, fmt.Errorf("unexpected DescribeInstanceConnectEndpoints call")
+}
+
+func (m *MockClusterEC2) DescribeInstanceStatus(input *ec2.DescribeInstanceStatusInput) (*ec2.DescribeInstanceStatusOutput, error) {
+	return nil, fmt.Errorf("unexpected DescribeInstanceStatus call")
+}
+
 func TestECSProvider(t *testing.T) {
 
 	type ecsTest struct {
-		Name        string
-		YamlPath    string
-		MockEC2     *MockEC2
-		MockECS     *MockECS
-		WantPrompts []*jump.Prompt
+		Name           string
+		YamlPath       string
+		MockEC2        *MockEC2
+		MockClusterEC2 *MockClusterEC2 // Instead of MockEC2, for queries of several clusters
+		MockECS        *MockECS
+		MockSSM        *MockSSM
+		WantPrompts    []*jump.Prompt
+		WantWarnings   []string
+	}
+
+	// Returns the Prompt of the app container of a task in the health test, without its id
+	healthPrompt := func(task, description string, annotations map[string]string) *jump.Prompt {
+		taskArn := "arn:aws:ecs:us-east-1:123456789012:task/" + task
+		annotations["startedAt"] = "2015-03-26 19:54:00 +0000 UTC"
+		annotations["desiredStatus"] = "RUNNING"
+		return &jump.Prompt{
+			Name:               "service:web/app",
+			Hostname:           "12345678.example.com",
+			JumpCommand:        "docker exec -it $(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=com.amazonaws.ecs.task-arn=" + taskArn + " -q | head -n1)",
+			PreDownloadCommand: "sh -c 'mkdir -p /tmp/cased-downloads; docker cp $(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=com.amazonaws.ecs.task-arn=" + taskArn + " -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'",
+			Kind:               "container",
+			Provider:           "ecs",
+			Description:        description,
+			Annotations:        annotations,
+		}
+	}
+	// Returns prompt with the given id
+	withID := func(id string, prompt *jump.Prompt) *jump.Prompt {
+		prompt.ID = id
+		return prompt
+	}
+	// The tasks of the health test, by container instance
+	healthTasks := map[string][]*ecs.Task{}
+	for _, task := range []struct {
+		id, containerInstance, desiredStatus, healthStatus string
+	}{
+		{"healthy-task", "active", "RUNNING", "HEALTHY"},
+		{"unhealthy-task", "active", "RUNNING", "UNHEALTHY"},
+		{"stopping-task", "active", "STOPPED", "HEALTHY"},
+		{"unknown-task", "active", "RUNNING", "UNKNOWN"},
+		{"draining-task", "draining", "RUNNING", "HEALTHY"},
+	} {
+		taskArn := "arn:aws:ecs:us-east-1:123456789012:task/" + task.id
+		containerInstanceArn := "arn:aws:ecs:us-east-1:123456789012:container-instance/" + task.containerInstance
+		healthTasks[containerInstanceArn] = append(healthTasks[containerInstanceArn], &ecs.Task{
+			LastStatus:           aws.String("RUNNING"),
+			DesiredStatus:        aws.String(task.desiredStatus),
+			HealthStatus:         aws.String(task.healthStatus),
+			TaskArn:              aws.String(taskArn),
+			ContainerInstanceArn: aws.String(containerInstanceArn),
+			Group:                aws.String("service:web"),
+			StartedAt: aws.Time(
+				time.Date(2015, time.March, 26, 19, 54, 0, 0, time.UTC),
+			),
+			Containers: []*ecs.Container{
+				{
+					Name:         aws.String("app"),
+					TaskArn:      aws.String(taskArn),
+					ContainerArn: aws.String(taskArn + "/app"),
+					HealthStatus: aws.String(task.healthStatus),
+				},
+			},
+		})
 	}
 
 	tests := []ecsTest{
@@ -97,13 +209,19 @@ func TestECSProvider(t *testing.T) {
 			YamlPath: "testdata/ecs_test_default.yml",
 			WantPrompts: jump.Prompts([]*jump.Prompt{
 				{
+					ID:                 "ecs-b17870dde61049b9",
 					Hostname:           "12345678.example.com",
 					Name:               "example-service/example-container-name",
-					JumpCommand:        "docker exec -it $(docker ps --filter \"label=com.amazonaws.ecs.container-name=example-container-name\" --filter \"label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/example-task-id\" -q | head -n1)",
-					PreDownloadCommand: "sh -c 'mkdir -p /tmp/cased-downloads; docker cp $(docker ps --filter \"label=com.amazonaws.ecs.container-name=example-container-name\" --filter \"label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/example-task-id\" -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'",
+					JumpCommand:        "docker exec -it $(docker ps --filter label=com.amazonaws.ecs.container-name=example-container-name --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/example-task-id -q | head -n1)",
+					PreDownloadCommand: "sh -c 'mkdir -p /tmp/cased-downloads; docker cp $(docker ps --filter label=com.amazonaws.ecs.container-name=example-container-name --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/example-task-id -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'",
 					Kind:               "container",
 					Provider:           "ecs",
 					Description:        "Default container debug shell",
+					Labels: map[string]string{
+						"vpc-id":            "vpc-1234",
+						"subnet-id":         "subnet-5678",
+						"availability-zone": "us-east-1a",
+					},
 					Annotations: map[string]string{
 						"startedAt": "2015-03-26 19:54:00 +0000 UTC",
 					}},
@@ -117,6 +235,11 @@ func TestECSProvider(t *testing.T) {
 									{
 										InstanceId:     aws.String("i-12345678"),
 										PrivateDnsName: aws.String("12345678.example.com"),
+										VpcId:          aws.String("vpc-1234"),
+										SubnetId:       aws.String("subnet-5678"),
+										Placement: &ec2.Placement{
+											AvailabilityZone: aws.String("us-east-1a"),
+										},
 										Tags: []*ec2.Tag{
 											{
 												Key:   aws.String("Name"),
@@ -205,9 +328,10 @@ func TestECSProvider(t *testing.T) {
 			YamlPath: "testdata/ecs_test_complex_filters.yml",
 			WantPrompts: jump.Prompts([]*jump.Prompt{
 				{
+					ID:                 "ecs-76bd18e32eb7c667",
 					Hostname:           "12345678.test-cluster.us-west-1.example.com",
-					JumpCommand:        "docker exec -it $(docker ps --filter \"label=com.amazonaws.ecs.container-name=test-container-name\" --filter \"label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/test-task-id\" -q | head -n1)",
-					PreDownloadCommand: "sh -c 'mkdir -p /tmp/cased-downloads; docker cp $(docker ps --filter \"label=com.amazonaws.ecs.container-name=test-container-name\" --filter \"label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/test-task-id\" -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'",
+					JumpCommand:        "docker exec -it $(docker ps --filter label=com.amazonaws.ecs.container-name=test-container-name --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/test-task-id -q | head -n1)",
+					PreDownloadCommand: "sh -c 'mkdir -p /tmp/cased-downloads; docker cp $(docker ps --filter label=com.amazonaws.ecs.container-name=test-container-name --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/test-task-id -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'",
 					ShellCommand:       "./bin/rails console",
 					Kind:               "container",
 					Provider:           "ecs",
@@ -224,9 +348,10 @@ func TestECSProvider(t *testing.T) {
 					},
 				},
 				{
+					ID:                 "ecs-75c35e0c5ecb961e",
 					Hostname:           "12345678.prod-cluster.us-west-2.example.com",
-					JumpCommand:        "docker exec -it $(docker ps --filter \"label=com.amazonaws.ecs.container-name=prod-container-name\" --filter \"label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/prod-task-id-2\" -q | head -n1)",
-					PreDownloadCommand: "sh -c 'mkdir -p /tmp/cased-downloads; docker cp $(docker ps --filter \"label=com.amazonaws.ecs.container-name=prod-container-name\" --filter \"label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/prod-task-id-2\" -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'",
+					JumpCommand:        "docker exec -it $(docker ps --filter label=com.amazonaws.ecs.container-name=prod-container-name --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/prod-task-id-2 -q | head -n1)",
+					PreDownloadCommand: "sh -c 'mkdir -p /tmp/cased-downloads; docker cp $(docker ps --filter label=com.amazonaws.ecs.container-name=prod-container-name --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/prod-task-id-2 -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'",
 					ShellCommand:       "./bin/rails console",
 					Kind:               "container",
 					Provider:           "ecs",
@@ -434,6 +559,725 @@ func TestECSProvider(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name:     "Docker labels",
+			YamlPath: "testdata/ecs_test_resource.yml",
+			WantPrompts: jump.Prompts([]*jump.Prompt{
+				{
+					ID:                 "ecs-96b00a4d819768a6",
+					Hostname:           "12345678.example.com",
+					Name:               "Rails console",
+					JumpCommand:        "docker exec -it $(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/example-task-id -q | head -n1)",
+					PreDownloadCommand: "sh -c 'mkdir -p /tmp/cased-downloads; docker cp $(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/example-task-id -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'",
+					Featured:           aws.Bool(true),
+					Kind:               "container",
+					Provider:           "ecs",
+					Description:        "Container debug shell",
+					Labels: map[string]string{
+						"team": "payments",
+					},
+					Annotations: map[string]string{
+						"startedAt": "2015-03-26 19:54:00 +0000 UTC",
+					},
+				},
+			}),
+			WantWarnings: []string{
+				`ignoring resource key jump:shellCommand: prompt field "shellCommand" can't be set by resources`,
+			},
+			MockEC2: &MockEC2{
+				DescribeInstancesFunc: func(query *jump.PromptQuery, input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+					return &ec2.DescribeInstancesOutput{
+						Reservations: []*ec2.Reservation{
+							{
+								Instances: []*ec2.Instance{
+									{
+										InstanceId:     aws.String("i-12345678"),
+										PrivateDnsName: aws.String("12345678.example.com"),
+									},
+								},
+							},
+						},
+					}, nil
+				},
+			},
+			MockECS: &MockECS{
+				ListTasksOutput: &ecs.ListTasksOutput{
+					TaskArns: []*string{
+						aws.String("arn:aws:ecs:us-east-1:123456789012:task/example-task-id"),
+					},
+				},
+				DescribeTasksOutput: &ecs.DescribeTasksOutput{
+					Tasks: []*ecs.Task{
+						{
+							LastStatus:           aws.String("RUNNING"),
+							TaskArn:              aws.String("arn:aws:ecs:us-east-1:123456789012:task/example-task-id"),
+							TaskDefinitionArn:    aws.String("arn:aws:ecs:us-east-1:123456789012:task-definition/example-task:1"),
+							ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/example-container-instance-id"),
+							Group:                aws.String("example-service"),
+							StartedAt: aws.Time(
+								time.Date(2015, time.March, 26, 19, 54, 0, 0, time.UTC),
+							),
+							Containers: []*ecs.Container{
+								{
+									Name:         aws.String("app"),
+									TaskArn:      aws.String("arn:aws:ecs:us-east-1:123456789012:task/example-task-id"),
+									ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/app-id"),
+								},
+								{
+									Name:         aws.String("log-router"),
+									TaskArn:      aws.String("arn:aws:ecs:us-east-1:123456789012:task/example-task-id"),
+									ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/log-router-id"),
+								},
+							},
+						},
+					},
+				},
+				TestDescribeTaskDefinitionInput: func(input *ecs.DescribeTaskDefinitionInput) {
+					if got := aws.StringValue(input.TaskDefinition); got != "arn:aws:ecs:us-east-1:123456789012:task-definition/example-task:1" {
+						t.Errorf("Got task definition %s", got)
+					}
+				},
+				DescribeTaskDefinitionOutput: &ecs.DescribeTaskDefinitionOutput{
+					TaskDefinition: &ecs.TaskDefinition{
+						ContainerDefinitions: []*ecs.ContainerDefinition{
+							{
+								Name: aws.String("app"),
+								DockerLabels: map[string]*string{
+									"jump:name":         aws.String("Rails console"),
+									"jump:shellCommand": aws.String("./bin/rails console"),
+									"jump:featured":     aws.String("true"),
+									"jump:labels.team":  aws.String("payments"),
+								},
+							},
+							{
+								Name: aws.String("log-router"),
+								DockerLabels: map[string]*string{
+									"jump:exclude": aws.String("true"),
+								},
+							},
+						},
+					},
+				},
+				ListContainerInstancesOutput: &ecs.ListContainerInstancesOutput{
+					ContainerInstanceArns: []*string{
+						aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/example-container-instance-id"),
+					},
+				},
+				DescribeContainerInstancesOutput: &ecs.DescribeContainerInstancesOutput{
+					ContainerInstances: []*ecs.ContainerInstance{
+						{
+							ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/example-container-instance-id"),
+							Ec2InstanceId:        aws.String("i-12345678"),
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:     "Mixed EC2 and external cluster",
+			YamlPath: "testdata/ecs_test_external.yml",
+			WantPrompts: jump.Prompts([]*jump.Prompt{
+				{
+					ID:                 "ecs-aa555b9b2fbaeaa5",
+					Name:               "service:web/app",
+					Hostname:           "12345678.example.com",
+					JumpCommand:        "docker exec -it $(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/ec2-task-id -q | head -n1)",
+					PreDownloadCommand: "sh -c 'mkdir -p /tmp/cased-downloads; docker cp $(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/ec2-task-id -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'",
+					Kind:               "container",
+					Provider:           "ecs",
+					Description:        "Container debug shell",
+					Labels: map[string]string{
+						"cluster": "hybrid-cluster",
+					},
+					Annotations: map[string]string{
+						"startedAt": "2015-03-26 19:54:00 +0000 UTC",
+					},
+				},
+				{
+					ID:                 "ecs-a6ec4e2d10f3858d",
+					Name:               "service:web/app",
+					Hostname:           "rack-01.example.internal",
+					IpAddress:          "192.168.1.10",
+					JumpCommand:        "docker exec -it $(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/external-task-id -q | head -n1)",
+					PreDownloadCommand: "sh -c 'mkdir -p /tmp/cased-downloads; docker cp $(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/external-task-id -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'",
+					Kind:               "container",
+					Provider:           "ecs",
+					Description:        "Container debug shell",
+					Labels: map[string]string{
+						"cluster": "hybrid-cluster",
+					},
+					Annotations: map[string]string{
+						"startedAt": "2015-03-26 19:54:00 +0000 UTC",
+					},
+				},
+			}),
+			WantWarnings: []string{
+				"skipping container instance arn:aws:ecs:us-east-1:123456789012:container-instance/unknown-id: it has no EC2 or managed instance id",
+			},
+			MockEC2: &MockEC2{
+				DescribeInstancesFunc: func(query *jump.PromptQuery, input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+					if got := aws.StringValue(input.Filters[0].Values[0]); got != "i-12345678" {
+						t.Errorf("Got instance %s, wanted i-12345678", got)
+					}
+					return &ec2.DescribeInstancesOutput{
+						Reservations: []*ec2.Reservation{
+							{
+								Instances: []*ec2.Instance{
+									{
+										InstanceId:     aws.String("i-12345678"),
+										PrivateDnsName: aws.String("12345678.example.com"),
+									},
+								},
+							},
+						},
+					}, nil
+				},
+			},
+			MockSSM: &MockSSM{
+				TestDescribeInstanceInformationInput: func(input *ssm.DescribeInstanceInformationInput) {
+					if got := aws.StringValue(input.Filters[0].Values[0]); got != "mi-0123456789abcdef0" {
+						t.Errorf("Got managed instance %s, wanted mi-0123456789abcdef0", got)
+					}
+				},
+				DescribeInstanceInformationOutputs: []*ssm.DescribeInstanceInformationOutput{
+					{
+						InstanceInformationList: []*ssm.InstanceInformation{
+							{
+								InstanceId:   aws.String("mi-0123456789abcdef0"),
+								ComputerName: aws.String("rack-01.example.internal"),
+								IPAddress:    aws.String("192.168.1.10"),
+							},
+						},
+					},
+				},
+			},
+			MockECS: &MockECS{
+				ListContainerInstancesOutput: &ecs.ListContainerInstancesOutput{
+					ContainerInstanceArns: []*string{
+						aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/ec2-id"),
+						aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/external-id"),
+						aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/unknown-id"),
+					},
+				},
+				ListTasksFunc: func(query *jump.PromptQuery, input *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
+					id := strings.TrimPrefix(aws.StringValue(input.ContainerInstance), "arn:aws:ecs:us-east-1:123456789012:container-instance/")
+					return &ecs.ListTasksOutput{
+						TaskArns: []*string{
+							aws.String(fmt.Sprintf("arn:aws:ecs:us-east-1:123456789012:task/%s", strings.Replace(id, "-id", "-task-id", 1))),
+						},
+					}, nil
+				},
+				DescribeTasksFunc: func(query *jump.PromptQuery, input *ecs.DescribeTasksInput) (*ecs.DescribeTasksOutput, error) {
+					taskArn := aws.StringValue(input.Tasks[0])
+					containerInstanceArn := strings.Replace(strings.Replace(taskArn, "task/", "container-instance/", 1), "-task-id", "-id", 1)
+					return &ecs.DescribeTasksOutput{
+						Tasks: []*ecs.Task{
+							{
+								LastStatus:           aws.String("RUNNING"),
+								TaskArn:              aws.String(taskArn),
+								ContainerInstanceArn: aws.String(containerInstanceArn),
+								Group:                aws.String("service:web"),
+								StartedAt: aws.Time(
+									time.Date(2015, time.March, 26, 19, 54, 0, 0, time.UTC),
+								),
+								Containers: []*ecs.Container{
+									{
+										Name:         aws.String("app"),
+										TaskArn:      aws.String(taskArn),
+										ContainerArn: aws.String(taskArn + "/app"),
+									},
+								},
+							},
+						},
+					}, nil
+				},
+				DescribeContainerInstancesFunc: func(query *jump.PromptQuery, input *ecs.DescribeContainerInstancesInput) (*ecs.DescribeContainerInstancesOutput, error) {
+					containerInstanceArn := aws.StringValue(input.ContainerInstances[0])
+					containerInstance := &ecs.ContainerInstance{
+						ContainerInstanceArn: aws.String(containerInstanceArn),
+					}
+					switch {
+					case strings.HasSuffix(containerInstanceArn, "/ec2-id"):
+						containerInstance.Ec2InstanceId = aws.String("i-12345678")
+					case strings.HasSuffix(containerInstanceArn, "/external-id"):
+						containerInstance.Ec2InstanceId = aws.String("mi-0123456789abcdef0")
+					}
+					return &ecs.DescribeContainerInstancesOutput{
+						ContainerInstances: []*ecs.ContainerInstance{containerInstance},
+					}, nil
+				},
+			},
+		},
+		{
+			Name:     "Every cluster matching a glob",
+			YamlPath: "testdata/ecs_test_clusters.yml",
+			WantPrompts: jump.Prompts([]*jump.Prompt{
+				{
+					ID:                 "ecs-3cee85610cd04a4a",
+					Name:               "service:web/app",
+					Hostname:           "prod-a.example.com",
+					JumpCommand:        "docker exec -it $(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/prod-a/task-id -q | head -n1)",
+					PreDownloadCommand: "sh -c 'mkdir -p /tmp/cased-downloads; docker cp $(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/prod-a/task-id -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'",
+					Kind:               "container",
+					Provider:           "ecs",
+					Description:        "Container debug shell",
+					Labels: map[string]string{
+						"cluster": "prod-a",
+					},
+					Annotations: map[string]string{
+						"startedAt": "2015-03-26 19:54:00 +0000 UTC",
+					},
+				},
+				{
+					ID:                 "ecs-9aafe783aeea7eaf",
+					Name:               "service:web/app",
+					Hostname:           "prod-b.example.com",
+					JumpCommand:        "docker exec -it $(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/prod-b/task-id -q | head -n1)",
+					PreDownloadCommand: "sh -c 'mkdir -p /tmp/cased-downloads; docker cp $(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/prod-b/task-id -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'",
+					Kind:               "container",
+					Provider:           "ecs",
+					Description:        "Container debug shell",
+					Labels: map[string]string{
+						"cluster": "prod-b",
+					},
+					Annotations: map[string]string{
+						"startedAt": "2015-03-26 19:54:00 +0000 UTC",
+					},
+				},
+			}),
+			WantWarnings: []string{
+				"skipping ecs cluster prod-c: AccessDeniedException: not authorized",
+			},
+			MockClusterEC2: &MockClusterEC2{
+				DescribeInstancesFunc: func(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+					cluster := strings.TrimPrefix(aws.StringValue(input.Filters[0].Values[0]), "i-")
+					return &ec2.DescribeInstancesOutput{
+						Reservations: []*ec2.Reservation{
+							{
+								Instances: []*ec2.Instance{
+									{
+										InstanceId:     input.Filters[0].Values[0],
+										PrivateDnsName: aws.String(cluster + ".example.com"),
+									},
+								},
+							},
+						},
+					}, nil
+				},
+			},
+			MockECS: &MockECS{
+				ListClustersFunc: func(query *jump.PromptQuery, input *ecs.ListClustersInput) (*ecs.ListClustersOutput, error) {
+					if input.NextToken == nil {
+						return &ecs.ListClustersOutput{
+							ClusterArns: []*string{
+								aws.String("arn:aws:ecs:us-east-1:123456789012:cluster/prod-a"),
+								aws.String("arn:aws:ecs:us-east-1:123456789012:cluster/staging"),
+							},
+							NextToken: aws.String("page-2"),
+						}, nil
+					}
+					return &ecs.ListClustersOutput{
+						ClusterArns: []*string{
+							aws.String("arn:aws:ecs:us-east-1:123456789012:cluster/prod-b"),
+							aws.String("arn:aws:ecs:us-east-1:123456789012:cluster/prod-c"),
+						},
+					}, nil
+				},
+				TestListContainerInstancesInput: func(input *ecs.ListContainerInstancesInput) {
+					if got := aws.StringValue(input.Cluster); !strings.HasPrefix(got, "prod-") {
+						t.Errorf("Got cluster %s, wanted prod-*", got)
+					}
+				},
+				ListContainerInstancesFunc: func(query *jump.PromptQuery, input *ecs.ListContainerInstancesInput) (*ecs.ListContainerInstancesOutput, error) {
+					if aws.StringValue(input.Cluster) == "prod-c" {
+						return nil, errors.New("AccessDeniedException: not authorized")
+					}
+					return &ecs.ListContainerInstancesOutput{
+						ContainerInstanceArns: []*string{
+							aws.String(fmt.Sprintf("arn:aws:ecs:us-east-1:123456789012:container-instance/%s/instance-id", aws.StringValue(input.Cluster))),
+						},
+					}, nil
+				},
+				ListTasksFunc: func(query *jump.PromptQuery, input *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
+					return &ecs.ListTasksOutput{
+						TaskArns: []*string{
+							aws.String(fmt.Sprintf("arn:aws:ecs:us-east-1:123456789012:task/%s/task-id", aws.StringValue(input.Cluster))),
+						},
+					}, nil
+				},
+				DescribeTasksFunc: func(query *jump.PromptQuery, input *ecs.DescribeTasksInput) (*ecs.DescribeTasksOutput, error) {
+					cluster := aws.StringValue(input.Cluster)
+					taskArn := aws.StringValue(input.Tasks[0])
+					return &ecs.DescribeTasksOutput{
+						Tasks: []*ecs.Task{
+							{
+								LastStatus:           aws.String("RUNNING"),
+								TaskArn:              aws.String(taskArn),
+								ContainerInstanceArn: aws.String(fmt.Sprintf("arn:aws:ecs:us-east-1:123456789012:container-instance/%s/instance-id", cluster)),
+								Group:                aws.String("service:web"),
+								StartedAt: aws.Time(
+									time.Date(2015, time.March, 26, 19, 54, 0, 0, time.UTC),
+								),
+								Containers: []*ecs.Container{
+									{
+										Name:         aws.String("app"),
+										TaskArn:      aws.String(taskArn),
+										ContainerArn: aws.String(taskArn + "/app"),
+									},
+								},
+							},
+						},
+					}, nil
+				},
+				DescribeContainerInstancesFunc: func(query *jump.PromptQuery, input *ecs.DescribeContainerInstancesInput) (*ecs.DescribeContainerInstancesOutput, error) {
+					return &ecs.DescribeContainerInstancesOutput{
+						ContainerInstances: []*ecs.ContainerInstance{
+							{
+								ContainerInstanceArn: input.ContainerInstances[0],
+								Ec2InstanceId:        aws.String("i-" + aws.StringValue(input.Cluster)),
+							},
+						},
+					}, nil
+				},
+			},
+		},
+		{
+			Name:     "Pattern filters",
+			YamlPath: "testdata/ecs_test_patterns.yml",
+			WantPrompts: jump.Prompts([]*jump.Prompt{
+				{
+					ID:                 "ecs-fc00af522732f2cb",
+					Name:               "service:api-blue/app",
+					Hostname:           "12345678.example.com",
+					JumpCommand:        "docker exec -it $(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/api-blue-task-id -q | head -n1)",
+					PreDownloadCommand: "sh -c 'mkdir -p /tmp/cased-downloads; docker cp $(docker ps --filter label=com.amazonaws.ecs.container-name=app --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/api-blue-task-id -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'",
+					Kind:               "container",
+					Provider:           "ecs",
+					Description:        "API shell",
+					Labels: map[string]string{
+						"service":                "api-blue",
+						"task-definition-family": "api",
+						"launch-type":            "EC2",
+						"container-name":         "app",
+					},
+					Annotations: map[string]string{
+						"startedAt": "2015-03-26 19:54:00 +0000 UTC",
+					},
+				},
+			}),
+			MockEC2: &MockEC2{
+				DescribeInstancesFunc: func(query *jump.PromptQuery, input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+					return &ec2.DescribeInstancesOutput{
+						Reservations: []*ec2.Reservation{
+							{
+								Instances: []*ec2.Instance{
+									{
+										InstanceId:     aws.String("i-12345678"),
+										PrivateDnsName: aws.String("12345678.example.com"),
+									},
+								},
+							},
+						},
+					}, nil
+				},
+			},
+			MockECS: &MockECS{
+				ListContainerInstancesOutput: &ecs.ListContainerInstancesOutput{
+					ContainerInstanceArns: []*string{
+						aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/example-container-instance-id"),
+					},
+				},
+				ListTasksOutput: &ecs.ListTasksOutput{
+					TaskArns: []*string{
+						aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-blue-task-id"),
+						aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-green-task-id"),
+						aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-cron-task-id"),
+						aws.String("arn:aws:ecs:us-east-1:123456789012:task/worker-task-id"),
+					},
+				},
+				TestDescribeTasksInput: func(input *ecs.DescribeTasksInput) {
+					if got := aws.StringValueSlice(input.Include); !reflect.DeepEqual(got, []string{"TAGS"}) {
+						t.Errorf("Got include %v, wanted [TAGS]", got)
+					}
+				},
+				DescribeTasksOutput: &ecs.DescribeTasksOutput{
+					Tasks: []*ecs.Task{
+						{
+							LastStatus:           aws.String("RUNNING"),
+							TaskArn:              aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-blue-task-id"),
+							TaskDefinitionArn:    aws.String("arn:aws:ecs:us-east-1:123456789012:task-definition/api:3"),
+							ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/example-container-instance-id"),
+							Group:                aws.String("service:api-blue"),
+							LaunchType:           aws.String("EC2"),
+							StartedAt: aws.Time(
+								time.Date(2015, time.March, 26, 19, 54, 0, 0, time.UTC),
+							),
+							Tags: []*ecs.Tag{
+								{Key: aws.String("env"), Value: aws.String("prod")},
+							},
+							Containers: []*ecs.Container{
+								{Name: aws.String("app"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-blue-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/api-blue-task-id/app")},
+								{Name: aws.String("envoy"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-blue-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/api-blue-task-id/envoy")},
+								{Name: aws.String("datadog-agent"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-blue-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/api-blue-task-id/datadog-agent")},
+								{Name: aws.String("migrate"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-blue-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/api-blue-task-id/migrate")},
+							},
+						},
+						{
+							LastStatus:           aws.String("RUNNING"),
+							TaskArn:              aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-green-task-id"),
+							TaskDefinitionArn:    aws.String("arn:aws:ecs:us-east-1:123456789012:task-definition/api:3"),
+							ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/example-container-instance-id"),
+							Group:                aws.String("service:api-green"),
+							LaunchType:           aws.String("EC2"),
+							StartedAt: aws.Time(
+								time.Date(2015, time.March, 26, 19, 54, 0, 0, time.UTC),
+							),
+							Tags: []*ecs.Tag{
+								{Key: aws.String("env"), Value: aws.String("staging")},
+							},
+							Containers: []*ecs.Container{
+								{Name: aws.String("app"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-green-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/api-green-task-id/app")},
+								{Name: aws.String("envoy"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-green-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/api-green-task-id/envoy")},
+								{Name: aws.String("datadog-agent"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-green-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/api-green-task-id/datadog-agent")},
+								{Name: aws.String("migrate"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-green-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/api-green-task-id/migrate")},
+							},
+						},
+						{
+							LastStatus:           aws.String("RUNNING"),
+							TaskArn:              aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-cron-task-id"),
+							TaskDefinitionArn:    aws.String("arn:aws:ecs:us-east-1:123456789012:task-definition/api:3"),
+							ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/example-container-instance-id"),
+							Group:                aws.String("family:api"),
+							LaunchType:           aws.String("EC2"),
+							StartedAt: aws.Time(
+								time.Date(2015, time.March, 26, 19, 54, 0, 0, time.UTC),
+							),
+							Tags: []*ecs.Tag{
+								{Key: aws.String("env"), Value: aws.String("prod")},
+							},
+							Containers: []*ecs.Container{
+								{Name: aws.String("app"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-cron-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/api-cron-task-id/app")},
+								{Name: aws.String("envoy"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-cron-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/api-cron-task-id/envoy")},
+								{Name: aws.String("datadog-agent"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-cron-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/api-cron-task-id/datadog-agent")},
+								{Name: aws.String("migrate"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/api-cron-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/api-cron-task-id/migrate")},
+							},
+						},
+						{
+							LastStatus:           aws.String("RUNNING"),
+							TaskArn:              aws.String("arn:aws:ecs:us-east-1:123456789012:task/worker-task-id"),
+							TaskDefinitionArn:    aws.String("arn:aws:ecs:us-east-1:123456789012:task-definition/worker:3"),
+							ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/example-container-instance-id"),
+							Group:                aws.String("service:api-worker"),
+							LaunchType:           aws.String("EC2"),
+							StartedAt: aws.Time(
+								time.Date(2015, time.March, 26, 19, 54, 0, 0, time.UTC),
+							),
+							Tags: []*ecs.Tag{
+								{Key: aws.String("env"), Value: aws.String("prod")},
+							},
+							Containers: []*ecs.Container{
+								{Name: aws.String("app"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/worker-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/worker-task-id/app")},
+								{Name: aws.String("envoy"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/worker-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/worker-task-id/envoy")},
+								{Name: aws.String("datadog-agent"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/worker-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/worker-task-id/datadog-agent")},
+								{Name: aws.String("migrate"), TaskArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task/worker-task-id"), ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/worker-task-id/migrate")},
+							},
+						},
+					},
+				},
+				DescribeTaskDefinitionOutput: &ecs.DescribeTaskDefinitionOutput{
+					TaskDefinition: &ecs.TaskDefinition{
+						ContainerDefinitions: []*ecs.ContainerDefinition{
+							{Name: aws.String("app")},
+							{Name: aws.String("envoy"), Essential: aws.Bool(true)},
+							{Name: aws.String("datadog-agent"), Essential: aws.Bool(false)},
+							{Name: aws.String("migrate"), Essential: aws.Bool(false)},
+						},
+					},
+				},
+				DescribeContainerInstancesOutput: &ecs.DescribeContainerInstancesOutput{
+					ContainerInstances: []*ecs.ContainerInstance{
+						{
+							ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/example-container-instance-id"),
+							Ec2InstanceId:        aws.String("i-12345678"),
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:     "Container runtimes",
+			YamlPath: "testdata/ecs_test_runtime.yml",
+			WantPrompts: jump.Prompts([]*jump.Prompt{
+				{
+					ID:                 "ecs-ae670c18f334a3fc",
+					Name:               "service:web/web \"app\" $HOME's",
+					Hostname:           "12345678.example.com",
+					JumpCommand:        "sudo nerdctl exec -it $(sudo nerdctl ps --filter 'label=com.amazonaws.ecs.container-name=web \"app\" $HOME'\\''s' --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/example-task-id -q | head -n1)",
+					PreDownloadCommand: "sh -c 'mkdir -p /tmp/cased-downloads; sudo nerdctl cp $(sudo nerdctl ps --filter '\\''label=com.amazonaws.ecs.container-name=web \"app\" $HOME'\\''\\'\\'''\\''s'\\'' --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/example-task-id -q | head -n1):{filepath} /tmp/cased-downloads/; echo /tmp/cased-downloads/{filename}'",
+					Kind:               "container",
+					Provider:           "ecs",
+					Description:        "Container debug shell",
+					Annotations: map[string]string{
+						"startedAt": "2015-03-26 19:54:00 +0000 UTC",
+					},
+				},
+				{
+					ID:                 "ecs-99f1a270e316f272",
+					Name:               "service:web/web \"app\" $HOME's",
+					Hostname:           "12345678.example.com",
+					JumpCommand:        "podman exec -it --user app $(podman ps --filter 'label=com.amazonaws.ecs.container-name=web \"app\" $HOME'\\''s' --filter label=com.amazonaws.ecs.task-arn=arn:aws:ecs:us-east-1:123456789012:task/example-task-id -q | head -n1) bash",
+					PreDownloadCommand: "fetch-file --task arn:aws:ecs:us-east-1:123456789012:task/example-task-id --container 'web \"app\" $HOME'\\''s' {filepath}",
+					Kind:               "container",
+					Provider:           "ecs",
+					Description:        "Custom runtime",
+					Annotations: map[string]string{
+						"startedAt": "2015-03-26 19:54:00 +0000 UTC",
+					},
+				},
+			}),
+			MockEC2: &MockEC2{
+				DescribeInstancesFunc: func(query *jump.PromptQuery, input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+					return &ec2.DescribeInstancesOutput{
+						Reservations: []*ec2.Reservation{
+							{
+								Instances: []*ec2.Instance{
+									{
+										InstanceId:     aws.String("i-12345678"),
+										PrivateDnsName: aws.String("12345678.example.com"),
+									},
+								},
+							},
+						},
+					}, nil
+				},
+			},
+			MockECS: &MockECS{
+				ListContainerInstancesOutput: &ecs.ListContainerInstancesOutput{
+					ContainerInstanceArns: []*string{
+						aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/example-container-instance-id"),
+					},
+				},
+				ListTasksOutput: &ecs.ListTasksOutput{
+					TaskArns: []*string{
+						aws.String("arn:aws:ecs:us-east-1:123456789012:task/example-task-id"),
+					},
+				},
+				DescribeTasksOutput: &ecs.DescribeTasksOutput{
+					Tasks: []*ecs.Task{
+						{
+							LastStatus:           aws.String("RUNNING"),
+							TaskArn:              aws.String("arn:aws:ecs:us-east-1:123456789012:task/example-task-id"),
+							ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/example-container-instance-id"),
+							Group:                aws.String("service:web"),
+							StartedAt: aws.Time(
+								time.Date(2015, time.March, 26, 19, 54, 0, 0, time.UTC),
+							),
+							Containers: []*ecs.Container{
+								{
+									Name:         aws.String("web \"app\" $HOME's"),
+									TaskArn:      aws.String("arn:aws:ecs:us-east-1:123456789012:task/example-task-id"),
+									ContainerArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container/web-id"),
+								},
+							},
+						},
+					},
+				},
+				DescribeContainerInstancesOutput: &ecs.DescribeContainerInstancesOutput{
+					ContainerInstances: []*ecs.ContainerInstance{
+						{
+							ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/example-container-instance-id"),
+							Ec2InstanceId:        aws.String("i-12345678"),
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:     "Health-aware discovery",
+			YamlPath: "testdata/ecs_test_health.yml",
+			WantPrompts: jump.Prompts([]*jump.Prompt{
+				withID("ecs-6cf70d294c748c89", healthPrompt("healthy-task", "Default", map[string]string{
+					"healthStatus":            "HEALTHY",
+					"containerHealthStatus":   "HEALTHY",
+					"containerInstanceStatus": "ACTIVE",
+				})),
+				withID("ecs-85ed7eeeab9cac21", healthPrompt("unknown-task", "Default", map[string]string{
+					"healthStatus":            "UNKNOWN",
+					"containerHealthStatus":   "UNKNOWN",
+					"containerInstanceStatus": "ACTIVE",
+				})),
+				withID("ecs-42e32519f55e3d6a", healthPrompt("healthy-task", "Healthy, including draining instances", map[string]string{
+					"healthStatus":            "HEALTHY",
+					"containerHealthStatus":   "HEALTHY",
+					"containerInstanceStatus": "ACTIVE",
+				})),
+				withID("ecs-9a8d399e85d24875", healthPrompt("draining-task", "Healthy, including draining instances", map[string]string{
+					"healthStatus":            "HEALTHY",
+					"containerHealthStatus":   "HEALTHY",
+					"containerInstanceStatus": "DRAINING",
+				})),
+			}),
+			MockEC2: &MockEC2{
+				DescribeInstancesFunc: func(query *jump.PromptQuery, input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+					return &ec2.DescribeInstancesOutput{
+						Reservations: []*ec2.Reservation{
+							{
+								Instances: []*ec2.Instance{
+									{
+										InstanceId:     aws.String("i-12345678"),
+										PrivateDnsName: aws.String("12345678.example.com"),
+									},
+								},
+							},
+						},
+					}, nil
+				},
+			},
+			MockECS: &MockECS{
+				ListContainerInstancesOutput: &ecs.ListContainerInstancesOutput{
+					ContainerInstanceArns: []*string{
+						aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/active"),
+						aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/draining"),
+					},
+				},
+				ListTasksFunc: func(query *jump.PromptQuery, input *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
+					output := &ecs.ListTasksOutput{}
+					for _, task := range healthTasks[aws.StringValue(input.ContainerInstance)] {
+						output.TaskArns = append(output.TaskArns, task.TaskArn)
+					}
+					return output, nil
+				},
+				DescribeTasksFunc: func(query *jump.PromptQuery, input *ecs.DescribeTasksInput) (*ecs.DescribeTasksOutput, error) {
+					output := &ecs.DescribeTasksOutput{}
+					for _, tasks := range healthTasks {
+						for _, task := range tasks {
+							for _, taskArn := range input.Tasks {
+								if *taskArn == *task.TaskArn {
+									output.Tasks = append(output.Tasks, task)
+								}
+							}
+						}
+					}
+					return output, nil
+				},
+				DescribeContainerInstancesFunc: func(query *jump.PromptQuery, input *ecs.DescribeContainerInstancesInput) (*ecs.DescribeContainerInstancesOutput, error) {
+					containerInstanceArn := aws.StringValue(input.ContainerInstances[0])
+					status := "ACTIVE"
+					if strings.HasSuffix(containerInstanceArn, "/draining") {
+						status = "DRAINING"
+					}
+					return &ecs.DescribeContainerInstancesOutput{
+						ContainerInstances: []*ecs.ContainerInstance{
+							{
+								ContainerInstanceArn: aws.String(containerInstanceArn),
+								Ec2InstanceId:        aws.String("i-12345678"),
+								Status:               aws.String(status),
+							},
+						},
+					}, nil
+				},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -449,10 +1293,17 @@ func TestECSProvider(t *testing.T) {
 			if err != nil {
 				t.Error(err)
 			}
-			test.MockEC2.Queries = c.Queries
-			provider.EC2Interface = test.MockEC2
+			if test.MockClusterEC2 != nil {
+				provider.EC2Interface = test.MockClusterEC2
+			} else {
+				test.MockEC2.Queries = c.Queries
+				provider.EC2Interface = test.MockEC2
+			}
 			test.MockECS.Queries = c.Queries
 			provider.ECSInterface = test.MockECS
+			if test.MockSSM != nil {
+				provider.SSMInterface = test.MockSSM
+			}
 			provider.STSInterface = &aws_provider.MockSTS{}
 			got, err := provider.Discover(c.Queries)
 			if err != nil {
@@ -468,7 +1319,29 @@ func TestECSProvider(t *testing.T) {
 					t.Error(pretty.Compare(got[i], test.WantPrompts[i]))
 				}
 			}
+			if warnings := c.Queries[0].Warnings(); !reflect.DeepEqual(warnings, test.WantWarnings) {
+				t.Errorf("Got warnings %v, wanted %v", warnings, test.WantWarnings)
+			}
 		})
 	}
 
 }
+
+func TestECSProviderInvalidFilters(t *testing.T) {
+	provider := &aws_provider.ECS{ECSInterface: &MockECS{}, STSInterface: &aws_provider.MockSTS{}}
+	for config, want := range map[string]string{
+		"filters:\n  container-name: /(/":  "filter container-name: error parsing regexp",
+		"filters:\n  task-group: '[a-'":    "filter task-group: \"[a-\": syntax error in pattern",
+		"filters:\n  essential: sometimes": "filter essential must be true or false, got \"sometimes\"",
+		"options:\n  runtime: crictl":      "option runtime must be one of docker, sudo docker, nerdctl, sudo nerdctl, podman, sudo podman, got \"crictl\"",
+	} {
+		query := &jump.PromptQuery{}
+		if err := yaml.Unmarshal([]byte("provider: ecs\n"+config), query); err != nil {
+			t.Fatal(err)
+		}
+		_, err := provider.Query(query)
+		if err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("%s: got error %v, wanted %s", config, err, want)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package aws
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eks"
+	jump "github.com/cased/jump/types/v1alpha"
+)
+
+// The EKS auto-discovery Provider queries EKS clusters for running pods and constructs the `kubectl exec` arguments
+// necessary to run a command inside their containers.
+//
+// Clusters are listed with the EKS API, and pods with the Kubernetes API of each cluster, authenticated with a token
+// derived from the same AWS credentials, like `aws eks get-token`. The credentials must be mapped to a Kubernetes
+// user or group that can list pods.
+//
+// The ConnectCommand of each Prompt runs `aws eks update-kubeconfig` and `kubectl exec` to open a shell in the
+// container. The Cased Shell host runs it itself with its own credentials, instead of connecting to the pod's node over
+// SSH, so it needs the AWS CLI, kubectl and permission to exec into pods. The Prompt's Hostname is the pod's name and is
+// only displayed, and a ShellCommand set in the query's Prompt runs in the container's shell.
+//
+// # Filters
+//
+// The EKS Provider accepts the following filters:
+//
+// - region: The AWS region to query. Defaults to the current region.
+// - cluster: The name of an EKS cluster. Defaults to every cluster in the region, skipping with a warning any cluster
+// that can't be queried, unless they all fail.
+// - namespace: The Kubernetes namespace of pods. Defaults to every namespace.
+// - label-selector: A Kubernetes label selector pods must match, e.g. `app=web,tier!=canary`.
+// - container: The name of a container.
+//
+// # Sorting
+//
+// The EKS Provider does not sort natively. Queries are sorted and limited by jump.
+//
+// # Ids
+//
+// Prompt ids are derived from the cluster ARN, namespace, pod and container name, so a replaced pod gets a new id.
+//
+// # Labels
+//
+// The EKS Provider labels each Prompt with:
+//
+// - cluster: The name of the EKS cluster.
+// - namespace: The namespace of the pod.
+// - pod: The name of the pod.
+// - node: The name of the node the pod runs on.
+// - vpc-id: The id of the VPC the cluster runs in, when known.
+//
+// The values of the region and container filters are also added as labels.
+//
+// # Annotations
+//
+// The EKS Provider appends the following annotations to each Prompt:
+//
+// - startedAt: The time the pod was started.
+type EKS struct {
+	EKSInterface        EKSInterface
+	KubernetesInterface KubernetesInterface
+	STSInterface        STSInterface
+}
+
+type EKSProviderConfig struct {
+	EKSInterface        EKSInterface
+	KubernetesInterface KubernetesInterface
+	STSInterface        STSInterface
+}
+
+func (provider *EKS) Initialize(providerConfig interface{}) {
+	if providerConfig != nil {
+		typedConfig := providerConfig.(EKSProviderConfig)
+		provider.EKSInterface = typedConfig.EKSInterface
+		provider.KubernetesInterface = typedConfig.KubernetesInterface
+		provider.STSInterface = typedConfig.STSInterface
+	}
+}
+
+func (provider *EKS) Describe() *jump.ProviderSchema {
+	return &jump.ProviderSchema{
+		Description: "Queries EKS clusters for running pods and constructs the `kubectl exec` arguments necessary to run a command inside their containers.",
+		Filters: []jump.SchemaKey{
+			{Name: "region", Description: "The AWS region to query. Defaults to the current region."},
+			{Name: "cluster", Description: "The name of an EKS cluster. Defaults to every cluster in the region."},
+			{Name: "namespace", Description: "The Kubernetes namespace of pods. Defaults to every namespace."},
+			{Name: "label-selector", Description: "A Kubernetes label selector pods must match."},
+			{Name: "container", Description: "The name of a container."},
+		},
+		Labels: []jump.SchemaKey{
+			{Name: "cluster", Description: "The name of the EKS cluster."},
+			{Name: "namespace", Description: "The namespace of the pod."},
+			{Name: "pod", Description: "The name of the pod."},
+			{Name: "node", Description: "The name of the node the pod runs on."},
+			{Name: "vpc-id", Description: "The id of the VPC the cluster runs in."},
+		},
+		Annotations: []jump.SchemaKey{
+			{Name: "startedAt", Description: "The time the pod was started."},
+		},
+	}
+}
+
+func (provider *EKS) Discover(queries []*jump.PromptQuery) ([]*jump.Prompt, error) {
+	return discoverEach(queries, provider.Query)
+}
+
+func (provider *EKS) Query(query *jump.PromptQuery) ([]*jump.Prompt, error) {
+
+	regionSession, err := GetAWSSession(query.Filters["region"])
+	if err != nil {
+		return nil, err
+	}
+	region := query.Filters["region"]
+	if region == "" {
+		region = aws.StringValue(regionSession.Config.Region)
+	}
+
+	provider = provider.forRegion(regionSession)
+
+	clusterNames, err := provider.listClusters(query.Filters["cluster"])
+	if err != nil {
+		return nil, err
+	}
+
+	// A cluster named by the query fails it. Other clusters are skipped with a warning, unless they all fail, so one
+	// cluster the credentials can't read doesn't hide the others.
+	var prompts []*jump.Prompt
+	var skipped []string
+	var lastErr error
+	for _, clusterName := range clusterNames {
+		clusterPrompts, err := provider.queryCluster(query, clusterName, region)
+		if err != nil {
+			if query.Filters["cluster"] != "" {
+				return nil, err
+			}
+			skipped = append(skipped, fmt.Sprintf("skipping eks cluster %s: %s", clusterName, err))
+			lastErr = fmt.Errorf("eks cluster %s: %w", clusterName, err)
+			continue
+		}
+		prompts = append(prompts, clusterPrompts...)
+	}
+	if len(skipped) > 0 && len(skipped) == len(clusterNames) {
+		return nil, lastErr
+	}
+	for _, warning := range skipped {
+		query.Warn("%s", warning)
+	}
+
+	if limit := query.ProviderLimit(); limit != 0 && len(prompts) > limit {
+		prompts = prompts[:limit]
+	}
+
+	return prompts, nil
+}
+
+// Returns a copy of the provider that uses the clients of a region, unless they were set with Initialize.
+func (provider *EKS) forRegion(regionSession *session.Session) *EKS {
+	regional := *provider
+	// AWS EKS endpoints
+	if regional.EKSInterface == nil {
+		regional.EKSInterface = NewEKSInterface(regionSession)
+	}
+	// Kubernetes API endpoints of each cluster
+	if regional.KubernetesInterface == nil {
+		regional.KubernetesInterface = NewKubernetesInterface(regionSession)
+	}
+	return &regional
+}
+
+// Returns the Prompts of the containers running in one cluster, or none if the cluster isn't active.
+func (provider *EKS) queryCluster(query *jump.PromptQuery, clusterName, region string) ([]*jump.Prompt, error) {
+	output, err := provider.EKSInterface.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String(clusterName)})
+	if err != nil {
+		return nil, err
+	}
+	cluster := output.Cluster
+	if cluster == nil || aws.StringValue(cluster.Status) != eks.ClusterStatusActive {
+		return nil, nil
+	}
+
+	pods, err := provider.KubernetesInterface.ListPods(cluster, query.Filters["namespace"], query.Filters["label-selector"])
+	if err != nil {
+		return nil, err
+	}
+	var prompts []*jump.Prompt
+	for _, pod := range pods {
+		for _, container := range pod.Containers {
+			if query.Filters["container"] != "" && container != query.Filters["container"] {
+				continue
+			}
+			prompts = append(prompts, provider.decoratePromptWithQuery(eksPrompt(query, cluster, pod, container, region), query))
+		}
+	}
+	return prompts, nil
+}
+
+// Returns the names of the clusters to query: the named cluster, or every cluster in the region.
+func (provider *EKS) listClusters(name string) ([]string, error) {
+	if name != "" {
+		return []string{name}, nil
+	}
+	var names []string
+	input := &eks.ListClustersInput{}
+	for {
+		output, err := provider.EKSInterface.ListClusters(input)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, aws.StringValueSlice(output.Clusters)...)
+		if aws.StringValue(output.NextToken) == "" {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+	return names, nil
+}
+
+// Returns the Prompt for a container in a pod, before decoration.
+func eksPrompt(query *jump.PromptQuery, cluster *eks.Cluster, pod *KubernetesPod, container, region string) *jump.Prompt {
+	clusterName := aws.StringValue(cluster.Name)
+	labels := map[string]string{
+		"cluster":   clusterName,
+		"namespace": pod.Namespace,
+		"pod":       pod.Name,
+		"node":      pod.NodeName,
+	}
+	if cluster.ResourcesVpcConfig != nil && cluster.ResourcesVpcConfig.VpcId != nil {
+		labels["vpc-id"] = *cluster.ResourcesVpcConfig.VpcId
+	}
+	annotations := map[string]string{}
+	if pod.StartTime != nil {
+		annotations["startedAt"] = pod.StartTime.UTC().Format(time.RFC3339)
+	}
+
+	updateKubeconfig := fmt.Sprintf("aws eks update-kubeconfig --name %s --alias %s", shellQuote(clusterName), shellQuote(clusterName))
+	if region != "" {
+		updateKubeconfig += " --region " + shellQuote(region)
+	}
+	return &jump.Prompt{
+		ID:             jump.PromptID("eks", query, aws.StringValue(cluster.Arn), pod.Namespace, pod.Name, container),
+		Kind:           "container",
+		Name:           fmt.Sprintf("%s/%s/%s", clusterName, pod.Name, container),
+		Hostname:       pod.Name,
+		ConnectCommand: fmt.Sprintf("%s >/dev/null && kubectl exec -it --context %s -n %s %s -c %s -- sh", updateKubeconfig, shellQuote(clusterName), shellQuote(pod.Namespace), shellQuote(pod.Name), shellQuote(container)),
+		Labels:         labels,
+		Annotations:    annotations,
+	}
+}
+
+func (provider *EKS) decoratePromptWithQuery(prompt *jump.Prompt, query *jump.PromptQuery) *jump.Prompt {
+	decoratedPrompt := prompt.DecorateWithQuery(query)
+	for _, filterKey := range []string{"region", "container"} {
+		if query.Filters[filterKey] != "" {
+			if decoratedPrompt.Labels == nil {
+				decoratedPrompt.Labels = map[string]string{}
+			}
+			decoratedPrompt.Labels[filterKey] = query.Filters[filterKey]
+		}
+	}
+	decoratedPrompt.Provider = "eks"
+	return decoratedPrompt
+}
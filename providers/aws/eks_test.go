@@ -0,0 +1,231 @@
+package aws_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eks"
+	aws_provider "github.com/cased/jump/providers/aws"
+	jump "github.com/cased/jump/types/v1alpha"
+	"github.com/kylelemons/godebug/pretty"
+	"gopkg.in/yaml.v2"
+)
+
+type MockEKS struct {
+	ListClustersOutputs []*eks.ListClustersOutput
+	Clusters            map[string]*eks.Cluster
+}
+
+func (m *MockEKS) ListClusters(input *eks.ListClustersInput) (*eks.ListClustersOutput, error) {
+	var output *eks.ListClustersOutput
+	output, m.ListClustersOutputs = m.ListClustersOutputs[0], m.ListClustersOutputs[1:]
+	return output, nil
+}
+
+func (m *MockEKS) DescribeCluster(input *eks.DescribeClusterInput) (*eks.DescribeClusterOutput, error) {
+	return &eks.DescribeClusterOutput{Cluster: m.Clusters[*input.Name]}, nil
+}
+
+type MockKubernetes struct {
+	TestListPods func(cluster *eks.Cluster, namespace, labelSelector string)
+	Pods         map[string][]*aws_provider.KubernetesPod
+	Errors       map[string]error
+}
+
+func (m *MockKubernetes) ListPods(cluster *eks.Cluster, namespace, labelSelector string) ([]*aws_provider.KubernetesPod, error) {
+	if m.TestListPods != nil {
+		m.TestListPods(cluster, namespace, labelSelector)
+	}
+	return m.Pods[*cluster.Name], m.Errors[*cluster.Name]
+}
+
+func TestEKSProvider(t *testing.T) {
+	startTime := time.Date(2023, time.March, 26, 19, 54, 0, 0, time.UTC)
+	mockEKS := &MockEKS{
+		ListClustersOutputs: []*eks.ListClustersOutput{
+			{Clusters: []*string{aws.String("prod")}, NextToken: aws.String("page-2")},
+			{Clusters: []*string{aws.String("staging"), aws.String("creating"), aws.String("restricted")}},
+		},
+		Clusters: map[string]*eks.Cluster{
+			"prod": {
+				Name:               aws.String("prod"),
+				Arn:                aws.String("arn:aws:eks:us-notexist-1:123456789012:cluster/prod"),
+				Status:             aws.String("ACTIVE"),
+				ResourcesVpcConfig: &eks.VpcConfigResponse{VpcId: aws.String("vpc-1234")},
+			},
+			"staging": {
+				Name:   aws.String("staging"),
+				Arn:    aws.String("arn:aws:eks:us-notexist-1:123456789012:cluster/staging"),
+				Status: aws.String("ACTIVE"),
+			},
+			"creating": {
+				Name:   aws.String("creating"),
+				Arn:    aws.String("arn:aws:eks:us-notexist-1:123456789012:cluster/creating"),
+				Status: aws.String("CREATING"),
+			},
+			"restricted": {
+				Name:   aws.String("restricted"),
+				Arn:    aws.String("arn:aws:eks:us-notexist-1:123456789012:cluster/restricted"),
+				Status: aws.String("ACTIVE"),
+			},
+		},
+	}
+	mockKubernetes := &MockKubernetes{
+		TestListPods: func(cluster *eks.Cluster, namespace, labelSelector string) {
+			if *cluster.Name == "creating" {
+				t.Errorf("Expected inactive clusters not to be queried")
+			}
+			if namespace != "web" || labelSelector != "app=rails" {
+				t.Errorf("Got namespace %q and label selector %q", namespace, labelSelector)
+			}
+		},
+		Pods: map[string][]*aws_provider.KubernetesPod{
+			"prod": {
+				{
+					Name:       "rails-7d9f-abcde",
+					Namespace:  "web",
+					NodeName:   "ip-10-0-1-2.ec2.internal",
+					Containers: []string{"app", "log-router"},
+					StartTime:  &startTime,
+				},
+			},
+			"staging": {
+				{
+					Name:       "rails-5c8e-fghij",
+					Namespace:  "web",
+					NodeName:   "ip-10-1-1-2.ec2.internal",
+					Containers: []string{"app"},
+				},
+			},
+		},
+		// A cluster the credentials can't list pods in is skipped with a warning
+		Errors: map[string]error{
+			"restricted": errors.New("Unauthorized"),
+		},
+	}
+
+	c := &jump.AutoDiscoveryConfig{}
+	configFile, err := ioutil.ReadFile("testdata/eks_test.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(configFile, c); err != nil {
+		t.Fatal(err)
+	}
+	provider := &aws_provider.EKS{}
+	provider.Initialize(aws_provider.EKSProviderConfig{
+		EKSInterface:        mockEKS,
+		KubernetesInterface: mockKubernetes,
+		STSInterface:        &aws_provider.MockSTS{},
+	})
+	got, err := provider.Discover(c.Queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := jump.Prompts([]*jump.Prompt{
+		{
+			ID:             "eks-cdf33d6ef65f297d",
+			Name:           "prod/rails-7d9f-abcde/app",
+			Hostname:       "rails-7d9f-abcde",
+			ConnectCommand: "aws eks update-kubeconfig --name prod --alias prod --region us-notexist-1 >/dev/null && kubectl exec -it --context prod -n web rails-7d9f-abcde -c app -- sh",
+			ShellCommand:   "./bin/rails console",
+			Kind:           "container",
+			Provider:       "eks",
+			Labels: map[string]string{
+				"cluster":   "prod",
+				"namespace": "web",
+				"pod":       "rails-7d9f-abcde",
+				"node":      "ip-10-0-1-2.ec2.internal",
+				"vpc-id":    "vpc-1234",
+				"container": "app",
+			},
+			Annotations: map[string]string{
+				"startedAt": "2023-03-26T19:54:00Z",
+			},
+		},
+		{
+			ID:             "eks-5fbc6826147abb1f",
+			Name:           "staging/rails-5c8e-fghij/app",
+			Hostname:       "rails-5c8e-fghij",
+			ConnectCommand: "aws eks update-kubeconfig --name staging --alias staging --region us-notexist-1 >/dev/null && kubectl exec -it --context staging -n web rails-5c8e-fghij -c app -- sh",
+			ShellCommand:   "./bin/rails console",
+			Kind:           "container",
+			Provider:       "eks",
+			Labels: map[string]string{
+				"cluster":   "staging",
+				"namespace": "web",
+				"pod":       "rails-5c8e-fghij",
+				"node":      "ip-10-1-1-2.ec2.internal",
+				"container": "app",
+			},
+			Annotations: map[string]string{},
+		},
+	})
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("unexpected prompts:\n%s", diff)
+	}
+	wantWarnings := []string{"skipping eks cluster restricted: Unauthorized"}
+	if warnings := c.Queries[0].Warnings(); !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("Got warnings %v, wanted %v", warnings, wantWarnings)
+	}
+}
+
+func TestEKSProviderRegions(t *testing.T) {
+	// Each region has one cluster, with one pod
+	eksClients := map[string]*MockEKS{}
+	kubernetesClients := map[string]*MockKubernetes{}
+	for _, region := range []string{"us-east-1", "us-west-2"} {
+		name := "cluster-" + region
+		eksClients[region] = &MockEKS{
+			ListClustersOutputs: []*eks.ListClustersOutput{{Clusters: []*string{aws.String(name)}}},
+			Clusters: map[string]*eks.Cluster{
+				name: {
+					Name:   aws.String(name),
+					Arn:    aws.String("arn:aws:eks:" + region + ":123456789012:cluster/" + name),
+					Status: aws.String("ACTIVE"),
+				},
+			},
+		}
+		kubernetesClients[region] = &MockKubernetes{
+			Pods: map[string][]*aws_provider.KubernetesPod{
+				name: {{Name: "web", Namespace: "default", NodeName: "node", Containers: []string{"app"}}},
+			},
+		}
+	}
+	newEKS, newKubernetes := aws_provider.NewEKSInterface, aws_provider.NewKubernetesInterface
+	defer func() { aws_provider.NewEKSInterface, aws_provider.NewKubernetesInterface = newEKS, newKubernetes }()
+	aws_provider.NewEKSInterface = func(regionSession *session.Session) aws_provider.EKSInterface {
+		return eksClients[*regionSession.Config.Region]
+	}
+	aws_provider.NewKubernetesInterface = func(regionSession *session.Session) aws_provider.KubernetesInterface {
+		return kubernetesClients[*regionSession.Config.Region]
+	}
+
+	c := &jump.AutoDiscoveryConfig{}
+	configFile, err := ioutil.ReadFile("testdata/eks_test_regions.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(configFile, c); err != nil {
+		t.Fatal(err)
+	}
+	provider := &aws_provider.EKS{}
+	provider.Initialize(aws_provider.EKSProviderConfig{STSInterface: &aws_provider.MockSTS{}})
+	got, err := provider.Discover(c.Queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var clusters []string
+	for _, p := range got {
+		clusters = append(clusters, p.Labels["cluster"])
+	}
+	if want := []string{"cluster-us-east-1", "cluster-us-west-2"}; !reflect.DeepEqual(clusters, want) {
+		t.Errorf("Got prompts of clusters %v, wanted %v", clusters, want)
+	}
+}
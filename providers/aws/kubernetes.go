@@ -0,0 +1,158 @@
+package aws
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// A running Kubernetes pod, as read by the EKS Provider.
+type KubernetesPod struct {
+	Name       string
+	Namespace  string
+	Labels     map[string]string
+	NodeName   string
+	Containers []string
+	StartTime  *time.Time
+}
+
+// The subset of a Kubernetes pod list read by the EKS Provider.
+type kubernetesPodList struct {
+	Metadata struct {
+		Continue string `json:"continue"`
+	} `json:"metadata"`
+	Items []struct {
+		Metadata struct {
+			Name      string            `json:"name"`
+			Namespace string            `json:"namespace"`
+			Labels    map[string]string `json:"labels"`
+		} `json:"metadata"`
+		Spec struct {
+			NodeName   string `json:"nodeName"`
+			Containers []struct {
+				Name string `json:"name"`
+			} `json:"containers"`
+		} `json:"spec"`
+		Status struct {
+			StartTime *time.Time `json:"startTime"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// Lists the running pods of an EKS cluster, in one namespace or, if namespace is empty, all namespaces.
+// labelSelector is a Kubernetes label selector, like `app=web,tier!=canary`.
+type KubernetesInterface interface {
+	ListPods(cluster *eks.Cluster, namespace, labelSelector string) ([]*KubernetesPod, error)
+}
+
+// Lists pods with the Kubernetes API of EKS clusters, authenticating with a token derived from the credentials of
+// session, like `aws eks get-token`.
+type eksKubernetesClient struct {
+	session *session.Session
+}
+
+// The lifetime of the presigned request used as a token. EKS accepts tokens for up to 15 minutes.
+const eksTokenExpiry = 60 * time.Second
+
+// Returns a bearer token for the Kubernetes API of the named EKS cluster.
+func (client *eksKubernetesClient) token(clusterName string) (string, error) {
+	request, _ := sts.New(client.session).GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	request.HTTPRequest.Header.Add("x-k8s-aws-id", clusterName)
+	presigned, err := request.Presign(eksTokenExpiry)
+	if err != nil {
+		return "", err
+	}
+	return "k8s-aws-v1." + base64.RawURLEncoding.EncodeToString([]byte(presigned)), nil
+}
+
+func (client *eksKubernetesClient) ListPods(cluster *eks.Cluster, namespace, labelSelector string) ([]*KubernetesPod, error) {
+	name := aws.StringValue(cluster.Name)
+	token, err := client.token(name)
+	if err != nil {
+		return nil, fmt.Errorf("eks cluster %s: %w", name, err)
+	}
+	if cluster.CertificateAuthority == nil || cluster.CertificateAuthority.Data == nil {
+		return nil, fmt.Errorf("eks cluster %s: no certificate authority", name)
+	}
+	pem, err := base64.StdEncoding.DecodeString(*cluster.CertificateAuthority.Data)
+	if err != nil {
+		return nil, fmt.Errorf("eks cluster %s: certificate authority: %w", name, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("eks cluster %s: certificate authority: no certificates", name)
+	}
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}
+
+	path := "/api/v1/pods"
+	if namespace != "" {
+		path = "/api/v1/namespaces/" + url.PathEscape(namespace) + "/pods"
+	}
+	query := url.Values{}
+	query.Set("fieldSelector", "status.phase=Running")
+	query.Set("limit", "500")
+	if labelSelector != "" {
+		query.Set("labelSelector", labelSelector)
+	}
+
+	var pods []*KubernetesPod
+	for {
+		request, err := http.NewRequest("GET", strings.TrimSuffix(aws.StringValue(cluster.Endpoint), "/")+path+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+		request.Header.Set("Accept", "application/json")
+		response, err := httpClient.Do(request)
+		if err != nil {
+			return nil, fmt.Errorf("eks cluster %s: %w", name, err)
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("eks cluster %s: %w", name, err)
+		}
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("eks cluster %s: listing pods: %s: %s", name, response.Status, strings.TrimSpace(string(body)))
+		}
+		list := &kubernetesPodList{}
+		if err := json.Unmarshal(body, list); err != nil {
+			return nil, fmt.Errorf("eks cluster %s: listing pods: %w", name, err)
+		}
+		for _, item := range list.Items {
+			pod := &KubernetesPod{
+				Name:      item.Metadata.Name,
+				Namespace: item.Metadata.Namespace,
+				Labels:    item.Metadata.Labels,
+				NodeName:  item.Spec.NodeName,
+				StartTime: item.Status.StartTime,
+			}
+			for _, container := range item.Spec.Containers {
+				pod.Containers = append(pod.Containers, container.Name)
+			}
+			pods = append(pods, pod)
+		}
+		if list.Metadata.Continue == "" {
+			break
+		}
+		query.Set("continue", list.Metadata.Continue)
+	}
+	return pods, nil
+}
@@ -0,0 +1,58 @@
+package aws
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// A filter value matched against resource names. A value is a glob, like `service:api-*`, or a regular expression
+// between slashes, like `/^(envoy|datadog-agent)$/`, and is negated by a leading `!`. A value without any of these is
+// matched exactly.
+type filterPattern struct {
+	negated bool
+	glob    string
+	regexp  *regexp.Regexp
+}
+
+// Parses a filter value. Returns an error naming the filter if the glob or regular expression is invalid.
+func parseFilterPattern(key, value string) (*filterPattern, error) {
+	pattern := &filterPattern{}
+	if strings.HasPrefix(value, "!") {
+		pattern.negated = true
+		value = value[1:]
+	}
+	if len(value) >= 2 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/") {
+		re, err := regexp.Compile(value[1 : len(value)-1])
+		if err != nil {
+			return nil, fmt.Errorf("filter %s: %w", key, err)
+		}
+		pattern.regexp = re
+		return pattern, nil
+	}
+	if _, err := path.Match(value, ""); err != nil {
+		return nil, fmt.Errorf("filter %s: %q: %w", key, value, err)
+	}
+	pattern.glob = value
+	return pattern, nil
+}
+
+// Reports whether value is more than a plain name: a glob, a regular expression or a negation.
+func isFilterPattern(value string) bool {
+	return strings.ContainsAny(value, "*?[") || strings.HasPrefix(value, "!") || strings.HasPrefix(value, "/")
+}
+
+// Reports whether s matches the pattern. A nil pattern matches everything.
+func (pattern *filterPattern) Match(s string) bool {
+	if pattern == nil {
+		return true
+	}
+	var matched bool
+	if pattern.regexp != nil {
+		matched = pattern.regexp.MatchString(s)
+	} else {
+		matched, _ = path.Match(pattern.glob, s)
+	}
+	return matched != pattern.negated
+}
@@ -0,0 +1,405 @@
+package aws
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/rds"
+	jump "github.com/cased/jump/types/v1alpha"
+)
+
+// The RDS auto-discovery Provider queries AWS for available RDS DB instances and Aurora DB clusters, and constructs
+// the `psql` or `mysql` command necessary to open a database console. Prompts have the kind `database`.
+//
+// Databases aren't reached over SSH, so each Prompt is RunOnProxy: jump points it at the Prompt its proxy jump selector
+// resolves to, like a bastion in the same VPC assigned by the manifest's automatic proxy jumps, and ShellCommand runs
+// there. Prompts without a proxy are disabled. The endpoint stays in ShellCommand and the endpoint annotation. A
+// hostname set in the query's Prompt template is connected to instead, without a proxy.
+//
+// DB instances that belong to a cluster are represented by the cluster's writer and reader endpoints.
+//
+// # Filters
+//
+// The RDS Provider accepts the following filters:
+//
+// - region: The AWS region to query. Defaults to the current region.
+// - engine: The database engine, e.g. postgres or aurora-mysql.
+// - cluster-identifier: The identifier of an Aurora DB cluster.
+// - role: writer or reader. Read replicas and cluster reader endpoints are readers.
+// - tag:<key>: The value of a tag.
+//
+// # Shell commands
+//
+// Prompts for PostgreSQL engines run `psql`, and Prompts for MySQL and MariaDB engines run `mysql`, as the master
+// user. Other engines have no default ShellCommand. A shellCommand in the query's Prompt template replaces the
+// default, and may use the placeholders {endpoint}, {port}, {database}, {username} and {region}, which are replaced
+// with shell-quoted values.
+//
+// # Sorting
+//
+// The RDS Provider does not sort natively. Queries are sorted and limited by jump.
+//
+// # Ids
+//
+// Prompt ids are derived from the DB instance or cluster ARN and role.
+//
+// # Labels
+//
+// The RDS Provider labels each Prompt with:
+//
+// - role: writer or reader.
+// - engine: The database engine.
+// - vpc-id: The id of the VPC the database runs in, when known.
+// - availability-zone: The availability zone of a DB instance.
+//
+// The keys and values of filters are also added as labels.
+//
+// # Resource configuration
+//
+// When enabled with the query's resourceConfig, the RDS Provider reads Prompt configuration from DB instance and
+// cluster tags, like the EC2 Provider. See jump.ResourceConfig.
+//
+// # Annotations
+//
+// The RDS Provider appends the following annotations to each Prompt:
+//
+// - endpoint: The address of the endpoint.
+// - port: The port of the endpoint.
+// - engineVersion: The version of the database engine.
+// - iamAuthentication: Whether IAM database authentication is enabled, true or false.
+type RDS struct {
+	RDSInterface RDSInterface
+	STSInterface STSInterface
+}
+
+type RDSProviderConfig struct {
+	RDSInterface RDSInterface
+	STSInterface STSInterface
+}
+
+func (provider *RDS) Initialize(providerConfig interface{}) {
+	if providerConfig != nil {
+		typedConfig := providerConfig.(RDSProviderConfig)
+		provider.RDSInterface = typedConfig.RDSInterface
+		provider.STSInterface = typedConfig.STSInterface
+	}
+}
+
+const (
+	rdsRoleWriter = "writer"
+	rdsRoleReader = "reader"
+)
+
+func (provider *RDS) Describe() *jump.ProviderSchema {
+	return &jump.ProviderSchema{
+		Description: "Queries AWS for RDS DB instances and Aurora DB clusters and constructs the `psql` or `mysql` command necessary to open a database console.",
+		Filters: []jump.SchemaKey{
+			{Name: "region", Description: "The AWS region to query. Defaults to the current region."},
+			{Name: "engine", Description: "The database engine, e.g. postgres or aurora-mysql."},
+			{Name: "cluster-identifier", Description: "The identifier of an Aurora DB cluster."},
+			{Name: "role", Description: "Whether the endpoint accepts writes.", Values: []string{rdsRoleWriter, rdsRoleReader}},
+			{Name: "tag:*", Description: "The value of a tag."},
+		},
+		Labels: []jump.SchemaKey{
+			{Name: "role", Description: "writer or reader."},
+			{Name: "engine", Description: "The database engine."},
+			{Name: "vpc-id", Description: "The id of the VPC the database runs in."},
+			{Name: "availability-zone", Description: "The availability zone of a DB instance."},
+		},
+		Annotations: []jump.SchemaKey{
+			{Name: "endpoint", Description: "The address of the endpoint."},
+			{Name: "port", Description: "The port of the endpoint."},
+			{Name: "engineVersion", Description: "The version of the database engine."},
+			{Name: "iamAuthentication", Description: "Whether IAM database authentication is enabled."},
+		},
+	}
+}
+
+func (provider *RDS) Discover(queries []*jump.PromptQuery) ([]*jump.Prompt, error) {
+	return discoverEach(queries, provider.Query)
+}
+
+// A database endpoint, before it is turned into a Prompt.
+type rdsEndpoint struct {
+	arn           string
+	name          string
+	role          string
+	address       string
+	port          int64
+	engine        string
+	engineVersion string
+	database      string
+	username      string
+	iamAuth       bool
+	labels        map[string]string
+	tags          []*rds.Tag
+}
+
+func (provider *RDS) Query(query *jump.PromptQuery) ([]*jump.Prompt, error) {
+
+	regionSession, err := GetAWSSession(query.Filters["region"])
+	if err != nil {
+		return nil, err
+	}
+	region := query.Filters["region"]
+	if region == "" {
+		region = aws.StringValue(regionSession.Config.Region)
+	}
+
+	provider = provider.forRegion(regionSession)
+
+	var filters []*rds.Filter
+	if engine := query.Filters["engine"]; engine != "" {
+		filters = append(filters, &rds.Filter{Name: aws.String("engine"), Values: []*string{aws.String(engine)}})
+	}
+	if cluster := query.Filters["cluster-identifier"]; cluster != "" {
+		filters = append(filters, &rds.Filter{Name: aws.String("db-cluster-id"), Values: []*string{aws.String(cluster)}})
+	}
+
+	var endpoints []*rdsEndpoint
+	// Clusters don't report their VPC, so it is taken from their members
+	clusterVPCs := make(map[string]string)
+
+	instancesInput := &rds.DescribeDBInstancesInput{Filters: filters}
+	for {
+		output, err := provider.RDSInterface.DescribeDBInstances(instancesInput)
+		if err != nil {
+			return nil, err
+		}
+		for _, instance := range output.DBInstances {
+			var vpcID string
+			if instance.DBSubnetGroup != nil {
+				vpcID = aws.StringValue(instance.DBSubnetGroup.VpcId)
+			}
+			if instance.DBClusterIdentifier != nil {
+				if vpcID != "" {
+					clusterVPCs[*instance.DBClusterIdentifier] = vpcID
+				}
+				continue
+			}
+			if aws.StringValue(instance.DBInstanceStatus) != "available" || instance.Endpoint == nil {
+				continue
+			}
+			role := rdsRoleWriter
+			if instance.ReadReplicaSourceDBInstanceIdentifier != nil || instance.ReadReplicaSourceDBClusterIdentifier != nil {
+				role = rdsRoleReader
+			}
+			labels := map[string]string{}
+			if vpcID != "" {
+				labels["vpc-id"] = vpcID
+			}
+			if instance.AvailabilityZone != nil {
+				labels["availability-zone"] = *instance.AvailabilityZone
+			}
+			endpoints = append(endpoints, &rdsEndpoint{
+				arn:           aws.StringValue(instance.DBInstanceArn),
+				name:          aws.StringValue(instance.DBInstanceIdentifier),
+				role:          role,
+				address:       aws.StringValue(instance.Endpoint.Address),
+				port:          aws.Int64Value(instance.Endpoint.Port),
+				engine:        aws.StringValue(instance.Engine),
+				engineVersion: aws.StringValue(instance.EngineVersion),
+				database:      aws.StringValue(instance.DBName),
+				username:      aws.StringValue(instance.MasterUsername),
+				iamAuth:       aws.BoolValue(instance.IAMDatabaseAuthenticationEnabled),
+				labels:        labels,
+				tags:          instance.TagList,
+			})
+		}
+		if aws.StringValue(output.Marker) == "" {
+			break
+		}
+		instancesInput.Marker = output.Marker
+	}
+
+	clustersInput := &rds.DescribeDBClustersInput{Filters: filters}
+	for {
+		output, err := provider.RDSInterface.DescribeDBClusters(clustersInput)
+		if err != nil {
+			return nil, err
+		}
+		for _, cluster := range output.DBClusters {
+			// DescribeDBClusters also returns Neptune and DocumentDB clusters
+			engine := aws.StringValue(cluster.Engine)
+			if engine == "neptune" || engine == "docdb" || aws.StringValue(cluster.Status) != "available" {
+				continue
+			}
+			for _, e := range []struct{ role, address *string }{
+				{aws.String(rdsRoleWriter), cluster.Endpoint},
+				{aws.String(rdsRoleReader), cluster.ReaderEndpoint},
+			} {
+				if e.address == nil {
+					continue
+				}
+				labels := map[string]string{}
+				if vpcID := clusterVPCs[aws.StringValue(cluster.DBClusterIdentifier)]; vpcID != "" {
+					labels["vpc-id"] = vpcID
+				}
+				endpoints = append(endpoints, &rdsEndpoint{
+					arn:           aws.StringValue(cluster.DBClusterArn),
+					name:          fmt.Sprintf("%s (%s)", aws.StringValue(cluster.DBClusterIdentifier), *e.role),
+					role:          *e.role,
+					address:       *e.address,
+					port:          aws.Int64Value(cluster.Port),
+					engine:        engine,
+					engineVersion: aws.StringValue(cluster.EngineVersion),
+					database:      aws.StringValue(cluster.DatabaseName),
+					username:      aws.StringValue(cluster.MasterUsername),
+					iamAuth:       aws.BoolValue(cluster.IAMDatabaseAuthenticationEnabled),
+					labels:        labels,
+					tags:          cluster.TagList,
+				})
+			}
+		}
+		if aws.StringValue(output.Marker) == "" {
+			break
+		}
+		clustersInput.Marker = output.Marker
+	}
+
+	var prompts []*jump.Prompt
+	for _, endpoint := range endpoints {
+		tags := rdsTagMap(endpoint.tags)
+		if !rdsEndpointMatches(endpoint, tags, query.Filters) {
+			continue
+		}
+		prompt := provider.decoratePromptWithQuery(rdsPrompt(query, endpoint), query, tags)
+		if prompt == nil {
+			continue
+		}
+		prompt.ShellCommand = expandDatabasePlaceholders(prompt.ShellCommand, endpoint, region)
+		prompts = append(prompts, prompt)
+	}
+
+	if limit := query.ProviderLimit(); limit != 0 && len(prompts) > limit {
+		prompts = prompts[:limit]
+	}
+
+	return prompts, nil
+}
+
+// Returns true if the endpoint matches the filters that aren't applied by the RDS API.
+func rdsEndpointMatches(endpoint *rdsEndpoint, tags map[string]string, filters map[string]string) bool {
+	if role := filters["role"]; role != "" && role != endpoint.role {
+		return false
+	}
+	for key, value := range filters {
+		if name := strings.TrimPrefix(key, "tag:"); name != key {
+			if actual, ok := tags[name]; !ok || actual != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Returns the Prompt for a database endpoint, before decoration.
+func rdsPrompt(query *jump.PromptQuery, endpoint *rdsEndpoint) *jump.Prompt {
+	labels := map[string]string{
+		"role":   endpoint.role,
+		"engine": endpoint.engine,
+	}
+	for key, value := range endpoint.labels {
+		labels[key] = value
+	}
+	return &jump.Prompt{
+		ID:           jump.PromptID("rds", query, endpoint.arn, endpoint.role),
+		Kind:         "database",
+		Name:         endpoint.name,
+		Hostname:     endpoint.address,
+		ShellCommand: databaseClientCommand(endpoint.engine),
+		Labels:       labels,
+		Annotations: map[string]string{
+			"endpoint":          endpoint.address,
+			"port":              strconv.FormatInt(endpoint.port, 10),
+			"engineVersion":     endpoint.engineVersion,
+			"iamAuthentication": strconv.FormatBool(endpoint.iamAuth),
+		},
+	}
+}
+
+// Returns the default ShellCommand template for a database engine, or an empty string if there is none.
+func databaseClientCommand(engine string) string {
+	switch {
+	case strings.Contains(engine, "postgres"):
+		return "psql -h {endpoint} -p {port} -U {username} -d {database}"
+	case strings.Contains(engine, "mysql"), engine == "mariadb", engine == "aurora":
+		return "mysql -h {endpoint} -P {port} -u {username} {database}"
+	}
+	return ""
+}
+
+// Replaces the placeholders documented on the RDS Provider with shell-quoted values. Flags whose value is empty, like
+// `-d {database}` for a database without a default database name, are left out.
+func expandDatabasePlaceholders(command string, endpoint *rdsEndpoint, region string) string {
+	values := map[string]string{
+		"{endpoint}": endpoint.address,
+		"{port}":     strconv.FormatInt(endpoint.port, 10),
+		"{database}": endpoint.database,
+		"{username}": endpoint.username,
+		"{region}":   region,
+	}
+	var pairs []string
+	for _, placeholder := range []string{"{endpoint}", "{port}", "{database}", "{username}", "{region}"} {
+		pairs = append(pairs, placeholder, shellQuote(values[placeholder]))
+	}
+	replacer := strings.NewReplacer(pairs...)
+	words := strings.Split(command, " ")
+	var expanded []string
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		value, isPlaceholder := values[word]
+		if isPlaceholder && value == "" {
+			// Drop the placeholder, and the flag before it
+			if n := len(expanded); n > 0 && strings.HasPrefix(expanded[n-1], "-") {
+				expanded = expanded[:n-1]
+			}
+			continue
+		}
+		expanded = append(expanded, replacer.Replace(word))
+	}
+	return strings.Join(expanded, " ")
+}
+
+// Returns the tags of an RDS resource as a map.
+func rdsTagMap(tags []*rds.Tag) map[string]string {
+	result := make(map[string]string)
+	for _, tag := range tags {
+		if tag.Key != nil && tag.Value != nil {
+			result[*tag.Key] = *tag.Value
+		}
+	}
+	return result
+}
+
+// Returns nil if the resource's tags exclude it.
+// Returns a copy of the provider that uses the clients of a region, unless they were set with Initialize.
+func (provider *RDS) forRegion(regionSession *session.Session) *RDS {
+	regional := *provider
+	// AWS RDS endpoints
+	if regional.RDSInterface == nil {
+		regional.RDSInterface = NewRDSInterface(regionSession)
+	}
+	return &regional
+}
+
+func (provider *RDS) decoratePromptWithQuery(prompt *jump.Prompt, query *jump.PromptQuery, tags map[string]string) *jump.Prompt {
+	decoratedPrompt := prompt.DecorateWithResource(query, tags)
+	if decoratedPrompt == nil {
+		return nil
+	}
+	if len(query.Filters) > 0 {
+		if decoratedPrompt.Labels == nil {
+			decoratedPrompt.Labels = map[string]string{}
+		}
+		for key, value := range query.Filters {
+			decoratedPrompt.Labels[key] = value
+		}
+	}
+	decoratedPrompt.RunOnProxy = query.Prompt == nil || query.Prompt.Hostname == ""
+	decoratedPrompt.Provider = "rds"
+	return decoratedPrompt
+}
@@ -0,0 +1,248 @@
+package aws_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	aws_provider "github.com/cased/jump/providers/aws"
+	jump "github.com/cased/jump/types/v1alpha"
+	"github.com/kylelemons/godebug/pretty"
+	"gopkg.in/yaml.v2"
+)
+
+// Returns the same pages for every query, one page per call, following Marker.
+type MockRDS struct {
+	DescribeDBInstancesOutputs []*rds.DescribeDBInstancesOutput
+	DescribeDBClustersOutput   *rds.DescribeDBClustersOutput
+}
+
+func (m *MockRDS) DescribeDBInstances(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+	page := 0
+	if input.Marker != nil {
+		page = 1
+	}
+	return m.DescribeDBInstancesOutputs[page], nil
+}
+
+func (m *MockRDS) DescribeDBClusters(input *rds.DescribeDBClustersInput) (*rds.DescribeDBClustersOutput, error) {
+	return m.DescribeDBClustersOutput, nil
+}
+
+func TestRDSProvider(t *testing.T) {
+	mock := &MockRDS{
+		DescribeDBInstancesOutputs: []*rds.DescribeDBInstancesOutput{
+			{
+				DBInstances: []*rds.DBInstance{
+					{
+						DBInstanceArn:        aws.String("arn:aws:rds:us-south-1:123456789012:db:orders"),
+						DBInstanceIdentifier: aws.String("orders"),
+						DBInstanceStatus:     aws.String("available"),
+						Engine:               aws.String("postgres"),
+						EngineVersion:        aws.String("15.4"),
+						MasterUsername:       aws.String("postgres"),
+						AvailabilityZone:     aws.String("us-south-1a"),
+						DBSubnetGroup:        &rds.DBSubnetGroup{VpcId: aws.String("vpc-1234")},
+						Endpoint: &rds.Endpoint{
+							Address: aws.String("orders.abc.us-south-1.rds.amazonaws.com"),
+							Port:    aws.Int64(5432),
+						},
+					},
+					{
+						DBInstanceArn:        aws.String("arn:aws:rds:us-south-1:123456789012:db:orders-migrating"),
+						DBInstanceIdentifier: aws.String("orders-migrating"),
+						DBInstanceStatus:     aws.String("modifying"),
+						Engine:               aws.String("postgres"),
+					},
+				},
+				Marker: aws.String("page-2"),
+			},
+			{
+				DBInstances: []*rds.DBInstance{
+					{
+						DBInstanceArn:                         aws.String("arn:aws:rds:us-south-1:123456789012:db:shop-replica"),
+						DBInstanceIdentifier:                  aws.String("shop-replica"),
+						DBInstanceStatus:                      aws.String("available"),
+						Engine:                                aws.String("mysql"),
+						EngineVersion:                         aws.String("8.0.35"),
+						MasterUsername:                        aws.String("admin"),
+						DBName:                                aws.String("shop"),
+						ReadReplicaSourceDBInstanceIdentifier: aws.String("shop"),
+						IAMDatabaseAuthenticationEnabled:      aws.Bool(true),
+						Endpoint: &rds.Endpoint{
+							Address: aws.String("shop-replica.abc.us-south-1.rds.amazonaws.com"),
+							Port:    aws.Int64(3306),
+						},
+					},
+					{
+						DBInstanceArn:        aws.String("arn:aws:rds:us-south-1:123456789012:db:ledger-1"),
+						DBInstanceIdentifier: aws.String("ledger-1"),
+						DBInstanceStatus:     aws.String("available"),
+						DBClusterIdentifier:  aws.String("ledger"),
+						Engine:               aws.String("aurora-postgresql"),
+						DBSubnetGroup:        &rds.DBSubnetGroup{VpcId: aws.String("vpc-5678")},
+					},
+				},
+			},
+		},
+		DescribeDBClustersOutput: &rds.DescribeDBClustersOutput{
+			DBClusters: []*rds.DBCluster{
+				{
+					DBClusterArn:                     aws.String("arn:aws:rds:us-south-1:123456789012:cluster:ledger"),
+					DBClusterIdentifier:              aws.String("ledger"),
+					Status:                           aws.String("available"),
+					Engine:                           aws.String("aurora-postgresql"),
+					EngineVersion:                    aws.String("15.4"),
+					MasterUsername:                   aws.String("postgres"),
+					DatabaseName:                     aws.String("ledger"),
+					Endpoint:                         aws.String("ledger.cluster-abc.us-south-1.rds.amazonaws.com"),
+					ReaderEndpoint:                   aws.String("ledger.cluster-ro-abc.us-south-1.rds.amazonaws.com"),
+					Port:                             aws.Int64(5432),
+					IAMDatabaseAuthenticationEnabled: aws.Bool(true),
+					TagList: []*rds.Tag{
+						{Key: aws.String("team"), Value: aws.String("payments")},
+					},
+				},
+				{
+					DBClusterArn:        aws.String("arn:aws:rds:us-south-1:123456789012:cluster:documents"),
+					DBClusterIdentifier: aws.String("documents"),
+					Status:              aws.String("available"),
+					Engine:              aws.String("docdb"),
+					Endpoint:            aws.String("documents.cluster-abc.us-south-1.docdb.amazonaws.com"),
+				},
+			},
+		},
+	}
+
+	c := &jump.AutoDiscoveryConfig{}
+	configFile, err := ioutil.ReadFile("testdata/rds_test.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(configFile, c); err != nil {
+		t.Fatal(err)
+	}
+	provider := &aws_provider.RDS{}
+	provider.Initialize(aws_provider.RDSProviderConfig{
+		RDSInterface: mock,
+		STSInterface: &aws_provider.MockSTS{},
+	})
+	got, err := provider.Discover(c.Queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bastion := map[string]string{"role": "bastion"}
+	want := jump.Prompts([]*jump.Prompt{
+		{
+			ID:                "rds-b72f3181db324f45",
+			Name:              "orders",
+			Hostname:          "orders.abc.us-south-1.rds.amazonaws.com",
+			ShellCommand:      "psql -h orders.abc.us-south-1.rds.amazonaws.com -p 5432 -U postgres",
+			Kind:              "database",
+			Provider:          "rds",
+			RunOnProxy:        true,
+			ProxyJumpSelector: bastion,
+			Labels: map[string]string{
+				"role":              "writer",
+				"engine":            "postgres",
+				"vpc-id":            "vpc-1234",
+				"availability-zone": "us-south-1a",
+			},
+			Annotations: map[string]string{
+				"endpoint":          "orders.abc.us-south-1.rds.amazonaws.com",
+				"port":              "5432",
+				"engineVersion":     "15.4",
+				"iamAuthentication": "false",
+			},
+		},
+		{
+			ID:                "rds-e42d837f8419f5c0",
+			Name:              "shop-replica",
+			Hostname:          "shop-replica.abc.us-south-1.rds.amazonaws.com",
+			ShellCommand:      "mysql -h shop-replica.abc.us-south-1.rds.amazonaws.com -P 3306 -u admin shop",
+			Kind:              "database",
+			Provider:          "rds",
+			RunOnProxy:        true,
+			ProxyJumpSelector: bastion,
+			Labels: map[string]string{
+				"role":   "reader",
+				"engine": "mysql",
+			},
+			Annotations: map[string]string{
+				"endpoint":          "shop-replica.abc.us-south-1.rds.amazonaws.com",
+				"port":              "3306",
+				"engineVersion":     "8.0.35",
+				"iamAuthentication": "true",
+			},
+		},
+		{
+			ID:                "rds-2f1291802fe2db11",
+			Name:              "ledger (writer)",
+			Hostname:          "ledger.cluster-abc.us-south-1.rds.amazonaws.com",
+			ShellCommand:      "psql -h ledger.cluster-abc.us-south-1.rds.amazonaws.com -p 5432 -U postgres -d ledger",
+			Kind:              "database",
+			Provider:          "rds",
+			RunOnProxy:        true,
+			ProxyJumpSelector: bastion,
+			Labels: map[string]string{
+				"role":   "writer",
+				"engine": "aurora-postgresql",
+				"vpc-id": "vpc-5678",
+			},
+			Annotations: map[string]string{
+				"endpoint":          "ledger.cluster-abc.us-south-1.rds.amazonaws.com",
+				"port":              "5432",
+				"engineVersion":     "15.4",
+				"iamAuthentication": "true",
+			},
+		},
+		{
+			ID:                "rds-25c77288a69268f3",
+			Name:              "ledger (reader)",
+			Hostname:          "ledger.cluster-ro-abc.us-south-1.rds.amazonaws.com",
+			ShellCommand:      "psql -h ledger.cluster-ro-abc.us-south-1.rds.amazonaws.com -p 5432 -U postgres -d ledger",
+			Kind:              "database",
+			Provider:          "rds",
+			RunOnProxy:        true,
+			ProxyJumpSelector: bastion,
+			Labels: map[string]string{
+				"role":   "reader",
+				"engine": "aurora-postgresql",
+				"vpc-id": "vpc-5678",
+			},
+			Annotations: map[string]string{
+				"endpoint":          "ledger.cluster-ro-abc.us-south-1.rds.amazonaws.com",
+				"port":              "5432",
+				"engineVersion":     "15.4",
+				"iamAuthentication": "true",
+			},
+		},
+		{
+			ID:           "rds-f7d149c5e9a40d89",
+			Name:         "ledger (reader)",
+			Hostname:     "ledger.cluster-ro-abc.us-south-1.rds.amazonaws.com",
+			ShellCommand: `PGPASSWORD="$(aws rds generate-db-auth-token --hostname ledger.cluster-ro-abc.us-south-1.rds.amazonaws.com --port 5432 --username app --region us-south-1)" psql -h ledger.cluster-ro-abc.us-south-1.rds.amazonaws.com -U app -d ledger`,
+			Kind:         "database",
+			Provider:     "rds",
+			RunOnProxy:   true,
+			Labels: map[string]string{
+				"role":     "reader",
+				"engine":   "aurora-postgresql",
+				"vpc-id":   "vpc-5678",
+				"region":   "us-south-1",
+				"tag:team": "payments",
+			},
+			Annotations: map[string]string{
+				"endpoint":          "ledger.cluster-ro-abc.us-south-1.rds.amazonaws.com",
+				"port":              "5432",
+				"engineVersion":     "15.4",
+				"iamAuthentication": "true",
+			},
+		},
+	})
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("unexpected prompts:\n%s", diff)
+	}
+}
@@ -0,0 +1,239 @@
+package aws
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	jump "github.com/cased/jump/types/v1alpha"
+)
+
+// The SSM auto-discovery Provider queries AWS Systems Manager for managed instances, including EC2 instances and
+// hybrid on-premises nodes with `mi-` ids, and constructs the `aws ssm start-session` command necessary to reach
+// them through Session Manager, without SSH ingress.
+//
+// The command is the Prompt's ConnectCommand, run by the Cased Shell host instead of connecting over SSH, so the host
+// needs the AWS CLI, the Session Manager plugin and permission to start sessions. The Prompt's Hostname is only
+// displayed, and a ShellCommand set in the query's Prompt runs in the session.
+//
+// # Filters
+//
+// The SSM Provider accepts the following filters:
+//
+// - region: The AWS region to query. Defaults to the current region.
+// - ping-status: Online, ConnectionLost or Inactive. Defaults to Online.
+// - platform: Linux, Windows or MacOS.
+// - resource-type: EC2Instance or ManagedInstance, for hybrid nodes.
+// - instance-id: The id of a managed instance.
+// - tag:<key>: The value of a tag.
+// - tag-key: The key of a tag, with any value.
+//
+// # Sorting
+//
+// The SSM Provider does not sort natively. Queries are sorted and limited by jump.
+//
+// # Ids
+//
+// Prompt ids are derived from the managed instance id.
+//
+// # Labels
+//
+// The keys and values of filters are added as labels.
+//
+// # Annotations
+//
+// The SSM Provider appends the following annotations to each Prompt, when known:
+//
+// - pingStatus: Whether the SSM Agent is connected.
+// - lastPingDateTime: The last time the SSM Agent reported its status.
+// - platformName: The name of the operating system, e.g. Ubuntu.
+// - ipAddress: The IP address of the instance. Only used for display, connections go through Session Manager.
+type SSM struct {
+	SSMInterface SSMInterface
+	STSInterface STSInterface
+}
+
+type SSMProviderConfig struct {
+	SSMInterface SSMInterface
+	STSInterface STSInterface
+}
+
+func (provider *SSM) Initialize(providerConfig interface{}) {
+	if providerConfig != nil {
+		typedConfig := providerConfig.(SSMProviderConfig)
+		provider.SSMInterface = typedConfig.SSMInterface
+		provider.STSInterface = typedConfig.STSInterface
+	}
+}
+
+// The DescribeInstanceInformation filter keys of each filter, other than tags.
+var ssmFilterKeys = map[string]string{
+	"ping-status":   "PingStatus",
+	"platform":      "PlatformTypes",
+	"resource-type": "ResourceType",
+	"instance-id":   "InstanceIds",
+	"tag-key":       "tag-key",
+}
+
+func (provider *SSM) Describe() *jump.ProviderSchema {
+	return &jump.ProviderSchema{
+		Description: "Queries AWS Systems Manager for managed instances and constructs the `aws ssm start-session` command necessary to reach them.",
+		Filters: []jump.SchemaKey{
+			{Name: "region", Description: "The AWS region to query. Defaults to the current region."},
+			{Name: "ping-status", Description: "Whether the SSM Agent is connected. Defaults to Online.", Values: []string{"Online", "ConnectionLost", "Inactive"}},
+			{Name: "platform", Description: "The operating system platform.", Values: []string{"Linux", "Windows", "MacOS"}},
+			{Name: "resource-type", Description: "EC2Instance, or ManagedInstance for hybrid nodes.", Values: []string{"EC2Instance", "ManagedInstance"}},
+			{Name: "instance-id", Description: "The id of a managed instance."},
+			{Name: "tag:*", Description: "The value of a tag."},
+			{Name: "tag-key", Description: "The key of a tag, with any value."},
+		},
+		Annotations: []jump.SchemaKey{
+			{Name: "pingStatus", Description: "Whether the SSM Agent is connected."},
+			{Name: "lastPingDateTime", Description: "The last time the SSM Agent reported its status."},
+			{Name: "platformName", Description: "The name of the operating system."},
+			{Name: "ipAddress", Description: "The IP address of the instance."},
+		},
+	}
+}
+
+func (provider *SSM) Discover(queries []*jump.PromptQuery) ([]*jump.Prompt, error) {
+	return discoverEach(queries, provider.Query)
+}
+
+func (provider *SSM) Query(query *jump.PromptQuery) ([]*jump.Prompt, error) {
+
+	regionSession, err := GetAWSSession(query.Filters["region"])
+	if err != nil {
+		return nil, err
+	}
+	region := query.Filters["region"]
+	if region == "" {
+		region = aws.StringValue(regionSession.Config.Region)
+	}
+
+	provider = provider.forRegion(regionSession)
+
+	filters := []*ssm.InstanceInformationStringFilter{}
+	if query.Filters["ping-status"] == "" {
+		filters = append(filters, &ssm.InstanceInformationStringFilter{
+			Key:    aws.String("PingStatus"),
+			Values: []*string{aws.String("Online")},
+		})
+	}
+	// Sorted, so requests are the same for the same query
+	keys := make([]string, 0, len(query.Filters))
+	for key := range query.Filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		filterKey, ok := ssmFilterKeys[key]
+		if !ok {
+			if !strings.HasPrefix(key, "tag:") {
+				continue
+			}
+			filterKey = key
+		}
+		filters = append(filters, &ssm.InstanceInformationStringFilter{
+			Key:    aws.String(filterKey),
+			Values: []*string{aws.String(query.Filters[key])},
+		})
+	}
+
+	var prompts []*jump.Prompt
+	input := &ssm.DescribeInstanceInformationInput{Filters: filters}
+	for {
+		output, err := provider.SSMInterface.DescribeInstanceInformation(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, instance := range output.InstanceInformationList {
+			if instance.InstanceId == nil {
+				continue
+			}
+			prompts = append(prompts, provider.decoratePromptWithQuery(ssmPrompt(query, instance, region), query))
+		}
+		if aws.StringValue(output.NextToken) == "" {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	if limit := query.ProviderLimit(); limit != 0 && len(prompts) > limit {
+		prompts = prompts[:limit]
+	}
+
+	return prompts, nil
+}
+
+// Returns the Prompt for a managed instance, before decoration.
+func ssmPrompt(query *jump.PromptQuery, instance *ssm.InstanceInformation, region string) *jump.Prompt {
+	instanceID := *instance.InstanceId
+	// Hybrid nodes are named when they are activated, EC2 instances only have a computer name
+	name := aws.StringValue(instance.Name)
+	if name == "" {
+		name = aws.StringValue(instance.ComputerName)
+	}
+	if name == "" {
+		name = instanceID
+	}
+	hostname := aws.StringValue(instance.ComputerName)
+	if hostname == "" {
+		hostname = instanceID
+	}
+
+	annotations := map[string]string{}
+	if instance.PingStatus != nil {
+		annotations["pingStatus"] = *instance.PingStatus
+	}
+	if instance.LastPingDateTime != nil {
+		annotations["lastPingDateTime"] = instance.LastPingDateTime.UTC().Format(time.RFC3339)
+	}
+	if instance.PlatformName != nil {
+		annotations["platformName"] = *instance.PlatformName
+	}
+	if instance.IPAddress != nil {
+		annotations["ipAddress"] = *instance.IPAddress
+	}
+
+	connectCommand := fmt.Sprintf("aws ssm start-session --target %s", instanceID)
+	if region != "" {
+		connectCommand += fmt.Sprintf(" --region %s", region)
+	}
+	return &jump.Prompt{
+		ID:             jump.PromptID("ssm", query, instanceID),
+		Kind:           "host",
+		Name:           name,
+		Hostname:       hostname,
+		ConnectCommand: connectCommand,
+		Annotations:    annotations,
+	}
+}
+
+// Returns a copy of the provider that uses the clients of a region, unless they were set with Initialize.
+func (provider *SSM) forRegion(regionSession *session.Session) *SSM {
+	regional := *provider
+	// AWS SSM endpoints
+	if regional.SSMInterface == nil {
+		regional.SSMInterface = NewSSMInterface(regionSession)
+	}
+	return &regional
+}
+
+func (provider *SSM) decoratePromptWithQuery(prompt *jump.Prompt, query *jump.PromptQuery) *jump.Prompt {
+	decoratedPrompt := prompt.DecorateWithQuery(query)
+	if len(query.Filters) > 0 {
+		if decoratedPrompt.Labels == nil {
+			decoratedPrompt.Labels = map[string]string{}
+		}
+		for key, value := range query.Filters {
+			decoratedPrompt.Labels[key] = value
+		}
+	}
+	decoratedPrompt.Provider = "ssm"
+	return decoratedPrompt
+}
@@ -0,0 +1,137 @@
+package aws_test
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	aws_provider "github.com/cased/jump/providers/aws"
+	jump "github.com/cased/jump/types/v1alpha"
+	"github.com/kylelemons/godebug/pretty"
+	"gopkg.in/yaml.v2"
+)
+
+type MockSSM struct {
+	TestDescribeInstanceInformationInput func(*ssm.DescribeInstanceInformationInput)
+
+	// Returned in turn, one page per call
+	DescribeInstanceInformationOutputs []*ssm.DescribeInstanceInformationOutput
+}
+
+func (m *MockSSM) DescribeInstanceInformation(input *ssm.DescribeInstanceInformationInput) (*ssm.DescribeInstanceInformationOutput, error) {
+	if m.TestDescribeInstanceInformationInput != nil {
+		m.TestDescribeInstanceInformationInput(input)
+	}
+	var output *ssm.DescribeInstanceInformationOutput
+	output, m.DescribeInstanceInformationOutputs = m.DescribeInstanceInformationOutputs[0], m.DescribeInstanceInformationOutputs[1:]
+	return output, nil
+}
+
+func TestSSMProvider(t *testing.T) {
+	var nextTokens []string
+	mock := &MockSSM{
+		TestDescribeInstanceInformationInput: func(input *ssm.DescribeInstanceInformationInput) {
+			nextTokens = append(nextTokens, aws.StringValue(input.NextToken))
+			wantFilters := []*ssm.InstanceInformationStringFilter{
+				{Key: aws.String("PingStatus"), Values: []*string{aws.String("Online")}},
+				{Key: aws.String("PlatformTypes"), Values: []*string{aws.String("Linux")}},
+				{Key: aws.String("tag:Environment"), Values: []*string{aws.String("production")}},
+			}
+			if diff := pretty.Compare(input.Filters, wantFilters); diff != "" {
+				t.Errorf("unexpected filters:\n%s", diff)
+			}
+		},
+		DescribeInstanceInformationOutputs: []*ssm.DescribeInstanceInformationOutput{
+			{
+				InstanceInformationList: []*ssm.InstanceInformation{
+					{
+						InstanceId:       aws.String("i-12345678"),
+						ComputerName:     aws.String("ip-10-0-0-1.us-south-1.compute.internal"),
+						IPAddress:        aws.String("10.0.0.1"),
+						PingStatus:       aws.String("Online"),
+						LastPingDateTime: aws.Time(time.Date(2021, time.July, 11, 0, 0, 0, 0, time.UTC)),
+						PlatformName:     aws.String("Amazon Linux"),
+						ResourceType:     aws.String("EC2Instance"),
+					},
+				},
+				NextToken: aws.String("page-2"),
+			},
+			{
+				InstanceInformationList: []*ssm.InstanceInformation{
+					{
+						InstanceId:   aws.String("mi-0123456789abcdef0"),
+						Name:         aws.String("datacenter-db-1"),
+						ComputerName: aws.String("db1.corp.example.com"),
+						PingStatus:   aws.String("Online"),
+						PlatformName: aws.String("Ubuntu"),
+						ResourceType: aws.String("ManagedInstance"),
+					},
+				},
+			},
+		},
+	}
+
+	c := &jump.AutoDiscoveryConfig{}
+	configFile, err := ioutil.ReadFile("testdata/ssm_test_filters.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(configFile, c); err != nil {
+		t.Fatal(err)
+	}
+	provider := &aws_provider.SSM{}
+	provider.Initialize(aws_provider.SSMProviderConfig{
+		SSMInterface: mock,
+		STSInterface: &aws_provider.MockSTS{},
+	})
+	got, err := provider.Discover(c.Queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := map[string]string{
+		"region":          "us-south-1",
+		"platform":        "Linux",
+		"tag:Environment": "production",
+	}
+	want := jump.Prompts([]*jump.Prompt{
+		{
+			ID:             "ssm-6ea5ac09ef4f4963",
+			Name:           "ip-10-0-0-1.us-south-1.compute.internal",
+			Description:    "A production host reached through Session Manager",
+			Hostname:       "ip-10-0-0-1.us-south-1.compute.internal",
+			ConnectCommand: "aws ssm start-session --target i-12345678 --region us-south-1",
+			Kind:           "host",
+			Provider:       "ssm",
+			Labels:         labels,
+			Annotations: map[string]string{
+				"pingStatus":       "Online",
+				"lastPingDateTime": "2021-07-11T00:00:00Z",
+				"platformName":     "Amazon Linux",
+				"ipAddress":        "10.0.0.1",
+			},
+		},
+		{
+			ID:             "ssm-be0269ba63e0e2a9",
+			Name:           "datacenter-db-1",
+			Description:    "A production host reached through Session Manager",
+			Hostname:       "db1.corp.example.com",
+			ConnectCommand: "aws ssm start-session --target mi-0123456789abcdef0 --region us-south-1",
+			Kind:           "host",
+			Provider:       "ssm",
+			Labels:         labels,
+			Annotations: map[string]string{
+				"pingStatus":   "Online",
+				"platformName": "Ubuntu",
+			},
+		},
+	})
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("unexpected prompts:\n%s", diff)
+	}
+	if diff := pretty.Compare(nextTokens, []string{"", "page-2"}); diff != "" {
+		t.Errorf("expected every page to be requested:\n%s", diff)
+	}
+}
@@ -11,4 +11,7 @@ func Register() {
 	jump.RegisterProvider("static", &static.Static{}, nil)
 	jump.RegisterProvider("ecs", &aws.ECS{}, nil)
 	jump.RegisterProvider("ec2", &aws.EC2{}, nil)
+	jump.RegisterProvider("ssm", &aws.SSM{}, nil)
+	jump.RegisterProvider("rds", &aws.RDS{}, nil)
+	jump.RegisterProvider("eks", &aws.EKS{}, nil)
 }
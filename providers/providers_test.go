@@ -3,6 +3,7 @@ package providers_test
 import (
 	"testing"
 
+	"github.com/cased/jump/providers"
 	jump "github.com/cased/jump/types/v1alpha"
 )
 
@@ -29,3 +30,17 @@ func TestExampleProvider(t *testing.T) {
 		t.Errorf("Expected 1 result, got %d", len(prompts))
 	}
 }
+
+func TestBuiltinProvidersDescribeThemselves(t *testing.T) {
+	providers.Register()
+	for name, provider := range jump.Providers {
+		describer, ok := provider.(jump.Describer)
+		if !ok {
+			t.Errorf("%s does not implement Describer", name)
+			continue
+		}
+		if describer.Describe().Description == "" {
+			t.Errorf("%s has no description", name)
+		}
+	}
+}
@@ -9,24 +9,36 @@ import (
 //
 // # Filters
 //
-// The Static Provider ignores all provided filters.
+// The Static Provider does not support any filters.
 //
 // # Sorting
 //
-// The Static Provider ignores all provided sorting options.
+// The Static Provider does not sort natively. Queries are sorted and limited by jump.
+//
+// # Ids
+//
+// Prompt ids are derived from the hostname, port and username of the Prompt.
 type Static struct {
 }
 
 func (provider *Static) Initialize(i interface{}) {
 }
 
+func (provider *Static) Describe() *jump.ProviderSchema {
+	return &jump.ProviderSchema{
+		Description: "Performs no discovery and returns the Prompt passed to it.",
+	}
+}
+
 func (provider *Static) Discover(queries []*jump.PromptQuery) ([]*jump.Prompt, error) {
 	var prompts []*jump.Prompt
 	for _, query := range queries {
 		prompt := &jump.Prompt{
 			Provider: "static",
 		}
-		prompts = append(prompts, prompt.DecorateWithQuery(query))
+		prompt = prompt.DecorateWithQuery(query)
+		prompt.ID = jump.PromptID("static", query, prompt.Hostname, prompt.Port, prompt.Username)
+		prompts = append(prompts, prompt)
 	}
 	return prompts, nil
 }
@@ -1,18 +1,44 @@
 package v1alpha
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 type AutoDiscoveryConfig struct {
-	Queries []*PromptQuery `yaml:"queries"`
+	Include  []string        `json:"include,omitempty" yaml:"include,omitempty"` // Other config files, directories or glob patterns to load before this file's queries. Relative paths are resolved against the directory of the including file.
+	Queries  []*PromptQuery  `json:"queries" yaml:"queries"`
+	Manifest *ManifestConfig `json:"manifest,omitempty" yaml:"manifest,omitempty"` // Options for the manifest. May only be set in one of the loaded files.
+
+	manifestSource string         // The config file Manifest was loaded from.
+	sources        []configSource // The config files loaded, in order, before interpolation. See Hash.
+}
+
+// A config file as written, and the references it expanded, like `${DB_PASSWORD}`, but never their values.
+type configSource struct {
+	data       []byte
+	references []string
+}
+
+// Options for the manifest written by jump.
+type ManifestConfig struct {
+	// The order of Prompts in the manifest. Prompts are sorted by each key in turn, then by the default order:
+	// by provider, then by the order of the queries that produced them. Results of a query without a sortBy are
+	// ordered by name, hostname and id.
+	SortBy []SortKey `json:"sortBy,omitempty" yaml:"sortBy,omitempty"`
+
+	// How proxy jump selectors are checked against the Prompts in the manifest.
+	ProxyJump *ProxyJumpConfig `json:"proxyJump,omitempty" yaml:"proxyJump,omitempty"`
 }
 
 // A map of registered providers.
@@ -28,85 +54,350 @@ func RegisterProvider(providerName string, provider Provider, providerConfig int
 	Providers[providerName] = provider
 }
 
+// Loads and merges the config files found at paths. Each path may be a file, a directory, or a glob pattern like
+// `conf.d/*.yaml`. Directories and patterns expand to the YAML and JSON files they contain, in lexical order.
+// Files named by an `include` directive are loaded before the queries of the file that includes them, and each file
+// is only loaded once. Query names must be unique across all loaded files.
 func LoadAutoDiscoveryConfigFromPaths(paths []string) (*AutoDiscoveryConfig, error) {
-	mergedConfig := &AutoDiscoveryConfig{}
+	loader := &configLoader{
+		config: &AutoDiscoveryConfig{},
+		loaded: make(map[string]bool),
+	}
 	for _, path := range paths {
-		config := &AutoDiscoveryConfig{}
-		yamlFile, err := ioutil.ReadFile(path)
+		err := loader.loadPath(path)
 		if err != nil {
 			return nil, err
 		}
-		if strings.Contains(path, ".json") {
-			err = json.Unmarshal(yamlFile, config)
-		} else {
-			err = yaml.Unmarshal(yamlFile, config)
+	}
+	mergedConfig := loader.config
+
+	// Ensure query names are unique
+	querySources := make(map[string]string)
+	for _, query := range mergedConfig.Queries {
+		if query.Name == "" {
+			continue
+		}
+		if source, ok := querySources[query.Name]; ok {
+			return nil, loader.redact(fmt.Errorf("%s: duplicate query name %q, first defined in %s", query.source, query.Name, source))
+		}
+		querySources[query.Name] = query.source
+	}
+
+	// Ensure all queries have a provider and are valid for that provider
+	var problems []string
+	for _, query := range mergedConfig.Queries {
+		if Providers[query.Provider] == nil {
+			problems = append(problems, fmt.Sprintf("%s: unknown provider %q", query.location(), query.Provider))
+			continue
+		}
+		for _, problem := range query.validate() {
+			problems = append(problems, fmt.Sprintf("%s: %s", query.location(), problem))
 		}
+	}
+	if mergedConfig.Manifest != nil {
+		for _, key := range mergedConfig.Manifest.SortBy {
+			if err := key.validate(); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: manifest sortBy: %s", mergedConfig.manifestSource, err))
+			}
+		}
+		if mergedConfig.Manifest.ProxyJump != nil {
+			for _, problem := range mergedConfig.Manifest.ProxyJump.validate() {
+				problems = append(problems, fmt.Sprintf("%s: manifest proxyJump: %s", mergedConfig.manifestSource, problem))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		// Problems quote the values of filters and options, which may have been interpolated from secrets
+		return nil, loader.redact(fmt.Errorf("invalid config:\n%s", strings.Join(problems, "\n")))
+	}
+
+	return mergedConfig, nil
+}
+
+// Config file extensions loaded from directories.
+var configExtensions = []string{".yaml", ".yml", ".json"}
+
+type configLoader struct {
+	config *AutoDiscoveryConfig
+	loaded map[string]bool // Absolute paths of files already loaded
+	stack  []string        // Absolute paths of files currently being loaded, for include cycle detection
+	values []string        // The values substituted by interpolation in every loaded file. Never log these.
+}
+
+// Replaces every value substituted in the loaded files in err's message, like interpolation.redact.
+func (loader *configLoader) redact(err error) error {
+	return (&interpolation{values: loader.values}).redact(err)
+}
+
+// Loads the file, directory or glob pattern at path.
+func (loader *configLoader) loadPath(path string) error {
+	files, err := expandConfigPath(path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		err := loader.loadFile(file)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		mergedConfig.Queries = append(mergedConfig.Queries, config.Queries...)
 	}
+	return nil
+}
 
-	// Ensure all queries have a provider
-	_, err := mergedConfig.queriesByProvider()
+func (loader *configLoader) loadFile(path string) error {
+	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	for _, including := range loader.stack {
+		if including == absPath {
+			return fmt.Errorf("include cycle: %s", strings.Join(append(loader.stack, absPath), " -> "))
+		}
+	}
+	if loader.loaded[absPath] {
+		return nil
+	}
+	loader.loaded[absPath] = true
 
-	return mergedConfig, nil
+	config := &AutoDiscoveryConfig{}
+	yamlFile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	interpolated, err := interpolate(yamlFile, filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if os.Getenv("LOG_LEVEL") == "debug" && len(interpolated.references) > 0 {
+		// Only log references, never their values
+		log.Printf("[config] %s: interpolated %s\n", path, strings.Join(interpolated.references, ", "))
+	}
+	// Reject unknown fields, so typos like `filter:` or `sortby:` aren't silently ignored
+	var lines []int
+	if strings.Contains(path, ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(interpolated.data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+	} else {
+		err = yaml.UnmarshalStrict(interpolated.data, config)
+		lines = queryLines(yamlFile)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, interpolated.redact(err))
+	}
+
+	loader.values = append(loader.values, interpolated.values...)
+	loader.config.sources = append(loader.config.sources, configSource{data: yamlFile, references: interpolated.references})
+
+	loader.stack = append(loader.stack, absPath)
+	for _, include := range config.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		err := loader.loadPath(include)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	loader.stack = loader.stack[:len(loader.stack)-1]
+
+	if config.Manifest != nil {
+		if loader.config.Manifest != nil {
+			return fmt.Errorf("%s: manifest options are already set in %s", path, loader.config.manifestSource)
+		}
+		loader.config.Manifest = config.Manifest
+		loader.config.manifestSource = path
+	}
+	for i, query := range config.Queries {
+		query.source = path
+		if len(lines) == len(config.Queries) {
+			query.line = lines[i]
+		}
+	}
+	loader.config.Queries = append(loader.config.Queries, config.Queries...)
+	return nil
 }
 
-func (config *AutoDiscoveryConfig) queriesByProvider() (map[string][]*PromptQuery, error) {
-	ret := make(map[string][]*PromptQuery)
-	for _, query := range config.Queries {
-		if Providers[query.Provider] != nil {
-			if ret[query.Provider] == nil {
-				ret[query.Provider] = make([]*PromptQuery, 0)
+// Expands a directory or glob pattern into a sorted list of config files. Other paths are returned as-is.
+func expandConfigPath(path string) ([]string, error) {
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no config files match", path)
+		}
+		var files []string
+		for _, match := range matches {
+			expanded, err := expandConfigPath(match)
+			if err != nil {
+				return nil, err
 			}
-			ret[query.Provider] = append(ret[query.Provider], query)
-		} else {
-			return nil, fmt.Errorf("unknown provider %s", query.Provider)
+			files = append(files, expanded...)
 		}
+		return files, nil
 	}
-	return ret, nil
-}
 
-// Dispatches PromptQueries to each registered Provider. Returns a list of Prompts.
-func (config *AutoDiscoveryConfig) DiscoverPrompts() ([]*Prompt, error) {
-	prompts := make([]*Prompt, 0)
-	queries, err := config.queriesByProvider()
+	info, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
-	for providerName, providerQueries := range queries {
-		provider := Providers[providerName]
-		providerPrompts, err := provider.Discover(providerQueries)
-		if err != nil {
-			log.Println(err)
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		// Skip hidden files, including the ..data links Kubernetes creates in ConfigMap volumes
+		if strings.HasPrefix(entry.Name(), ".") {
 			continue
 		}
-		prompts = append(prompts, providerPrompts...)
+		for _, ext := range configExtensions {
+			if filepath.Ext(entry.Name()) == ext {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
 	}
+	sort.Strings(files)
+	return files, nil
+}
 
-	return prompts, nil
+// Dispatches each PromptQuery to its registered Provider, in the order the queries were loaded.
+// Returns a list of Prompts in manifest order, see ManifestConfig.
+func (config *AutoDiscoveryConfig) DiscoverPrompts() ([]*Prompt, error) {
+	manifest, err := config.DiscoverManifest()
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Prompts, nil
 }
 
-func WriteAutoDiscoveryManifestToPath(prompts []*Prompt, path string) error {
-	sort.SliceStable(prompts, func(i, j int) bool {
-		return prompts[i].Provider < prompts[j].Provider
-	})
+// Reports a problem that didn't stop the query, like a resource that was skipped. Providers call Warn during
+// Discover. Warnings are logged and listed in the manifest, prefixed with the query's location.
+func (query *PromptQuery) Warn(format string, args ...interface{}) {
+	query.warnings = append(query.warnings, fmt.Sprintf(format, args...))
+}
+
+// Returns the warnings reported by the Provider for this query.
+func (query *PromptQuery) Warnings() []string {
+	return query.warnings
+}
+
+// Returns a copy of the query that collects its own warnings, for Providers that query in parallel, since Warn isn't
+// safe for concurrent use. Report the copy's Warnings to the query once it's done, so they are listed in a stable order.
+func (query *PromptQuery) Fork() *PromptQuery {
+	fork := *query
+	fork.warnings = nil
+	return &fork
+}
+
+// Dispatches each PromptQuery to its registered Provider, in the order the queries were loaded.
+// Returns a manifest containing the Prompts in manifest order, see ManifestConfig, and a summary of each query.
+// Errors returned by Providers are logged and recorded in the query summary, and don't stop discovery. Proxy jump
+// problems configured with severity error do, see ProxyJumpConfig.
+func (config *AutoDiscoveryConfig) DiscoverManifest() (*AutoDiscoveryManifest, error) {
+	start := now()
+	prompts := make([]*Prompt, 0)
+	var summaries []*QuerySummary
+	var warnings []string
+	queryOf := make(map[*Prompt]*QuerySummary)
+	for _, query := range config.Queries {
+		provider := Providers[query.Provider]
+		if provider == nil {
+			return nil, fmt.Errorf("unknown provider %s", query.Provider)
+		}
+		summary := &QuerySummary{
+			Name:     query.Name,
+			Provider: query.Provider,
+		}
+		if query.source != "" {
+			summary.Source = query.location()
+		}
+		summaries = append(summaries, summary)
+
+		discovery := query.forDiscovery()
+		queryPrompts, err := provider.Discover([]*PromptQuery{discovery})
+		if err != nil {
+			log.Printf("%s: %s\n", query.location(), err)
+			summary.Error = err.Error()
+		}
+		for _, warning := range discovery.warnings {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", query.location(), warning))
+		}
+		if query.Selector != nil {
+			discovered := len(queryPrompts)
+			queryPrompts = SelectPrompts(queryPrompts, query.Selector)
+			if discovered > 0 && len(queryPrompts) == 0 {
+				warnings = append(warnings, fmt.Sprintf("%s: selector %q matches none of %d discovered prompts", query.location(), query.Selector, discovered))
+			}
+		}
+		if query.Where != "" {
+			queryPrompts, err = filterWhere(queryPrompts, query.Where, start)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: where: %s", query.location(), err))
+			}
+		}
+		queryPrompts = query.sortAndLimit(queryPrompts)
+		queryPrompts = query.expandVariants(queryPrompts)
+		for _, p := range queryPrompts {
+			queryOf[p] = summary
+		}
+		prompts = append(prompts, queryPrompts...)
+	}
 
-	manifest := &AutoDiscoveryManifest{
-		Prompts: prompts,
+	SortPrompts(prompts, defaultManifestSortKeys)
+	if config.Manifest != nil {
+		SortPrompts(prompts, config.Manifest.SortBy)
 	}
-	file, err := json.MarshalIndent(manifest, "", " ")
-	if err != nil {
-		return err
+	for _, p := range prompts {
+		queryOf[p].Prompts++
 	}
 
-	err = ioutil.WriteFile(path, file, 0644)
+	var proxyJumpConfig *ProxyJumpConfig
+	if config.Manifest != nil {
+		proxyJumpConfig = config.Manifest.ProxyJump
+	}
+	proxyJumpProblems := resolveProxyJumps(prompts, proxyJumpConfig.withDefaults())
+	warnings = append(warnings, proxyJumpProblems.warnings...)
+	for _, warning := range warnings {
+		log.Printf("warning: %s\n", warning)
+	}
+	if len(proxyJumpProblems.errors) > 0 {
+		return nil, fmt.Errorf("invalid proxy jumps:\n%s", strings.Join(proxyJumpProblems.errors, "\n"))
+	}
+
+	manifest := NewAutoDiscoveryManifest(prompts)
+	manifest.ConfigHash = config.Hash()
+	manifest.Queries = summaries
+	manifest.Warnings = warnings
+	return manifest, nil
+}
+
+// Returns the Prompts matching the expression where. Prompts the expression can't be evaluated for, for example
+// because a label isn't a valid time, are left out, and the first such error is returned.
+func filterWhere(prompts []*Prompt, where string, now time.Time) ([]*Prompt, error) {
+	expression, err := ParseExpression(where)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	var matched []*Prompt
+	var firstErr error
+	for _, p := range prompts {
+		ok, err := expression.Matches(p, now)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", p.describe(), err)
+			}
+			continue
+		}
+		if ok {
+			matched = append(matched, p)
+		}
+	}
+	return matched, firstErr
 }
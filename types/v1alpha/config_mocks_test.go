@@ -9,18 +9,28 @@ import (
 )
 
 type MockEC2 struct {
-	DescribeInstancesOutput *ec2.DescribeInstancesOutput
+	DescribeInstancesOutput                *ec2.DescribeInstancesOutput
+	DescribeInstanceConnectEndpointsOutput *ec2.DescribeInstanceConnectEndpointsOutput
+	DescribeInstanceStatusOutput           *ec2.DescribeInstanceStatusOutput
 }
 
 func (m *MockEC2) DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
 	return m.DescribeInstancesOutput, nil
 }
+func (m *MockEC2) DescribeInstanceConnectEndpoints(input *ec2.DescribeInstanceConnectEndpointsInput) (*ec2.DescribeInstanceConnectEndpointsOutput, error) {
+	return m.DescribeInstanceConnectEndpointsOutput, nil
+}
+func (m *MockEC2) DescribeInstanceStatus(input *ec2.DescribeInstanceStatusInput) (*ec2.DescribeInstanceStatusOutput, error) {
+	return m.DescribeInstanceStatusOutput, nil
+}
 
 type MockECS struct {
 	ListTasksOutput                  *ecs.ListTasksOutput
 	DescribeTasksOutput              *ecs.DescribeTasksOutput
 	ListContainerInstancesOutput     *ecs.ListContainerInstancesOutput
 	DescribeContainerInstancesOutput *ecs.DescribeContainerInstancesOutput
+	DescribeTaskDefinitionOutput     *ecs.DescribeTaskDefinitionOutput
+	ListClustersOutput               *ecs.ListClustersOutput
 }
 
 func (m *MockECS) ListTasks(input *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
@@ -35,6 +45,12 @@ func (m *MockECS) ListContainerInstances(input *ecs.ListContainerInstancesInput)
 func (m *MockECS) DescribeContainerInstances(input *ecs.DescribeContainerInstancesInput) (*ecs.DescribeContainerInstancesOutput, error) {
 	return m.DescribeContainerInstancesOutput, nil
 }
+func (m *MockECS) DescribeTaskDefinition(input *ecs.DescribeTaskDefinitionInput) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return m.DescribeTaskDefinitionOutput, nil
+}
+func (m *MockECS) ListClusters(input *ecs.ListClustersInput) (*ecs.ListClustersOutput, error) {
+	return m.ListClustersOutput, nil
+}
 
 var (
 	instanceOne = &ec2.Instance{
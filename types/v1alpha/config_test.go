@@ -4,7 +4,10 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cased/jump/providers"
 	"github.com/cased/jump/providers/aws"
@@ -59,11 +62,15 @@ func TestConfigRoundTrip(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			prompts, err := config.DiscoverPrompts()
+			defer jump.SetNow(time.Date(2022, time.December, 1, 0, 0, 0, 0, time.UTC))()
+			manifest, err := config.DiscoverManifest()
 			if err != nil {
 				t.Fatal(err)
 			}
-			err = jump.WriteAutoDiscoveryManifestToPath(prompts, testCase.ManifestPath+".generated")
+			if !manifest.Verify() {
+				t.Error("Expected manifest checksum to match its prompts")
+			}
+			err = manifest.WriteToPath(testCase.ManifestPath + ".generated")
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -101,3 +108,128 @@ func TestConfigConfigValidProviders(t *testing.T) {
 }
 
 // TODO validate each query against provider before running?
+
+func TestConfigPaths(t *testing.T) {
+	providers.Register()
+	type test struct {
+		Name        string
+		ConfigPaths []string
+		WantQueries []string
+		WantErr     bool
+	}
+	tests := []test{
+		{
+			Name:        "directory",
+			ConfigPaths: []string{"testdata/conf.d"},
+			WantQueries: []string{"bastions", "shared", "app", "defaults"},
+		},
+		{
+			Name:        "glob",
+			ConfigPaths: []string{"testdata/conf.d/*.y*ml"},
+			WantQueries: []string{"bastions", "shared", "app"},
+		},
+		{
+			Name:        "files are loaded once",
+			ConfigPaths: []string{"testdata/include/shared.yaml", "testdata/conf.d"},
+			WantQueries: []string{"shared", "bastions", "app", "defaults"},
+		},
+		{
+			Name:        "glob without matches",
+			ConfigPaths: []string{"testdata/conf.d/*.toml"},
+			WantErr:     true,
+		},
+		{
+			Name:        "include cycle",
+			ConfigPaths: []string{"testdata/include/cycle_a.yaml"},
+			WantErr:     true,
+		},
+		{
+			Name:        "duplicate query names",
+			ConfigPaths: []string{"testdata/conf.d", "testdata/include/duplicate_name.yaml"},
+			WantErr:     true,
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.Name, func(t *testing.T) {
+			config, err := jump.LoadAutoDiscoveryConfigFromPaths(testCase.ConfigPaths)
+			if testCase.WantErr {
+				if err == nil {
+					t.Fatal("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, query := range config.Queries {
+				got = append(got, query.Name)
+			}
+			if !reflect.DeepEqual(got, testCase.WantQueries) {
+				t.Errorf("got %v, want %v", got, testCase.WantQueries)
+			}
+		})
+	}
+}
+
+func TestConfigStrictValidation(t *testing.T) {
+	providers.Register()
+	tests := []struct {
+		ConfigPath string
+		WantError  string
+	}{
+		{"testdata/invalid/unknown_field.yaml", "line 3: field filter not found"},
+		{"testdata/invalid/unknown_field.json", `unknown field "filterz"`},
+		{"testdata/invalid/sort_key.yaml", `testdata/invalid/sort_key.yaml:6: sortBy: unknown prompt field "launchtime", and provider ec2 only supports sort keys launchTime`},
+		{"testdata/invalid/sort_order.yaml", `testdata/invalid/sort_order.yaml:2: sortOrder must be asc or desc`},
+		{"testdata/invalid/unknown_filter.yaml", "testdata/invalid/unknown_filter.yaml:2: provider ecs does not support filter \"owner\"\ntestdata/invalid/unknown_filter.yaml:2: provider ecs does not support filter \"team\""},
+		{"testdata/invalid/options.yaml", "testdata/invalid/options.yaml:2: provider ec2 does not support filter \"connection-mode\"\ntestdata/invalid/options.yaml:2: option status-checks must be one of ignore, annotate, exclude, got \"sometimes\""},
+		{"testdata/example_invalid.yaml", `testdata/example_invalid.yaml:2: unknown provider "notimplemented"`},
+	}
+	for _, test := range tests {
+		t.Run(test.ConfigPath, func(t *testing.T) {
+			_, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{test.ConfigPath})
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if !strings.Contains(err.Error(), test.WantError) {
+				t.Errorf("got %q, want it to contain %q", err, test.WantError)
+			}
+		})
+	}
+}
+
+// Reports a warning for every query it discovers. Its nil schema accepts any filter.
+type warningProvider struct{}
+
+func (provider *warningProvider) Initialize(interface{}) {}
+
+func (provider *warningProvider) Describe() *jump.ProviderSchema { return nil }
+
+func (provider *warningProvider) Discover(queries []*jump.PromptQuery) ([]*jump.Prompt, error) {
+	var prompts []*jump.Prompt
+	for _, query := range queries {
+		query.Warn("skipping %s", "broken.example.com")
+		prompts = append(prompts, (&jump.Prompt{Name: "ok"}).DecorateWithQuery(query))
+	}
+	return prompts, nil
+}
+
+func TestDiscoverManifestProviderWarnings(t *testing.T) {
+	jump.RegisterProvider("warning", &warningProvider{}, nil)
+	config, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/warnings/config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Warnings of a previous discovery aren't repeated
+	for i := 0; i < 2; i++ {
+		manifest, err := config.DiscoverManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantWarnings := []string{"testdata/warnings/config.yaml:2: skipping broken.example.com"}
+		if !reflect.DeepEqual(manifest.Warnings, wantWarnings) {
+			t.Errorf("got warnings %q, want %q", manifest.Warnings, wantWarnings)
+		}
+	}
+}
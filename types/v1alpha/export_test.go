@@ -0,0 +1,26 @@
+package v1alpha
+
+import (
+	"reflect"
+	"time"
+)
+
+// Sets the clock used for manifest timestamps. Returns a function that restores it.
+func SetNow(t time.Time) func() {
+	original := now
+	now = func() time.Time { return t }
+	return func() { now = original }
+}
+
+// Returns the names of the exported Prompt fields that DecorateWithQuery would skip for lack of a merge rule.
+func PromptFieldsWithoutMergeRule() []string {
+	var names []string
+	t := reflect.TypeOf(Prompt{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath == "" && field.Tag.Get("merge") != "-" && !hasMergeRule(field.Type.Kind()) {
+			names = append(names, field.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,757 @@
+package v1alpha
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// An Expression is a boolean expression over the fields, labels and annotations of a Prompt, used by the `where`
+// option of a PromptQuery to filter discovered Prompts. For example:
+//
+//	annotations.launchTime < now() - 7d && labels.env != "canary"
+//
+// Expressions support:
+//
+//   - References to Prompt fields by JSON name, like `name` or `featured`, and to labels and annotations, like
+//     `labels.env` or `labels["tag:Name"]`. References to missing values are null.
+//   - String literals in double quotes, numbers, `true`, `false` and `null`.
+//   - Durations, like `90s`, `30m`, `12h`, `7d` or `2w`, and combinations like `1h30m`.
+//   - now(), the time discovery started.
+//   - Comparisons with `==`, `!=`, `<`, `<=`, `>` and `>=`, and regular expression matches with `=~` and `!~`.
+//   - Arithmetic on times, durations and numbers with `+` and `-`.
+//   - Boolean logic with `&&`, `||`, `!` and parentheses.
+//
+// Values are compared by type. Strings compared to a time, number or duration are parsed as one, so
+// `annotations.launchTime` can be compared to `now() - 7d`. Ordering comparisons and regular expression matches
+// against null are false, and `!=` and `!~` are the negations of `==` and `=~`.
+type Expression struct {
+	source string
+	root   node
+}
+
+// Parses an Expression.
+func ParseExpression(source string) (*Expression, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	parser := &parser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := parser.peek(); tok.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at offset %d", tok, tok.pos)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Returns true if the Prompt matches the expression. now is the value of now().
+func (e *Expression) Matches(p *Prompt, now time.Time) (bool, error) {
+	v, err := e.root.eval(&evalContext{prompt: p, now: now})
+	if err != nil {
+		return false, err
+	}
+	return v.truthy(), nil
+}
+
+// Tokens
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenDuration
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenDot
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "+", "-"}
+
+func lex(source string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(source) {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{tokenLBracket, "[", i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{tokenRBracket, "]", i})
+			i++
+		case c == '.':
+			tokens = append(tokens, token{tokenDot, ".", i})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(source) && source[end] != '"' {
+				if source[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(source) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			text, err := strconv.Unquote(source[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d: %w", i, err)
+			}
+			tokens = append(tokens, token{tokenString, text, i})
+			i = end + 1
+		case unicode.IsDigit(c):
+			end := i
+			for end < len(source) && (unicode.IsDigit(rune(source[end])) || source[end] == '.' || unicode.IsLetter(rune(source[end]))) {
+				end++
+			}
+			text := source[i:end]
+			if _, err := strconv.ParseFloat(text, 64); err == nil {
+				tokens = append(tokens, token{tokenNumber, text, i})
+			} else if _, err := parseDuration(text); err == nil {
+				tokens = append(tokens, token{tokenDuration, text, i})
+			} else {
+				return nil, fmt.Errorf("invalid number or duration %q at offset %d", text, i)
+			}
+			i = end
+		case unicode.IsLetter(c) || c == '_':
+			end := i
+			for end < len(source) && isIdentChar(rune(source[end])) {
+				end++
+			}
+			tokens = append(tokens, token{tokenIdent, source[i:end], i})
+			i = end
+			// Label and annotation keys may contain dashes, dots, colons and slashes, like labels.tag:aws:autoscaling:groupName
+			if ident := tokens[len(tokens)-1].text; (ident == "labels" || ident == "annotations") && i < len(source) && source[i] == '.' {
+				tokens = append(tokens, token{tokenDot, ".", i})
+				i++
+				end = i
+				for end < len(source) && (isIdentChar(rune(source[end])) || strings.ContainsRune("-.:/", rune(source[end]))) {
+					end++
+				}
+				tokens = append(tokens, token{tokenIdent, source[i:end], i})
+				i = end
+			}
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, token{tokenOperator, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+			}
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(source)}), nil
+}
+
+func isIdentChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// Parses durations like 90s, 7d or 1h30m. Supports the units of time.ParseDuration, plus d (24h) and w (7d).
+func parseDuration(text string) (time.Duration, error) {
+	var total time.Duration
+	rest := text
+	if rest == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	for rest != "" {
+		end := 0
+		for end < len(rest) && (unicode.IsDigit(rune(rest[end])) || rest[end] == '.') {
+			end++
+		}
+		if end == 0 {
+			return 0, fmt.Errorf("invalid duration %q", text)
+		}
+		number, err := strconv.ParseFloat(rest[:end], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", text)
+		}
+		rest = rest[end:]
+		end = 0
+		for end < len(rest) && unicode.IsLetter(rune(rest[end])) {
+			end++
+		}
+		var unit time.Duration
+		switch rest[:end] {
+		case "ns":
+			unit = time.Nanosecond
+		case "us":
+			unit = time.Microsecond
+		case "ms":
+			unit = time.Millisecond
+		case "s":
+			unit = time.Second
+		case "m":
+			unit = time.Minute
+		case "h":
+			unit = time.Hour
+		case "d":
+			unit = 24 * time.Hour
+		case "w":
+			unit = 7 * 24 * time.Hour
+		default:
+			return 0, fmt.Errorf("invalid duration %q", text)
+		}
+		total += time.Duration(number * float64(unit))
+		rest = rest[end:]
+	}
+	return total, nil
+}
+
+// Parser
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (parser *parser) peek() token {
+	return parser.tokens[parser.pos]
+}
+
+func (parser *parser) next() token {
+	tok := parser.tokens[parser.pos]
+	if tok.kind != tokenEOF {
+		parser.pos++
+	}
+	return tok
+}
+
+func (parser *parser) acceptOperator(ops ...string) (string, bool) {
+	tok := parser.peek()
+	if tok.kind != tokenOperator {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			parser.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (parser *parser) expect(kind tokenKind, text string) error {
+	tok := parser.next()
+	if tok.kind != kind {
+		return fmt.Errorf("expected %q at offset %d, got %s", text, tok.pos, tok)
+	}
+	return nil
+}
+
+func (parser *parser) parseOr() (node, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := parser.acceptOperator("||"); !ok {
+			return left, nil
+		}
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+}
+
+func (parser *parser) parseAnd() (node, error) {
+	left, err := parser.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := parser.acceptOperator("&&"); !ok {
+			return left, nil
+		}
+		right, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+}
+
+func (parser *parser) parseNot() (node, error) {
+	if _, ok := parser.acceptOperator("!"); ok {
+		operand, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return parser.parseComparison()
+}
+
+func (parser *parser) parseComparison() (node, error) {
+	left, err := parser.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := parser.acceptOperator("==", "!=", "<=", ">=", "<", ">", "=~", "!~")
+	if !ok {
+		return left, nil
+	}
+	right, err := parser.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if op == "=~" || op == "!~" {
+		match := &matchNode{negate: op == "!~", left: left, right: right}
+		// Compile literal patterns now, so invalid patterns are reported when config is loaded
+		if literal, ok := right.(*literalNode); ok && literal.value.kind == stringValue {
+			match.pattern, err = regexp.Compile(literal.value.s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %q: %w", literal.value.s, err)
+			}
+		}
+		return match, nil
+	}
+	return &compareNode{op: op, left: left, right: right}, nil
+}
+
+func (parser *parser) parseAdditive() (node, error) {
+	left, err := parser.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := parser.acceptOperator("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := parser.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithmeticNode{op: op, left: left, right: right}
+	}
+}
+
+func (parser *parser) parsePrimary() (node, error) {
+	tok := parser.next()
+	switch tok.kind {
+	case tokenString:
+		return &literalNode{value: value{kind: stringValue, s: tok.text}}, nil
+	case tokenNumber:
+		n, _ := strconv.ParseFloat(tok.text, 64)
+		return &literalNode{value: value{kind: numberValue, n: n}}, nil
+	case tokenDuration:
+		d, _ := parseDuration(tok.text)
+		return &literalNode{value: value{kind: durationValue, d: d}}, nil
+	case tokenLParen:
+		inner, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.expect(tokenRParen, ")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	case tokenIdent:
+		return parser.parseIdent(tok)
+	}
+	return nil, fmt.Errorf("unexpected %s at offset %d", tok, tok.pos)
+}
+
+func (parser *parser) parseIdent(tok token) (node, error) {
+	switch tok.text {
+	case "true", "false":
+		return &literalNode{value: value{kind: boolValue, b: tok.text == "true"}}, nil
+	case "null":
+		return &literalNode{value: value{kind: nullValue}}, nil
+	case "now":
+		if err := parser.expect(tokenLParen, "("); err != nil {
+			return nil, err
+		}
+		if err := parser.expect(tokenRParen, ")"); err != nil {
+			return nil, err
+		}
+		return &nowNode{}, nil
+	case "labels", "annotations":
+		var key string
+		switch next := parser.next(); next.kind {
+		case tokenDot:
+			name := parser.next()
+			if name.kind != tokenIdent || name.text == "" {
+				return nil, fmt.Errorf("expected a key after %s. at offset %d, got %s", tok.text, name.pos, name)
+			}
+			key = name.text
+		case tokenLBracket:
+			name := parser.next()
+			if name.kind != tokenString {
+				return nil, fmt.Errorf("expected a quoted key after %s[ at offset %d, got %s", tok.text, name.pos, name)
+			}
+			key = name.text
+			if err := parser.expect(tokenRBracket, "]"); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("expected . or [ after %s at offset %d, got %s", tok.text, next.pos, next)
+		}
+		return &fieldNode{key: tok.text + "." + key}, nil
+	}
+	if parser.peek().kind == tokenLParen {
+		return nil, fmt.Errorf("unknown function %q at offset %d", tok.text, tok.pos)
+	}
+	if err := validateFieldKey(tok.text); err != nil {
+		return nil, fmt.Errorf("%s at offset %d", err, tok.pos)
+	}
+	return &fieldNode{key: tok.text}, nil
+}
+
+// Values
+
+type valueKind int
+
+const (
+	nullValue valueKind = iota
+	boolValue
+	stringValue
+	numberValue
+	timeValue
+	durationValue
+)
+
+func (kind valueKind) String() string {
+	return [...]string{"null", "boolean", "string", "number", "time", "duration"}[kind]
+}
+
+type value struct {
+	kind valueKind
+	b    bool
+	s    string
+	n    float64
+	t    time.Time
+	d    time.Duration
+}
+
+func (v value) truthy() bool {
+	switch v.kind {
+	case boolValue:
+		return v.b
+	case stringValue:
+		return v.s == "true"
+	}
+	return false
+}
+
+// Time formats accepted when comparing strings to times: RFC 3339, used by the ec2 provider, and the format of
+// time.Time.String, used by the ecs provider.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999 -0700 MST"}
+
+// Converts a string to kind, so it can be compared to or combined with a value of that kind.
+func (v value) as(kind valueKind) (value, error) {
+	if v.kind == kind || v.kind != stringValue {
+		return v, nil
+	}
+	switch kind {
+	case timeValue:
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, v.s); err == nil {
+				return value{kind: timeValue, t: t}, nil
+			}
+		}
+		return v, fmt.Errorf("%q is not a time", v.s)
+	case numberValue:
+		n, err := strconv.ParseFloat(v.s, 64)
+		if err != nil {
+			return v, fmt.Errorf("%q is not a number", v.s)
+		}
+		return value{kind: numberValue, n: n}, nil
+	case durationValue:
+		d, err := parseDuration(v.s)
+		if err != nil {
+			return v, err
+		}
+		return value{kind: durationValue, d: d}, nil
+	case boolValue:
+		return value{kind: boolValue, b: v.s == "true"}, nil
+	}
+	return v, nil
+}
+
+// Converts a and b to a common kind, parsing strings if the other value isn't one.
+func coerce(a, b value) (value, value, error) {
+	var err error
+	if a.kind == stringValue && b.kind != stringValue && b.kind != nullValue {
+		a, err = a.as(b.kind)
+	} else if b.kind == stringValue && a.kind != stringValue && a.kind != nullValue {
+		b, err = b.as(a.kind)
+	}
+	return a, b, err
+}
+
+// Returns -1, 0 or 1, comparing a to b, which must have the same kind.
+func compareValues(a, b value) (int, error) {
+	if a.kind != b.kind {
+		return 0, fmt.Errorf("can't compare %s to %s", a.kind, b.kind)
+	}
+	switch a.kind {
+	case nullValue:
+		return 0, nil
+	case boolValue:
+		// Booleans are unordered, see compareNode
+		if a.b == b.b {
+			return 0, nil
+		}
+		return 1, nil
+	case stringValue:
+		return strings.Compare(a.s, b.s), nil
+	case numberValue:
+		return compareOrdered(a.n < b.n, a.n > b.n), nil
+	case timeValue:
+		return compareOrdered(a.t.Before(b.t), a.t.After(b.t)), nil
+	case durationValue:
+		return compareOrdered(a.d < b.d, a.d > b.d), nil
+	}
+	return 0, nil
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// Nodes
+
+type evalContext struct {
+	prompt *Prompt
+	now    time.Time
+}
+
+type node interface {
+	eval(ctx *evalContext) (value, error)
+}
+
+type literalNode struct {
+	value value
+}
+
+func (n *literalNode) eval(ctx *evalContext) (value, error) {
+	return n.value, nil
+}
+
+type nowNode struct{}
+
+func (n *nowNode) eval(ctx *evalContext) (value, error) {
+	return value{kind: timeValue, t: ctx.now}, nil
+}
+
+type fieldNode struct {
+	key string
+}
+
+func (n *fieldNode) eval(ctx *evalContext) (value, error) {
+	s, ok := ctx.prompt.field(n.key)
+	if !ok {
+		return value{kind: nullValue}, nil
+	}
+	return value{kind: stringValue, s: s}, nil
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) eval(ctx *evalContext) (value, error) {
+	v, err := n.operand.eval(ctx)
+	if err != nil {
+		return v, err
+	}
+	return value{kind: boolValue, b: !v.truthy()}, nil
+}
+
+type logicalNode struct {
+	op          string
+	left, right node
+}
+
+func (n *logicalNode) eval(ctx *evalContext) (value, error) {
+	left, err := n.left.eval(ctx)
+	if err != nil {
+		return left, err
+	}
+	if n.op == "&&" && !left.truthy() || n.op == "||" && left.truthy() {
+		return value{kind: boolValue, b: left.truthy()}, nil
+	}
+	right, err := n.right.eval(ctx)
+	if err != nil {
+		return right, err
+	}
+	return value{kind: boolValue, b: right.truthy()}, nil
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n *compareNode) eval(ctx *evalContext) (value, error) {
+	left, err := n.left.eval(ctx)
+	if err != nil {
+		return left, err
+	}
+	right, err := n.right.eval(ctx)
+	if err != nil {
+		return right, err
+	}
+	if left.kind == nullValue || right.kind == nullValue {
+		equal := left.kind == right.kind
+		switch n.op {
+		case "==":
+			return value{kind: boolValue, b: equal}, nil
+		case "!=":
+			return value{kind: boolValue, b: !equal}, nil
+		}
+		return value{kind: boolValue}, nil
+	}
+	left, right, err = coerce(left, right)
+	if err != nil {
+		return value{}, err
+	}
+	if left.kind == boolValue && n.op != "==" && n.op != "!=" {
+		return value{}, fmt.Errorf("booleans can only be compared with == and !=")
+	}
+	cmp, err := compareValues(left, right)
+	if err != nil {
+		return value{}, err
+	}
+	var result bool
+	switch n.op {
+	case "==":
+		result = cmp == 0
+	case "!=":
+		result = cmp != 0
+	case "<":
+		result = cmp < 0
+	case "<=":
+		result = cmp <= 0
+	case ">":
+		result = cmp > 0
+	case ">=":
+		result = cmp >= 0
+	}
+	return value{kind: boolValue, b: result}, nil
+}
+
+type matchNode struct {
+	negate      bool
+	left, right node
+	pattern     *regexp.Regexp // Compiled when parsed, if right is a literal
+}
+
+func (n *matchNode) eval(ctx *evalContext) (value, error) {
+	left, err := n.left.eval(ctx)
+	if err != nil {
+		return left, err
+	}
+	pattern := n.pattern
+	if pattern == nil {
+		right, err := n.right.eval(ctx)
+		if err != nil {
+			return right, err
+		}
+		if right.kind != stringValue {
+			return value{}, fmt.Errorf("regular expressions must be strings, got %s", right.kind)
+		}
+		pattern, err = regexp.Compile(right.s)
+		if err != nil {
+			return value{}, fmt.Errorf("invalid regular expression %q: %w", right.s, err)
+		}
+	}
+	matched := left.kind == stringValue && pattern.MatchString(left.s)
+	return value{kind: boolValue, b: matched != n.negate}, nil
+}
+
+type arithmeticNode struct {
+	op          string
+	left, right node
+}
+
+func (n *arithmeticNode) eval(ctx *evalContext) (value, error) {
+	left, err := n.left.eval(ctx)
+	if err != nil {
+		return left, err
+	}
+	right, err := n.right.eval(ctx)
+	if err != nil {
+		return right, err
+	}
+	if left.kind == nullValue || right.kind == nullValue {
+		return value{kind: nullValue}, nil
+	}
+	// A string combined with a duration is a time, like annotations.launchTime + 7d
+	if left.kind == stringValue && right.kind == durationValue {
+		if left, err = left.as(timeValue); err != nil {
+			return value{}, err
+		}
+	}
+	if left, right, err = coerce(left, right); err != nil {
+		return value{}, err
+	}
+	sign := 1
+	if n.op == "-" {
+		sign = -1
+	}
+	switch {
+	case left.kind == timeValue && right.kind == durationValue:
+		return value{kind: timeValue, t: left.t.Add(time.Duration(sign) * right.d)}, nil
+	case left.kind == timeValue && right.kind == timeValue && n.op == "-":
+		return value{kind: durationValue, d: left.t.Sub(right.t)}, nil
+	case left.kind == durationValue && right.kind == durationValue:
+		return value{kind: durationValue, d: left.d + time.Duration(sign)*right.d}, nil
+	case left.kind == numberValue && right.kind == numberValue:
+		return value{kind: numberValue, n: left.n + float64(sign)*right.n}, nil
+	}
+	return value{}, fmt.Errorf("can't %s %s and %s", map[string]string{"+": "add", "-": "subtract"}[n.op], left.kind, right.kind)
+}
@@ -0,0 +1,156 @@
+package v1alpha_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cased/jump/providers"
+	jump "github.com/cased/jump/types/v1alpha"
+)
+
+func TestExpressionMatches(t *testing.T) {
+	now := time.Date(2022, time.December, 1, 0, 0, 0, 0, time.UTC)
+	featured := true
+	prompt := &jump.Prompt{
+		Name:     "app-1",
+		Hostname: "app-1.example.com",
+		Port:     "2222",
+		Featured: &featured,
+		Labels: map[string]string{
+			"env":                           "prod",
+			"vpc-id":                        "vpc-1234",
+			"tag:aws:autoscaling:groupName": "prod-app",
+		},
+		Annotations: map[string]string{
+			"launchTime": "2022-11-20T00:00:00Z",
+			"startedAt":  "2022-11-30 12:00:00 +0000 UTC",
+		},
+	}
+	tests := []struct {
+		Expression string
+		Want       bool
+	}{
+		{`labels.env == "prod"`, true},
+		{`labels.env != "canary"`, true},
+		{`labels.vpc-id == "vpc-1234"`, true},
+		{`labels.tag:aws:autoscaling:groupName == "prod-app"`, true},
+		{`labels["tag:aws:autoscaling:groupName"] =~ "^prod-"`, true},
+		{`name =~ "^app-[0-9]+$"`, true},
+		{`hostname !~ "staging"`, true},
+		{`featured`, true},
+		{`featured == true`, true},
+		{`!featured`, false},
+		{`port > 1024`, true},
+		{`port >= 2223`, false},
+		{`annotations.launchTime < now() - 7d`, true},
+		{`annotations.launchTime < now() - 2w`, false},
+		{`annotations.startedAt > now() - 13h`, true},
+		{`now() - annotations.launchTime > 10d`, true},
+		{`annotations.launchTime + 1w1d < now()`, true},
+		{`annotations.launchTime + 1w4d < now()`, false},
+		{`annotations.launchTime < now() - 7d && labels.env != "canary"`, true},
+		{`labels.env == "canary" || (labels.env == "prod" && !(port == 22))`, true},
+		{`labels.missing == null`, true},
+		{`labels.missing != "x"`, true},
+		{`labels.missing == "x"`, false},
+		{`labels.missing < now()`, false},
+		{`labels.missing =~ "."`, false},
+		{`labels.missing !~ "."`, true},
+		{`description`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.Expression, func(t *testing.T) {
+			expression, err := jump.ParseExpression(test.Expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := expression.Matches(prompt, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.Want {
+				t.Errorf("got %v, want %v", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	prompt := &jump.Prompt{Name: "app", Labels: map[string]string{"env": "prod"}}
+	parseErrors := []struct {
+		Expression string
+		Want       string
+	}{
+		{`labels.env ==`, "unexpected end of expression"},
+		{`labels.env == "prod`, "unterminated string"},
+		{`labels.env = "prod"`, `unexpected '='`},
+		{`labels.`, "expected a key after labels."},
+		{`hostnme == "x"`, `unknown prompt field "hostnme"`},
+		{`principals == "x"`, `prompt field "principals" can't be used here`},
+		{`ago(7d)`, `unknown function "ago"`},
+		{`name =~ "("`, "invalid regular expression"},
+		{`launchTime < now() - 7x`, `invalid number or duration "7x"`},
+		{`(name == "app"`, `expected ")"`},
+		{`name == "app" name`, `unexpected "name"`},
+	}
+	for _, test := range parseErrors {
+		t.Run(test.Expression, func(t *testing.T) {
+			_, err := jump.ParseExpression(test.Expression)
+			if err == nil || !strings.Contains(err.Error(), test.Want) {
+				t.Errorf("got error %v, want %q", err, test.Want)
+			}
+		})
+	}
+
+	evalErrors := []struct {
+		Expression string
+		Want       string
+	}{
+		{`labels.env < now()`, `"prod" is not a time`},
+		{`labels.env > 3`, `"prod" is not a number`},
+		{`now() + now()`, "can't add time and time"},
+		{`(name == "app") < true`, "booleans can only be compared with == and !="},
+	}
+	for _, test := range evalErrors {
+		t.Run(test.Expression, func(t *testing.T) {
+			expression, err := jump.ParseExpression(test.Expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = expression.Matches(prompt, time.Now())
+			if err == nil || !strings.Contains(err.Error(), test.Want) {
+				t.Errorf("got error %v, want %q", err, test.Want)
+			}
+		})
+	}
+}
+
+func TestQueryWhere(t *testing.T) {
+	providers.Register()
+	defer jump.SetNow(time.Date(2022, time.December, 1, 0, 0, 0, 0, time.UTC))()
+	config, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/where/config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := config.DiscoverManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"old-prod"}
+	if got := promptNames(manifest.Prompts); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	wantWarnings := []string{
+		`testdata/where/config.yaml:27: where: static bad-time (bad-time.example.com): "yesterday" is not a time`,
+	}
+	if !reflect.DeepEqual(manifest.Warnings, wantWarnings) {
+		t.Errorf("got warnings %q, want %q", manifest.Warnings, wantWarnings)
+	}
+
+	_, err = jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/where/invalid.yaml"})
+	if err == nil || !strings.Contains(err.Error(), `testdata/where/invalid.yaml:2: where: unknown prompt field "env"`) {
+		t.Errorf("expected an invalid where error, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package v1alpha
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Prompt fields are referenced by key in sorting options: either the JSON name of a text or boolean field, like
+// `name` or `featured`, or a single label or annotation, like `labels.environment` or `annotations.launchTime`.
+
+// Returns the value of the Prompt field named by key, and whether it is set.
+func (p *Prompt) field(key string) (string, bool) {
+	if name, ok := cutPrefix(key, "labels."); ok {
+		value, ok := p.Labels[name]
+		return value, ok
+	}
+	if name, ok := cutPrefix(key, "annotations."); ok {
+		value, ok := p.Annotations[name]
+		return value, ok
+	}
+	i := promptFieldIndexByJSONName(key)
+	if i == -1 {
+		return "", false
+	}
+	v := reflect.ValueOf(p).Elem().Field(i)
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), v.String() != ""
+	case reflect.Ptr:
+		if v.IsNil() {
+			return "", false
+		}
+		return strconv.FormatBool(v.Elem().Bool()), true
+	}
+	return "", false
+}
+
+// Returns an error if key doesn't name a Prompt field that can be used for sorting.
+func validateFieldKey(key string) error {
+	for _, prefix := range []string{"labels.", "annotations."} {
+		if name, ok := cutPrefix(key, prefix); ok {
+			if name == "" {
+				return fmt.Errorf("%q is missing a key", key)
+			}
+			return nil
+		}
+	}
+	i := promptFieldIndexByJSONName(key)
+	if i == -1 {
+		return fmt.Errorf("unknown prompt field %q", key)
+	}
+	switch reflect.TypeOf(Prompt{}).Field(i).Type {
+	case reflect.TypeOf(""), reflect.TypeOf(new(bool)):
+		return nil
+	}
+	return fmt.Errorf("prompt field %q can't be used here", key)
+}
+
+// Returns the index of the Prompt field with the given JSON name, or -1.
+func promptFieldIndexByJSONName(name string) int {
+	t := reflect.TypeOf(Prompt{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if jsonName := strings.Split(field.Tag.Get("json"), ",")[0]; jsonName == name && jsonName != "-" {
+			return i
+		}
+	}
+	return -1
+}
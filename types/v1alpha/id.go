@@ -0,0 +1,43 @@
+package v1alpha
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Returns a deterministic id for a Prompt, derived from the name of the Provider that created it, the identity of
+// the query that produced it, and the identity of the discovered resource, e.g. an EC2 instance id.
+//
+// Ids are stable across discovery cycles and jump restarts for as long as all three inputs stay the same:
+//
+//   - The identity of a query is its name. Unnamed queries are identified by a hash of their config, so editing an
+//     unnamed query, for example changing its description, changes the ids of its Prompts. Name queries to keep ids
+//     stable across edits.
+//   - The identity of a resource is chosen by each Provider, and documented alongside it. A new resource, like a
+//     replacement EC2 instance or a restarted ECS task, gets a new id.
+//
+// Ids are opaque: consumers should only compare them for equality.
+func PromptID(provider string, query *PromptQuery, resource ...string) string {
+	hash := sha256.New()
+	for _, part := range append([]string{provider, query.identity()}, resource...) {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return provider + "-" + hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// Returns the name of the query, or a hash of its config if it has none.
+func (query *PromptQuery) identity() string {
+	if query.Name != "" {
+		return "name:" + query.Name
+	}
+	// Maps are marshaled with sorted keys, so this is deterministic. Empty fields are omitted, so adding new query
+	// fields doesn't change the ids of existing queries.
+	config, err := json.Marshal(query)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(config)
+	return "config:" + hex.EncodeToString(sum[:])
+}
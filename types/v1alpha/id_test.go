@@ -0,0 +1,31 @@
+package v1alpha_test
+
+import (
+	"testing"
+
+	jump "github.com/cased/jump/types/v1alpha"
+)
+
+func TestPromptID(t *testing.T) {
+	named := &jump.PromptQuery{Name: "bastions", Provider: "ec2", Prompt: &jump.Prompt{Description: "Bastion"}}
+	renamed := &jump.PromptQuery{Name: "bastions", Provider: "ec2", Prompt: &jump.Prompt{Description: "Bastion host"}}
+	unnamed := &jump.PromptQuery{Provider: "ec2", Prompt: &jump.Prompt{Description: "Bastion"}}
+	edited := &jump.PromptQuery{Provider: "ec2", Prompt: &jump.Prompt{Description: "Bastion host"}}
+
+	id := jump.PromptID("ec2", named, "i-12345678")
+	if id != jump.PromptID("ec2", named, "i-12345678") {
+		t.Error("Expected ids to be deterministic")
+	}
+	if id != jump.PromptID("ec2", renamed, "i-12345678") {
+		t.Error("Expected editing a named query to keep ids stable")
+	}
+	if id == jump.PromptID("ec2", named, "i-9101112") {
+		t.Error("Expected different resources to have different ids")
+	}
+	if jump.PromptID("ec2", unnamed, "i-12345678") == jump.PromptID("ec2", edited, "i-12345678") {
+		t.Error("Expected editing an unnamed query to change ids")
+	}
+	if jump.PromptID("ecs", named, "task", "a/b") == jump.PromptID("ecs", named, "task/a", "b") {
+		t.Error("Expected resource parts to be delimited")
+	}
+}
@@ -0,0 +1,128 @@
+package v1alpha
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The result of interpolating a config file.
+type interpolation struct {
+	data       []byte
+	references []string // The references that were expanded, e.g. `${DB_HOST}`. Safe to log.
+	values     []string // The values that were substituted. Never log these.
+}
+
+// Expands references in the contents of a config file before it is decoded:
+//
+//   - ${VAR} is replaced with the value of the environment variable VAR. It is an error if VAR is unset or empty.
+//   - ${VAR:-default} is replaced with the value of VAR, or with default if VAR is unset or empty.
+//   - ${file:/path} is replaced with the contents of the file at path, without trailing newlines. Relative paths are
+//     resolved against dir, the directory of the config file.
+//   - $${ is replaced with a literal ${.
+//
+// Comment lines, whose first non-blank character is #, are copied unchanged, so commenting out a line also disables
+// its references. Comments at the end of a line are interpolated like the rest of the line.
+//
+// Values are substituted verbatim, so they must be valid in the position they appear in the YAML or JSON document.
+func interpolate(data []byte, dir string) (*interpolation, error) {
+	result := &interpolation{}
+	var out bytes.Buffer
+	for i := 0; i < len(data); i++ {
+		if (i == 0 || data[i-1] == '\n') && bytes.HasPrefix(bytes.TrimLeft(data[i:], " \t"), []byte("#")) {
+			end := bytes.IndexByte(data[i:], '\n')
+			if end == -1 {
+				end = len(data) - i - 1
+			}
+			out.Write(data[i : i+end+1])
+			i += end
+			continue
+		}
+		if bytes.HasPrefix(data[i:], []byte("$${")) {
+			out.WriteString("${")
+			i += 2
+			continue
+		}
+		if !bytes.HasPrefix(data[i:], []byte("${")) {
+			out.WriteByte(data[i])
+			continue
+		}
+		end := bytes.IndexByte(data[i:], '}')
+		if end == -1 {
+			return nil, fmt.Errorf("line %d: unterminated ${", lineAt(data, i))
+		}
+		reference := string(data[i : i+end+1])
+		value, err := resolveReference(reference[2:len(reference)-1], dir)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", lineAt(data, i), reference, err)
+		}
+		out.WriteString(value)
+		result.references = append(result.references, reference)
+		if value != "" {
+			result.values = append(result.values, value)
+		}
+		i += end
+	}
+	result.data = out.Bytes()
+	return result, nil
+}
+
+func resolveReference(expression, dir string) (string, error) {
+	if path, ok := cutPrefix(expression, "file:"); ok {
+		if path == "" {
+			return "", fmt.Errorf("missing file path")
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			// Only report the error kind: the path is already in the reference
+			if os.IsNotExist(err) {
+				return "", fmt.Errorf("file does not exist")
+			}
+			return "", fmt.Errorf("could not read file")
+		}
+		return strings.TrimRight(string(contents), "\r\n"), nil
+	}
+
+	name, fallback, hasDefault := strings.Cut(expression, ":-")
+	if name == "" {
+		return "", fmt.Errorf("missing variable name")
+	}
+	if value := os.Getenv(name); value != "" {
+		return value, nil
+	}
+	if hasDefault {
+		return fallback, nil
+	}
+	return "", fmt.Errorf("undefined variable %s", name)
+}
+
+// Replaces every substituted value in err's message, so decoding errors don't leak secrets.
+func (i *interpolation) redact(err error) error {
+	if err == nil || len(i.values) == 0 {
+		return err
+	}
+	message := err.Error()
+	for _, value := range i.values {
+		message = strings.ReplaceAll(message, value, "[REDACTED]")
+	}
+	return fmt.Errorf("%s", message)
+}
+
+// Returns the 1-based line number of the byte at offset.
+func lineAt(data []byte, offset int) int {
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// strings.CutPrefix is only available in Go 1.20 and up.
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
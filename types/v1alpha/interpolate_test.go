@@ -0,0 +1,109 @@
+package v1alpha_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cased/jump/providers"
+	jump "github.com/cased/jump/types/v1alpha"
+)
+
+func TestConfigInterpolation(t *testing.T) {
+	providers.Register()
+	t.Setenv("JUMP_TEST_REGION", "us-west-2")
+	t.Setenv("JUMP_TEST_GROUP", "")
+
+	config, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/interpolate/config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := config.Queries[0]
+	tests := []struct {
+		Name string
+		Got  string
+		Want string
+	}{
+		{"variable", query.Filters["region"], "us-west-2"},
+		{"default", query.Filters["tag:aws:autoscaling:groupName"], "*bastion*"},
+		{"file", query.Prompt.Hostname, "bastion.internal.example.com"},
+		{"escape", query.Prompt.ShellCommand, "echo ${HOME}"},
+	}
+	for _, test := range tests {
+		if test.Got != test.Want {
+			t.Errorf("%s: got %q, want %q", test.Name, test.Got, test.Want)
+		}
+	}
+}
+
+func TestConfigInterpolationUndefinedVariable(t *testing.T) {
+	providers.Register()
+	_, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/interpolate/undefined.yaml"})
+	if err == nil {
+		t.Fatal("Expected error due to undefined variable")
+	}
+	if !strings.Contains(err.Error(), "JUMP_TEST_UNDEFINED") {
+		t.Errorf("Expected error to name the undefined variable, got %q", err)
+	}
+}
+
+func TestConfigInterpolationRedactsValues(t *testing.T) {
+	providers.Register()
+	t.Setenv("JUMP_TEST_SECRET", "hunter2")
+	_, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/interpolate/secret_limit.yaml"})
+	if err == nil {
+		t.Fatal("Expected error due to invalid limit")
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("Expected interpolated value to be redacted, got %q", err)
+	}
+}
+
+func TestConfigInterpolationRedactsValidationProblems(t *testing.T) {
+	providers.Register()
+	t.Setenv("JUMP_TEST_SECRET", "hunter2")
+	_, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/interpolate/secret_option.yaml"})
+	if err == nil {
+		t.Fatal("Expected error due to invalid option")
+	}
+	want := `option status-checks must be one of ignore, annotate, exclude, got "[REDACTED]"`
+	if strings.Contains(err.Error(), "hunter2") || !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected error to contain %q, got %q", want, err)
+	}
+}
+
+func TestConfigInterpolationSkipsComments(t *testing.T) {
+	providers.Register()
+	t.Setenv("JUMP_TEST_REGION", "us-west-2")
+	config, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/interpolate/comments.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Queries[0].Filters["region"]; got != "us-west-2" {
+		t.Errorf("got region %q, want %q", got, "us-west-2")
+	}
+}
+
+func TestConfigHashExcludesInterpolatedValues(t *testing.T) {
+	providers.Register()
+	hashes := map[string]string{}
+	for _, region := range []string{"us-west-2", "eu-west-1"} {
+		t.Setenv("JUMP_TEST_REGION", region)
+		config, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/interpolate/config.yaml"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[region] = config.Hash()
+	}
+	// The hash is published in the manifest, so values that may be secrets can't be guessed against it
+	if hashes["us-west-2"] != hashes["eu-west-1"] {
+		t.Errorf("expected the hash not to depend on interpolated values, got %q and %q", hashes["us-west-2"], hashes["eu-west-1"])
+	}
+
+	config, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/interpolate/comments.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash := config.Hash(); hash == hashes["us-west-2"] || !strings.HasPrefix(hash, "sha256:") {
+		t.Errorf("expected a different sha256 hash for another config, got %q", hash)
+	}
+}
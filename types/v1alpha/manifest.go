@@ -0,0 +1,128 @@
+package v1alpha
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+const (
+	ManifestAPIVersion = "jump.cased.com/v1alpha"
+	ManifestKind       = "AutoDiscoveryManifest"
+)
+
+// The version of jump, written to each manifest. Set at build time with
+// `-ldflags "-X github.com/cased/jump/types/v1alpha.Version=..."`.
+var Version = "dev"
+
+// Returns the current time. Replaced in tests.
+var now = time.Now
+
+// Returns a manifest for a list of Prompts, generated now. The Prompts are kept in the order given.
+func NewAutoDiscoveryManifest(prompts []*Prompt) *AutoDiscoveryManifest {
+	if prompts == nil {
+		prompts = []*Prompt{}
+	}
+	manifest := &AutoDiscoveryManifest{
+		APIVersion:  ManifestAPIVersion,
+		Kind:        ManifestKind,
+		GeneratedAt: now().UTC().Truncate(time.Second),
+		JumpVersion: Version,
+		Prompts:     prompts,
+	}
+	manifest.Checksum = manifest.computeChecksum()
+	return manifest
+}
+
+func (manifest *AutoDiscoveryManifest) computeChecksum() string {
+	data, err := json.Marshal(manifest.Prompts)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Returns true if the manifest's Checksum matches its Prompts.
+func (manifest *AutoDiscoveryManifest) Verify() bool {
+	return manifest.Checksum == manifest.computeChecksum()
+}
+
+// Returns the summaries of the queries whose Provider returned an error, in the order queries were loaded.
+func (manifest *AutoDiscoveryManifest) FailedQueries() []*QuerySummary {
+	var failed []*QuerySummary
+	for _, summary := range manifest.Queries {
+		if summary.Error != "" {
+			failed = append(failed, summary)
+		}
+	}
+	return failed
+}
+
+// Returns the JSON-encoded manifest.
+func (manifest *AutoDiscoveryManifest) Marshal() ([]byte, error) {
+	return json.MarshalIndent(manifest, "", " ")
+}
+
+func (manifest *AutoDiscoveryManifest) WriteToPath(path string) error {
+	file, err := manifest.Marshal()
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(path, file, 0644)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func WriteAutoDiscoveryManifestToPath(prompts []*Prompt, path string) error {
+	return NewAutoDiscoveryManifest(prompts).WriteToPath(path)
+}
+
+// Returns the JSON-encoded manifest for a list of Prompts, in the order given.
+func MarshalAutoDiscoveryManifest(prompts []*Prompt) ([]byte, error) {
+	return NewAutoDiscoveryManifest(prompts).Marshal()
+}
+
+// Reads a manifest previously written by jump. Manifests written before the envelope was introduced only have Prompts.
+func ReadAutoDiscoveryManifestFromPath(path string) (*AutoDiscoveryManifest, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &AutoDiscoveryManifest{}
+	err = json.Unmarshal(file, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// Returns a hash of the loaded config files, including those loaded by includes. The hash is published in the
+// manifest, so it covers each file as written, before interpolation, and the names of the variables and files it
+// references, never their values, which may be secrets. It doesn't change when only the value of a reference does.
+// Configs that weren't loaded from files are hashed as they are.
+func (config *AutoDiscoveryConfig) Hash() string {
+	hash := sha256.New()
+	if len(config.sources) == 0 {
+		// Maps are marshaled with sorted keys, so this is deterministic
+		data, err := json.Marshal(config)
+		if err != nil {
+			return ""
+		}
+		hash.Write(data)
+	}
+	for _, source := range config.sources {
+		// Lengths are written first, so the boundaries between files are part of the hash
+		fmt.Fprintf(hash, "%d\n", len(source.data))
+		hash.Write(source.data)
+		fmt.Fprintf(hash, "%d\n%s\n", len(source.references), strings.Join(source.references, "\n"))
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,69 @@
+package v1alpha_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	jump "github.com/cased/jump/types/v1alpha"
+)
+
+// Only checks property names, as there's no JSON Schema validator in our dependencies.
+func TestManifestSchemaMatchesTypes(t *testing.T) {
+	data, err := ioutil.ReadFile("manifest.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type object struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	schema := struct {
+		object
+		Defs map[string]object `json:"$defs"`
+	}{}
+	err = json.Unmarshal(data, &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name       string
+		Type       reflect.Type
+		Properties map[string]json.RawMessage
+		Skip       string
+	}{
+		{"manifest", reflect.TypeOf(jump.AutoDiscoveryManifest{}), schema.Properties, ""},
+		{"querySummary", reflect.TypeOf(jump.QuerySummary{}), schema.Defs["querySummary"].Properties, ""},
+		{"prompt", reflect.TypeOf(jump.Prompt{}), schema.Defs["prompt"].Properties, "unset"}, // Only used in templates
+	}
+	for _, test := range tests {
+		fields := map[string]bool{}
+		for i := 0; i < test.Type.NumField(); i++ {
+			name := strings.Split(test.Type.Field(i).Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" || name == test.Skip {
+				continue
+			}
+			fields[name] = true
+			if _, ok := test.Properties[name]; !ok {
+				t.Errorf("%s: %s is missing from manifest.schema.json", test.Name, name)
+			}
+		}
+		for name := range test.Properties {
+			if !fields[name] {
+				t.Errorf("%s: %s is in manifest.schema.json, but not in %s", test.Name, name, test.Type.Name())
+			}
+		}
+	}
+}
+
+func TestReadLegacyManifest(t *testing.T) {
+	manifest, err := jump.ReadAutoDiscoveryManifestFromPath("testdata/legacy_manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Prompts) != 1 || manifest.Prompts[0].Hostname != "example.com" {
+		t.Errorf("Expected one prompt for example.com, got %+v", manifest.Prompts)
+	}
+}
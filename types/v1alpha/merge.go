@@ -0,0 +1,139 @@
+package v1alpha
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Merges any fields provided in the query's Prompt template with fields returned by their respective searches.
+// Each Provider is expected to call this function at the right time for their use case.
+//
+// Every exported field of the template is merged according to its type, so new Prompt fields are handled without
+// changes to this function:
+//
+//   - Strings override the discovered value when non-empty.
+//   - Tri-state booleans (*bool) override the discovered value when set, so `featured: false` clears a provider's `true`.
+//   - Slices and maps override the discovered value when non-nil, unless the field is tagged `merge:"keys"`.
+//   - Maps tagged `merge:"keys"` (Labels and Annotations) are merged key by key, with the template winning on conflicts.
+//   - Fields tagged `merge:"-"` (Provider, Unset) are never copied from the template.
+//   - Fields of any other kind are never copied from the template. A test checks that no Prompt field is left out.
+//
+// Because empty values mean "not set", a template can't clear a field by leaving it blank. Instead, list the field
+// in the template's `unset` key, using its YAML name (`jumpCommand`) or a single label or annotation
+// (`labels.region`, `annotations.startedAt`). Unset is applied after merging.
+func (p *Prompt) DecorateWithQuery(query *PromptQuery) *Prompt {
+	p = PromptWithDefaults(p)
+	if query.Prompt != nil {
+		mergePrompt(p, query.Prompt)
+		unsetPromptFields(p, query.Prompt.Unset)
+	}
+	return p
+}
+
+// Copies every set field of src onto dst, following the rules documented on DecorateWithQuery.
+func mergePrompt(dst, src *Prompt) {
+	dv := reflect.ValueOf(dst).Elem()
+	sv := reflect.ValueOf(src).Elem()
+	t := sv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("merge") == "-" || !hasMergeRule(field.Type.Kind()) {
+			continue
+		}
+		s, d := sv.Field(i), dv.Field(i)
+		switch field.Type.Kind() {
+		case reflect.String:
+			if s.String() != "" {
+				d.SetString(s.String())
+			}
+		case reflect.Ptr:
+			if !s.IsNil() {
+				v := reflect.New(field.Type.Elem())
+				v.Elem().Set(s.Elem())
+				d.Set(v)
+			}
+		case reflect.Slice:
+			if !s.IsNil() {
+				d.Set(reflect.AppendSlice(reflect.MakeSlice(field.Type, 0, s.Len()), s))
+			}
+		case reflect.Map:
+			if s.IsNil() {
+				continue
+			}
+			merged := reflect.MakeMap(field.Type)
+			if field.Tag.Get("merge") == "keys" && !d.IsNil() {
+				iter := d.MapRange()
+				for iter.Next() {
+					merged.SetMapIndex(iter.Key(), iter.Value())
+				}
+			}
+			iter := s.MapRange()
+			for iter.Next() {
+				merged.SetMapIndex(iter.Key(), iter.Value())
+			}
+			d.Set(merged)
+		}
+	}
+}
+
+// Reports whether mergePrompt knows how to merge fields of the given kind.
+func hasMergeRule(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Ptr, reflect.Slice, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// Returns the index of the Prompt field with the given YAML name, or -1.
+func promptFieldIndex(name string) int {
+	t := reflect.TypeOf(Prompt{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("merge") == "-" {
+			continue
+		}
+		if strings.Split(field.Tag.Get("yaml"), ",")[0] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns an error if any of the names can't be unset.
+func validateUnset(names []string) error {
+	for _, name := range names {
+		field, key, hasKey := strings.Cut(name, ".")
+		if hasKey && key == "" {
+			return fmt.Errorf("unset: %q is missing a key", name)
+		}
+		if hasKey && field != "labels" && field != "annotations" {
+			return fmt.Errorf("unset: %q: only labels and annotations can be unset by key", name)
+		}
+		if promptFieldIndex(field) == -1 {
+			return fmt.Errorf("unset: unknown prompt field %q", field)
+		}
+	}
+	return nil
+}
+
+// Clears the named fields, or individual label and annotation keys, on p.
+func unsetPromptFields(p *Prompt, names []string) {
+	for _, name := range names {
+		field, key, hasKey := strings.Cut(name, ".")
+		if hasKey {
+			switch field {
+			case "labels":
+				delete(p.Labels, key)
+			case "annotations":
+				delete(p.Annotations, key)
+			}
+			continue
+		}
+		if i := promptFieldIndex(field); i != -1 {
+			v := reflect.ValueOf(p).Elem().Field(i)
+			v.Set(reflect.Zero(v.Type()))
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package v1alpha_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cased/jump/providers"
+	jump "github.com/cased/jump/types/v1alpha"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestDecorateWithQuery(t *testing.T) {
+	type test struct {
+		Field      string // The Prompt field this case covers
+		Name       string
+		Discovered *jump.Prompt
+		Template   *jump.Prompt
+		Want       *jump.Prompt
+	}
+	tests := []test{
+		{Field: "ID", Name: "never copied", Discovered: &jump.Prompt{ID: "ec2-1234"}, Template: &jump.Prompt{ID: "static-5678"}, Want: &jump.Prompt{ID: "ec2-1234"}},
+		{Field: "Hostname", Name: "override", Discovered: &jump.Prompt{Hostname: "a"}, Template: &jump.Prompt{Hostname: "b"}, Want: &jump.Prompt{Hostname: "b"}},
+		{Field: "Hostname", Name: "empty keeps discovered", Discovered: &jump.Prompt{Hostname: "a"}, Template: &jump.Prompt{}, Want: &jump.Prompt{Hostname: "a"}},
+		{Field: "Hostname", Name: "unset", Discovered: &jump.Prompt{Hostname: "a"}, Template: &jump.Prompt{Unset: []string{"hostname"}}, Want: &jump.Prompt{}},
+		{Field: "Username", Name: "override", Discovered: &jump.Prompt{Username: "a"}, Template: &jump.Prompt{Username: "b"}, Want: &jump.Prompt{Username: "b"}},
+		{Field: "IpAddress", Name: "override", Discovered: &jump.Prompt{IpAddress: "10.0.0.1"}, Template: &jump.Prompt{IpAddress: "10.0.0.2"}, Want: &jump.Prompt{IpAddress: "10.0.0.2"}},
+		{Field: "IpAddress", Name: "unset", Discovered: &jump.Prompt{IpAddress: "10.0.0.1"}, Template: &jump.Prompt{Unset: []string{"ipAddress"}}, Want: &jump.Prompt{}},
+		{Field: "Port", Name: "override", Discovered: &jump.Prompt{Port: "22"}, Template: &jump.Prompt{Port: "2222"}, Want: &jump.Prompt{Port: "2222"}},
+		{Field: "Name", Name: "override", Discovered: &jump.Prompt{Name: "i-1234"}, Template: &jump.Prompt{Name: "bastion"}, Want: &jump.Prompt{Name: "bastion"}},
+		{Field: "Description", Name: "override", Discovered: &jump.Prompt{}, Template: &jump.Prompt{Description: "d"}, Want: &jump.Prompt{Description: "d"}},
+		{Field: "JumpCommand", Name: "override", Discovered: &jump.Prompt{JumpCommand: "docker exec"}, Template: &jump.Prompt{JumpCommand: "sudo docker exec"}, Want: &jump.Prompt{JumpCommand: "sudo docker exec"}},
+		{Field: "JumpCommand", Name: "unset", Discovered: &jump.Prompt{JumpCommand: "docker exec"}, Template: &jump.Prompt{Unset: []string{"jumpCommand"}}, Want: &jump.Prompt{}},
+		{Field: "ShellCommand", Name: "override", Discovered: &jump.Prompt{}, Template: &jump.Prompt{ShellCommand: "./bin/rails console"}, Want: &jump.Prompt{ShellCommand: "./bin/rails console"}},
+		{Field: "ConnectCommand", Name: "override", Discovered: &jump.Prompt{ConnectCommand: "aws ssm start-session --target i-1234"}, Template: &jump.Prompt{ConnectCommand: "aws ssm start-session --target i-1234 --region us-west-2"}, Want: &jump.Prompt{ConnectCommand: "aws ssm start-session --target i-1234 --region us-west-2"}},
+		{Field: "PreDownloadCommand", Name: "unset", Discovered: &jump.Prompt{PreDownloadCommand: "docker cp"}, Template: &jump.Prompt{Unset: []string{"preDownloadCommand"}}, Want: &jump.Prompt{}},
+		{Field: "Kind", Name: "override", Discovered: &jump.Prompt{Kind: "host"}, Template: &jump.Prompt{Kind: "container"}, Want: &jump.Prompt{Kind: "container"}},
+		{Field: "Provider", Name: "never copied", Discovered: &jump.Prompt{Provider: "ec2"}, Template: &jump.Prompt{Provider: "static"}, Want: &jump.Prompt{Provider: "ec2"}},
+		{
+			Field:      "Labels",
+			Name:       "merged by key",
+			Discovered: &jump.Prompt{Labels: map[string]string{"region": "us-west-2", "app": "web"}},
+			Template:   &jump.Prompt{Labels: map[string]string{"app": "api", "environment": "prod"}},
+			Want:       &jump.Prompt{Labels: map[string]string{"region": "us-west-2", "app": "api", "environment": "prod"}},
+		},
+		{
+			Field:      "Labels",
+			Name:       "unset one key",
+			Discovered: &jump.Prompt{Labels: map[string]string{"region": "us-west-2", "app": "web"}},
+			Template:   &jump.Prompt{Unset: []string{"labels.region"}},
+			Want:       &jump.Prompt{Labels: map[string]string{"app": "web"}},
+		},
+		{
+			Field:      "Labels",
+			Name:       "unset all",
+			Discovered: &jump.Prompt{Labels: map[string]string{"region": "us-west-2"}},
+			Template:   &jump.Prompt{Labels: map[string]string{"app": "api"}, Unset: []string{"labels"}},
+			Want:       &jump.Prompt{},
+		},
+		{
+			Field:      "Annotations",
+			Name:       "merged by key",
+			Discovered: &jump.Prompt{Annotations: map[string]string{"launchTime": "2021-07-11T00:00:00Z"}},
+			Template:   &jump.Prompt{Annotations: map[string]string{"owner": "platform"}},
+			Want:       &jump.Prompt{Annotations: map[string]string{"launchTime": "2021-07-11T00:00:00Z", "owner": "platform"}},
+		},
+		{
+			Field:      "Annotations",
+			Name:       "unset one key",
+			Discovered: &jump.Prompt{Annotations: map[string]string{"launchTime": "2021-07-11T00:00:00Z", "owner": "platform"}},
+			Template:   &jump.Prompt{Unset: []string{"annotations.launchTime"}},
+			Want:       &jump.Prompt{Annotations: map[string]string{"owner": "platform"}},
+		},
+		{
+			Field:      "Principals",
+			Name:       "replaced",
+			Discovered: &jump.Prompt{Principals: []string{"eng"}},
+			Template:   &jump.Prompt{Principals: []string{"ops", "sre"}},
+			Want:       &jump.Prompt{Principals: []string{"ops", "sre"}},
+		},
+		{Field: "Featured", Name: "set", Discovered: &jump.Prompt{}, Template: &jump.Prompt{Featured: boolPtr(true)}, Want: &jump.Prompt{Featured: boolPtr(true)}},
+		{Field: "Featured", Name: "explicit false", Discovered: &jump.Prompt{Featured: boolPtr(true)}, Template: &jump.Prompt{Featured: boolPtr(false)}, Want: &jump.Prompt{Featured: boolPtr(false)}},
+		{Field: "Featured", Name: "not set keeps discovered", Discovered: &jump.Prompt{Featured: boolPtr(true)}, Template: &jump.Prompt{}, Want: &jump.Prompt{Featured: boolPtr(true)}},
+		{Field: "PromptForKey", Name: "explicit false", Discovered: &jump.Prompt{PromptForKey: boolPtr(true)}, Template: &jump.Prompt{PromptForKey: boolPtr(false)}, Want: &jump.Prompt{PromptForKey: boolPtr(false)}},
+		{Field: "PromptForKey", Name: "not set keeps discovered", Discovered: &jump.Prompt{PromptForKey: boolPtr(true)}, Template: &jump.Prompt{}, Want: &jump.Prompt{PromptForKey: boolPtr(true)}},
+		{Field: "PromptForUsername", Name: "set", Discovered: &jump.Prompt{}, Template: &jump.Prompt{PromptForUsername: boolPtr(true)}, Want: &jump.Prompt{PromptForUsername: boolPtr(true)}},
+		{Field: "CloseTerminalOnExit", Name: "explicit false", Discovered: &jump.Prompt{}, Template: &jump.Prompt{CloseTerminalOnExit: boolPtr(false)}, Want: &jump.Prompt{CloseTerminalOnExit: boolPtr(false)}},
+		{Field: "Disabled", Name: "explicit false", Discovered: &jump.Prompt{Disabled: boolPtr(true)}, Template: &jump.Prompt{Disabled: boolPtr(false)}, Want: &jump.Prompt{Disabled: boolPtr(false)}},
+		{
+			Field:      "ProxyJumpSelector",
+			Name:       "replaced",
+			Discovered: &jump.Prompt{ProxyJumpSelector: map[string]string{"app": "bastion", "zone": "a"}},
+			Template:   &jump.Prompt{ProxyJumpSelector: map[string]string{"app": "jumpbox"}},
+			Want:       &jump.Prompt{ProxyJumpSelector: map[string]string{"app": "jumpbox"}},
+		},
+		{
+			Field:      "ProxyJumpSelector",
+			Name:       "unset",
+			Discovered: &jump.Prompt{ProxyJumpSelector: map[string]string{"app": "bastion"}},
+			Template:   &jump.Prompt{Unset: []string{"proxyJumpSelector"}},
+			Want:       &jump.Prompt{},
+		},
+		{
+			Field:      "ProxyJumpMatchExpressions",
+			Name:       "replaced",
+			Discovered: &jump.Prompt{ProxyJumpMatchExpressions: []jump.LabelSelectorRequirement{{Key: "role", Operator: "Exists"}}},
+			Template:   &jump.Prompt{ProxyJumpMatchExpressions: []jump.LabelSelectorRequirement{{Key: "zone", Operator: "In", Values: []string{"a", "b"}}}},
+			Want:       &jump.Prompt{ProxyJumpMatchExpressions: []jump.LabelSelectorRequirement{{Key: "zone", Operator: "In", Values: []string{"a", "b"}}}},
+		},
+		{Field: "ProxyJumpChain", Name: "never copied", Discovered: &jump.Prompt{}, Template: &jump.Prompt{ProxyJumpChain: []string{"bastion.example.com"}}, Want: &jump.Prompt{}},
+		{Field: "RunOnProxy", Name: "never copied", Discovered: &jump.Prompt{}, Template: &jump.Prompt{RunOnProxy: true}, Want: &jump.Prompt{}},
+		{Field: "RunOnProxy", Name: "kept", Discovered: &jump.Prompt{RunOnProxy: true}, Template: &jump.Prompt{}, Want: &jump.Prompt{RunOnProxy: true}},
+		{Field: "Unset", Name: "never copied", Discovered: &jump.Prompt{}, Template: &jump.Prompt{Unset: []string{"description"}}, Want: &jump.Prompt{}},
+	}
+
+	covered := map[string]bool{}
+	for _, test := range tests {
+		covered[test.Field] = true
+		t.Run(test.Field+"/"+test.Name, func(t *testing.T) {
+			want := jump.PromptWithDefaults(test.Want)
+			got := test.Discovered.DecorateWithQuery(&jump.PromptQuery{Prompt: test.Template})
+			if !reflect.DeepEqual(got, want) {
+				t.Error(pretty.Compare(got, want))
+			}
+		})
+	}
+
+	promptType := reflect.TypeOf(jump.Prompt{})
+	for i := 0; i < promptType.NumField(); i++ {
+		if field := promptType.Field(i); field.PkgPath == "" && !covered[field.Name] {
+			t.Errorf("Prompt.%s has no DecorateWithQuery test case", field.Name)
+		}
+	}
+}
+
+func TestPromptFieldsHaveMergeRules(t *testing.T) {
+	for _, name := range jump.PromptFieldsWithoutMergeRule() {
+		t.Errorf("Prompt.%s has no merge rule in mergePrompt", name)
+	}
+}
+
+func TestDecorateWithQueryDoesNotAliasTemplate(t *testing.T) {
+	query := &jump.PromptQuery{
+		Prompt: &jump.Prompt{
+			Labels:     map[string]string{"app": "api"},
+			Principals: []string{"eng"},
+		},
+	}
+	p := (&jump.Prompt{}).DecorateWithQuery(query)
+	p.Labels["region"] = "us-west-2"
+	p.Principals[0] = "ops"
+	if _, ok := query.Prompt.Labels["region"]; ok {
+		t.Error("decorated prompt labels alias the template")
+	}
+	if query.Prompt.Principals[0] != "eng" {
+		t.Error("decorated prompt principals alias the template")
+	}
+}
+
+func TestConfigInvalidUnset(t *testing.T) {
+	providers.Register()
+	for _, config := range []string{"testdata/invalid_unset_field.yaml", "testdata/invalid_unset_key.yaml"} {
+		_, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{config})
+		if err == nil {
+			t.Errorf("%s: expected error due to invalid unset entry", config)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package v1alpha
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// A PromptChange describes how a Prompt differs between two manifests.
+type PromptChange struct {
+	Action string   // One of "add", "remove" or "change".
+	Prompt *Prompt  // The new Prompt, or the old Prompt if it was removed.
+	Fields []string // For "change", the JSON names of the fields that changed.
+}
+
+// Returns the changes needed to turn the Prompts in before into the Prompts in after.
+// Added and changed Prompts are returned in the order of after, followed by removed Prompts in the order of before.
+func DiffPrompts(before, after []*Prompt) []PromptChange {
+	var changes []PromptChange
+	previous := make(map[string]*Prompt)
+	for _, p := range before {
+		previous[p.diffKey()] = p
+	}
+	seen := make(map[string]bool)
+	for _, p := range after {
+		key := p.diffKey()
+		seen[key] = true
+		old, ok := previous[key]
+		if !ok {
+			changes = append(changes, PromptChange{Action: "add", Prompt: p})
+			continue
+		}
+		if fields := changedFields(old, p); len(fields) > 0 {
+			changes = append(changes, PromptChange{Action: "change", Prompt: p, Fields: fields})
+		}
+	}
+	for _, p := range before {
+		if !seen[p.diffKey()] {
+			changes = append(changes, PromptChange{Action: "remove", Prompt: p})
+		}
+	}
+	return changes
+}
+
+// Identifies a Prompt across manifests. Falls back to the provider, name and hostname for manifests written before
+// Prompts had ids.
+func (p *Prompt) diffKey() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return fmt.Sprintf("%s/%s/%s", p.Provider, p.Name, p.Hostname)
+}
+
+// Returns the sorted JSON names of the fields that differ between two Prompts, as they appear in a manifest.
+func changedFields(a, b *Prompt) []string {
+	fieldsA, fieldsB := manifestFields(a), manifestFields(b)
+	var changed []string
+	for name, value := range fieldsA {
+		if !reflect.DeepEqual(value, fieldsB[name]) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range fieldsB {
+		if _, ok := fieldsA[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func manifestFields(p *Prompt) map[string]interface{} {
+	fields := make(map[string]interface{})
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
@@ -0,0 +1,39 @@
+package v1alpha_test
+
+import (
+	"reflect"
+	"testing"
+
+	jump "github.com/cased/jump/types/v1alpha"
+)
+
+func TestDiffPrompts(t *testing.T) {
+	before := jump.Prompts([]*jump.Prompt{
+		{Provider: "static", Name: "unchanged", Hostname: "a.example.com"},
+		{Provider: "static", Name: "changed", Hostname: "b.example.com", Port: "22"},
+		{Provider: "static", Name: "removed", Hostname: "c.example.com"},
+	})
+	after := jump.Prompts([]*jump.Prompt{
+		{Provider: "static", Name: "added", Hostname: "d.example.com"},
+		{Provider: "static", Name: "unchanged", Hostname: "a.example.com"},
+		{Provider: "static", Name: "changed", Hostname: "b.example.com", Port: "2222", Labels: map[string]string{"app": "bastion"}},
+	})
+
+	type change struct {
+		Action string
+		Name   string
+		Fields []string
+	}
+	want := []change{
+		{"add", "added", nil},
+		{"change", "changed", []string{"labels", "port"}},
+		{"remove", "removed", nil},
+	}
+	var got []change
+	for _, c := range jump.DiffPrompts(before, after) {
+		got = append(got, change{c.Action, c.Prompt.Name, c.Fields})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,370 @@
+package v1alpha
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severities of proxy jump problems, see ProxyJumpConfig.
+const (
+	SeverityIgnore = "ignore"
+	SeverityWarn   = "warn"
+	SeverityError  = "error"
+)
+
+// Options for checking proxy jump selectors against the Prompts in the manifest.
+type ProxyJumpConfig struct {
+	Unmatched string `json:"unmatched,omitempty" yaml:"unmatched,omitempty"` // Severity of a selector that matches no other Prompt. Defaults to warn.
+	Ambiguous string `json:"ambiguous,omitempty" yaml:"ambiguous,omitempty"` // Severity of a selector that matches more than one Prompt. Defaults to warn.
+	Cycle     string `json:"cycle,omitempty" yaml:"cycle,omitempty"`         // Severity of Prompts that proxy through each other. Defaults to error.
+	Chain     string `json:"chain,omitempty" yaml:"chain,omitempty"`         // If set to id or hostname, write the resolved hops of each proxied Prompt to its ProxyJumpChain.
+
+	Auto        *AutoProxyJumpConfig `json:"auto,omitempty" yaml:"auto,omitempty"`               // Optional: assign proxy jumps to Prompts that don't have one.
+	Unreachable string               `json:"unreachable,omitempty" yaml:"unreachable,omitempty"` // Severity of a Prompt that Auto finds no bastion for. Defaults to warn.
+}
+
+// Assigns each Prompt without a proxy jump selector a selector matching a bastion in the same network, like the same
+// VPC, preferring bastions that are closer, like those in the same availability zone. Prompts that are missing any of
+// the SameLabels aren't assigned a bastion, as their network isn't known.
+//
+// When several bastions are equally close, like an HA pair in one availability zone, the first in manifest order is
+// pinned: it is labeled with BastionIDLabel, and the selector matches that label too. The bastion is always pinned
+// when Bastions has match expressions, so the exact-match selector identifies it on its own.
+//
+// Prompts with a ConnectCommand don't connect over SSH, so they are never assigned a bastion or used as one. Disabled
+// Prompts, like stopped instances, can't be connected to, so they are never assigned a bastion or used as one.
+//
+// Hosts with a public IP address are assigned a bastion like any other, because providers connect to their private
+// address, like the private DNS name of an EC2 instance. Use Hosts to leave them out.
+type AutoProxyJumpConfig struct {
+	Bastions     *LabelSelector `json:"bastions" yaml:"bastions"`                             // Required: selects the Prompts that can be used as proxies.
+	Hosts        *LabelSelector `json:"hosts,omitempty" yaml:"hosts,omitempty"`               // Optional: only assign proxies to Prompts matching this selector. Defaults to every Prompt that isn't a bastion.
+	SameLabels   []string       `json:"sameLabels,omitempty" yaml:"sameLabels,omitempty"`     // Labels a bastion must share with a Prompt to be reachable from it. Defaults to vpc-id.
+	PreferLabels []string       `json:"preferLabels,omitempty" yaml:"preferLabels,omitempty"` // Labels a bastion should share with a Prompt, in order of preference. Defaults to availability-zone.
+}
+
+var (
+	defaultAutoProxyJumpSameLabels   = []string{"vpc-id"}
+	defaultAutoProxyJumpPreferLabels = []string{"availability-zone"}
+)
+
+// The annotation added to Prompts that AutoProxyJumpConfig finds no bastion for.
+const UnreachableAnnotation = "unreachable"
+
+// The label AutoProxyJumpConfig adds to a bastion it pins, set to the bastion's id.
+const BastionIDLabel = "bastion-id"
+
+var defaultProxyJumpConfig = ProxyJumpConfig{
+	Unmatched:   SeverityWarn,
+	Ambiguous:   SeverityWarn,
+	Cycle:       SeverityError,
+	Unreachable: SeverityWarn,
+}
+
+func (config *ProxyJumpConfig) validate() []string {
+	var problems []string
+	for _, option := range []struct{ Name, Value string }{
+		{"unmatched", config.Unmatched},
+		{"ambiguous", config.Ambiguous},
+		{"cycle", config.Cycle},
+		{"unreachable", config.Unreachable},
+	} {
+		switch option.Value {
+		case "", SeverityIgnore, SeverityWarn, SeverityError:
+		default:
+			problems = append(problems, fmt.Sprintf("%s must be ignore, warn or error, got %q", option.Name, option.Value))
+		}
+	}
+	switch config.Chain {
+	case "", "id", "hostname":
+	default:
+		problems = append(problems, fmt.Sprintf("chain must be id or hostname, got %q", config.Chain))
+	}
+	if config.Auto != nil {
+		if config.Auto.Bastions.Empty() {
+			problems = append(problems, "auto: bastions must select at least one label")
+		}
+		for _, problem := range config.Auto.Bastions.validate() {
+			problems = append(problems, "auto: bastions: "+problem)
+		}
+		for _, problem := range config.Auto.Hosts.validate() {
+			problems = append(problems, "auto: hosts: "+problem)
+		}
+	}
+	return problems
+}
+
+// Returns the options, with defaults for any that aren't set.
+func (config *ProxyJumpConfig) withDefaults() ProxyJumpConfig {
+	result := defaultProxyJumpConfig
+	if config == nil {
+		return result
+	}
+	if config.Unmatched != "" {
+		result.Unmatched = config.Unmatched
+	}
+	if config.Ambiguous != "" {
+		result.Ambiguous = config.Ambiguous
+	}
+	if config.Cycle != "" {
+		result.Cycle = config.Cycle
+	}
+	if config.Unreachable != "" {
+		result.Unreachable = config.Unreachable
+	}
+	result.Chain = config.Chain
+	if config.Auto != nil {
+		auto := *config.Auto
+		if auto.SameLabels == nil {
+			auto.SameLabels = defaultAutoProxyJumpSameLabels
+		}
+		if auto.PreferLabels == nil {
+			auto.PreferLabels = defaultAutoProxyJumpPreferLabels
+		}
+		result.Auto = &auto
+	}
+	return result
+}
+
+// The problems found while resolving proxy jumps, by severity.
+type proxyJumpProblems struct {
+	warnings []string
+	errors   []string
+}
+
+func (problems *proxyJumpProblems) add(severity, problem string) {
+	switch severity {
+	case SeverityWarn:
+		problems.warnings = append(problems.warnings, problem)
+	case SeverityError:
+		problems.errors = append(problems.errors, problem)
+	}
+}
+
+// Assigns a proxy jump selector to each Prompt without one, following the rule documented on AutoProxyJumpConfig.
+// Prompts no bastion is reachable from are annotated with UnreachableAnnotation and reported with the given severity,
+// rather than given a selector that matches a bastion in another network.
+func assignProxyJumps(prompts []*Prompt, auto *AutoProxyJumpConfig, unreachable string, problems *proxyJumpProblems) {
+	var bastions []*Prompt
+	for _, bastion := range SelectPrompts(prompts, auto.Bastions) {
+		if bastion.canProxy() {
+			bastions = append(bastions, bastion)
+		}
+	}
+	isBastion := make(map[*Prompt]bool)
+	for _, bastion := range bastions {
+		isBastion[bastion] = true
+	}
+
+	for _, p := range prompts {
+		if isBastion[p] || p.isDisabled() || p.ConnectCommand != "" || p.ProxyJump() != nil || !auto.Hosts.Matches(p.Labels) {
+			continue
+		}
+		network, ok := labelValues(p.Labels, auto.SameLabels)
+		if !ok {
+			continue
+		}
+		selector := &LabelSelector{MatchLabels: network}
+		candidates := SelectPrompts(bastions, selector)
+		if len(candidates) == 0 {
+			problem := fmt.Sprintf("no bastion with %s", selector)
+			if p.Annotations == nil {
+				p.Annotations = make(map[string]string)
+			}
+			p.Annotations[UnreachableAnnotation] = problem
+			problems.add(unreachable, fmt.Sprintf("%s: %s", p.describe(), problem))
+			continue
+		}
+		for _, key := range auto.PreferLabels {
+			value, ok := p.Labels[key]
+			if !ok {
+				continue
+			}
+			preferred := SelectPrompts(candidates, &LabelSelector{MatchLabels: map[string]string{key: value}})
+			if len(preferred) > 0 {
+				selector.MatchLabels[key] = value
+				candidates = preferred
+			}
+		}
+
+		if (len(candidates) > 1 || len(auto.Bastions.MatchExpressions) > 0) && candidates[0].ID != "" {
+			pinBastion(candidates[0])
+			selector.MatchLabels[BastionIDLabel] = candidates[0].ID
+		}
+
+		for key, value := range auto.Bastions.MatchLabels {
+			selector.MatchLabels[key] = value
+		}
+		p.ProxyJumpSelector = selector.MatchLabels
+		if len(auto.Bastions.MatchExpressions) > 0 {
+			p.ProxyJumpMatchExpressions = append([]LabelSelectorRequirement{}, auto.Bastions.MatchExpressions...)
+		}
+	}
+}
+
+// Returns true if other Prompts can proxy through p. Disabled Prompts, like stopped instances, can't be connected to,
+// Prompts with a ConnectCommand aren't reached over SSH, and Prompts that RunOnProxy are reached through another
+// Prompt.
+func (p *Prompt) canProxy() bool {
+	return !p.isDisabled() && p.ConnectCommand == "" && !p.RunOnProxy
+}
+
+func (p *Prompt) isDisabled() bool {
+	return p.Disabled != nil && *p.Disabled
+}
+
+// Points p, which runs on proxy, at proxy and proxy's own proxy jump.
+func runOnProxy(p, proxy *Prompt) {
+	p.Hostname = proxy.Hostname
+	p.IpAddress = proxy.IpAddress
+	p.Port = proxy.Port
+	if p.Username == "" {
+		p.Username = proxy.Username
+	}
+	p.ProxyJumpSelector = nil
+	if proxy.ProxyJumpSelector != nil {
+		p.ProxyJumpSelector = make(map[string]string, len(proxy.ProxyJumpSelector))
+		for key, value := range proxy.ProxyJumpSelector {
+			p.ProxyJumpSelector[key] = value
+		}
+	}
+	p.ProxyJumpMatchExpressions = nil
+	if proxy.ProxyJumpMatchExpressions != nil {
+		p.ProxyJumpMatchExpressions = append([]LabelSelectorRequirement{}, proxy.ProxyJumpMatchExpressions...)
+	}
+}
+
+// Labels bastion with its id, so a selector can match it alone. The labels are copied, as they may be shared.
+func pinBastion(bastion *Prompt) {
+	labels := make(map[string]string, len(bastion.Labels)+1)
+	for key, value := range bastion.Labels {
+		labels[key] = value
+	}
+	labels[BastionIDLabel] = bastion.ID
+	bastion.Labels = labels
+}
+
+// Returns the values of keys in labels, and whether they are all set.
+func labelValues(labels map[string]string, keys []string) (map[string]string, bool) {
+	values := make(map[string]string)
+	for _, key := range keys {
+		value, ok := labels[key]
+		if !ok {
+			return nil, false
+		}
+		values[key] = value
+	}
+	return values, true
+}
+
+// Assigns proxy jumps if config.Auto is set, then resolves the proxy jump selector of each Prompt against the other
+// Prompts that can be proxied through, see canProxy, reporting selectors that match nothing or more than one Prompt, and Prompts that proxy through each other.
+// When a selector matches several Prompts, the first in manifest order is used.
+//
+// Prompts that RunOnProxy are then pointed at their proxy: they take its Hostname, IpAddress, Port and proxy jump, and
+// its Username unless they set one. Those without a proxy are disabled and annotated with UnreachableAnnotation. If
+// config.Chain is set, the resolved hops are written to ProxyJumpChain.
+func resolveProxyJumps(prompts []*Prompt, config ProxyJumpConfig) proxyJumpProblems {
+	var problems proxyJumpProblems
+	if config.Auto != nil {
+		assignProxyJumps(prompts, config.Auto, config.Unreachable, &problems)
+	}
+
+	next := make(map[*Prompt]*Prompt)
+	for _, p := range prompts {
+		selector := p.ProxyJump()
+		if selector == nil {
+			continue
+		}
+		var matches []*Prompt
+		for _, candidate := range prompts {
+			if candidate != p && candidate.canProxy() && selector.Matches(candidate.Labels) {
+				matches = append(matches, candidate)
+			}
+		}
+		switch {
+		case len(matches) == 0:
+			problems.add(config.Unmatched, fmt.Sprintf("%s: proxy jump selector %q matches no prompts", p.describe(), selector))
+			continue
+		case len(matches) > 1:
+			problems.add(config.Ambiguous, fmt.Sprintf("%s: proxy jump selector %q matches %d prompts, using %s", p.describe(), selector, len(matches), matches[0].describe()))
+		}
+		next[p] = matches[0]
+	}
+
+	for _, p := range prompts {
+		if !p.RunOnProxy {
+			continue
+		}
+		proxy := next[p]
+		if proxy == nil {
+			problem := "no proxy jump to run on"
+			if p.ProxyJump() == nil {
+				problems.add(config.Unreachable, fmt.Sprintf("%s: %s", p.describe(), problem))
+			}
+			if p.Annotations == nil {
+				p.Annotations = make(map[string]string)
+			}
+			p.Annotations[UnreachableAnnotation] = problem
+			disabled := true
+			p.Disabled = &disabled
+			continue
+		}
+		runOnProxy(p, proxy)
+		next[p] = next[proxy]
+	}
+
+	reported := make(map[string]bool)
+	for _, p := range prompts {
+		if next[p] == nil {
+			continue
+		}
+		// Follow the chain of hops from p, outwards, until a Prompt that isn't proxied or one already visited
+		var hops []*Prompt
+		visited := map[*Prompt]int{p: 0}
+		cyclic := false
+		for hop := next[p]; hop != nil; hop = next[hop] {
+			if start, ok := visited[hop]; ok {
+				cyclic = true
+				cycle := append([]*Prompt{p}, hops...)[start:]
+				key := cycleKey(cycle)
+				if !reported[key] {
+					reported[key] = true
+					var names []string
+					for _, member := range append(cycle, cycle[0]) {
+						names = append(names, member.describe())
+					}
+					problems.add(config.Cycle, "proxy jump cycle: "+strings.Join(names, " -> "))
+				}
+				break
+			}
+			visited[hop] = len(hops) + 1
+			hops = append(hops, hop)
+		}
+		if cyclic || config.Chain == "" {
+			continue
+		}
+		// Hops are connected to in order, starting with the outermost
+		chain := make([]string, 0, len(hops))
+		for i := len(hops) - 1; i >= 0; i-- {
+			if config.Chain == "id" && hops[i].ID != "" {
+				chain = append(chain, hops[i].ID)
+			} else {
+				chain = append(chain, hops[i].Hostname)
+			}
+		}
+		p.ProxyJumpChain = chain
+	}
+	return problems
+}
+
+// Identifies a cycle regardless of the member it was found from.
+func cycleKey(cycle []*Prompt) string {
+	var names []string
+	for _, p := range cycle {
+		names = append(names, fmt.Sprintf("%p", p))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
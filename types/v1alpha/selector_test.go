@@ -0,0 +1,90 @@
+package v1alpha_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cased/jump/providers"
+	jump "github.com/cased/jump/types/v1alpha"
+)
+
+func TestLabelSelectorMatches(t *testing.T) {
+	labels := map[string]string{"role": "bastion", "zone": "us-west-2a"}
+	tests := []struct {
+		Name     string
+		Selector *jump.LabelSelector
+		Want     bool
+	}{
+		{"nil matches everything", nil, true},
+		{"empty matches everything", &jump.LabelSelector{}, true},
+		{"matchLabels", &jump.LabelSelector{MatchLabels: map[string]string{"role": "bastion"}}, true},
+		{"matchLabels mismatch", &jump.LabelSelector{MatchLabels: map[string]string{"role": "app"}}, false},
+		{"matchLabels missing", &jump.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}, false},
+		{"In", &jump.LabelSelector{MatchExpressions: []jump.LabelSelectorRequirement{{Key: "zone", Operator: "In", Values: []string{"us-west-2a", "us-west-2b"}}}}, true},
+		{"In mismatch", &jump.LabelSelector{MatchExpressions: []jump.LabelSelectorRequirement{{Key: "zone", Operator: "In", Values: []string{"us-west-2b"}}}}, false},
+		{"In missing", &jump.LabelSelector{MatchExpressions: []jump.LabelSelectorRequirement{{Key: "env", Operator: "In", Values: []string{"prod"}}}}, false},
+		{"NotIn", &jump.LabelSelector{MatchExpressions: []jump.LabelSelectorRequirement{{Key: "role", Operator: "NotIn", Values: []string{"canary"}}}}, true},
+		{"NotIn mismatch", &jump.LabelSelector{MatchExpressions: []jump.LabelSelectorRequirement{{Key: "role", Operator: "NotIn", Values: []string{"bastion"}}}}, false},
+		{"NotIn missing", &jump.LabelSelector{MatchExpressions: []jump.LabelSelectorRequirement{{Key: "env", Operator: "NotIn", Values: []string{"prod"}}}}, true},
+		{"Exists", &jump.LabelSelector{MatchExpressions: []jump.LabelSelectorRequirement{{Key: "zone", Operator: "Exists"}}}, true},
+		{"Exists missing", &jump.LabelSelector{MatchExpressions: []jump.LabelSelectorRequirement{{Key: "env", Operator: "Exists"}}}, false},
+		{"DoesNotExist", &jump.LabelSelector{MatchExpressions: []jump.LabelSelectorRequirement{{Key: "env", Operator: "DoesNotExist"}}}, true},
+		{"DoesNotExist present", &jump.LabelSelector{MatchExpressions: []jump.LabelSelectorRequirement{{Key: "zone", Operator: "DoesNotExist"}}}, false},
+		{
+			"all requirements must match",
+			&jump.LabelSelector{
+				MatchLabels:      map[string]string{"role": "bastion"},
+				MatchExpressions: []jump.LabelSelectorRequirement{{Key: "zone", Operator: "In", Values: []string{"us-west-2b"}}},
+			},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			if got := test.Selector.Matches(labels); got != test.Want {
+				t.Errorf("got %v, want %v", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestQuerySelectorAndProxyJumpWarnings(t *testing.T) {
+	providers.Register()
+	config, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/selector/config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := config.DiscoverManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"bastion-a", "bastion-c", "app", "orphan"}
+	if got := promptNames(manifest.Prompts); !reflect.DeepEqual(got, want) {
+		t.Errorf("got prompts %v, want %v", got, want)
+	}
+	wantWarnings := []string{
+		`testdata/selector/config.yaml:31: selector "role notin (canary)" matches none of 1 discovered prompts`,
+		`static orphan (orphan.example.com): proxy jump selector "zone in (eu-west-1a)" matches no prompts`,
+	}
+	if !reflect.DeepEqual(manifest.Warnings, wantWarnings) {
+		t.Errorf("got warnings %q, want %q", manifest.Warnings, wantWarnings)
+	}
+}
+
+func TestSelectorValidation(t *testing.T) {
+	providers.Register()
+	_, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/selector/invalid.yaml"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		`proxyJumpMatchExpressions: selector requirement on "zone": operator Exists doesn't take values`,
+		`selector: selector requirement on "role": operator must be one of In, NotIn, Exists or DoesNotExist, got "Equals"`,
+		`selector: selector requirement on "zone": operator In needs at least one value`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got:\n%s", want, err)
+		}
+	}
+}
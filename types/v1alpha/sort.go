@@ -0,0 +1,161 @@
+package v1alpha
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A SortKey sorts Prompts by a Prompt field, label or annotation.
+type SortKey struct {
+	Key   string `json:"key" yaml:"key"`                         // A Prompt field like `name` or `featured`, or a label or annotation like `labels.environment`.
+	Order string `json:"order,omitempty" yaml:"order,omitempty"` // asc (the default) or desc.
+}
+
+func (key SortKey) validate() error {
+	if err := validateFieldKey(key.Key); err != nil {
+		return err
+	}
+	switch key.Order {
+	case "", "asc", "desc":
+		return nil
+	}
+	return fmt.Errorf("order must be asc or desc, got %q", key.Order)
+}
+
+// Sorts prompts by each key in turn. Prompts missing a key's value sort after those that have one, in either order.
+// The sort is stable, so prompts that compare equal on every key keep their relative order. Values are compared by
+// type, see compareSortValues.
+func SortPrompts(prompts []*Prompt, keys []SortKey) {
+	if len(keys) == 0 {
+		return
+	}
+	sort.SliceStable(prompts, func(i, j int) bool {
+		for _, key := range keys {
+			a, aOK := prompts[i].field(key.Key)
+			b, bOK := prompts[j].field(key.Key)
+			if aOK != bOK {
+				return aOK
+			}
+			cmp := compareSortValues(a, b)
+			if cmp == 0 {
+				continue
+			}
+			if key.Order == "desc" {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
+
+// Compares two values of a sort key. Values that are both times, in one of the formats accepted by Expressions, are
+// compared as times, and values that are both numbers as numbers, so `10` sorts after `9`. Anything else is compared
+// as text.
+func compareSortValues(a, b string) int {
+	if a == b {
+		return 0
+	}
+	ta, errA := (value{kind: stringValue, s: a}).as(timeValue)
+	tb, errB := (value{kind: stringValue, s: b}).as(timeValue)
+	if errA == nil && errB == nil {
+		return compareOrdered(ta.t.Before(tb.t), ta.t.After(tb.t))
+	}
+	na, errA := strconv.ParseFloat(a, 64)
+	nb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		return compareOrdered(na < nb, na > nb)
+	}
+	return strings.Compare(a, b)
+}
+
+// Returns the keys to sort the results of a query by: its sort keys, or its sortBy and sortOrder. A sortBy that isn't
+// a Prompt field, like the ec2 provider's launchTime, refers to the annotation of the same name.
+func (query *PromptQuery) sortKeys() []SortKey {
+	if len(query.Sort) > 0 {
+		return query.Sort
+	}
+	if query.SortBy == "" {
+		return nil
+	}
+	key := query.SortBy
+	if validateFieldKey(key) != nil {
+		key = "annotations." + key
+	}
+	return []SortKey{{Key: key, Order: query.SortOrder}}
+}
+
+// Returns true if the Provider can sort and limit the results of the query itself, because it sorts natively by
+// the query's only sort key and jump doesn't filter the results after discovery.
+func (query *PromptQuery) canPushDown() bool {
+	if query.SortBy == "" || len(query.Sort) > 0 || len(query.GroupBy) > 0 || query.Selector != nil || query.Where != "" {
+		return false
+	}
+	schema := describeProvider(query.Provider)
+	return schema != nil && findSchemaKey(schema.SortKeys, query.SortBy) != nil
+}
+
+// Returns a copy of the query for DiscoverManifest to pass to its Provider, which records whether jump limits the
+// results, see ProviderLimit, and collects the Provider's warnings. The loaded query itself is never modified, so a
+// Provider called with it directly doesn't depend on earlier discoveries.
+func (query *PromptQuery) forDiscovery() *PromptQuery {
+	discovery := *query
+	discovery.limitInCore = !query.canPushDown()
+	discovery.warnings = nil
+	return &discovery
+}
+
+// Returns the limit a Provider should apply to the results of the query, or 0 if it shouldn't limit them because
+// jump sorts and limits them after discovery. Providers should only apply the limit after sorting by SortBy.
+// Queries that weren't passed to the Provider by DiscoverManifest always return Limit.
+func (query *PromptQuery) ProviderLimit() int {
+	if query.limitInCore {
+		return 0
+	}
+	return query.Limit
+}
+
+// Sorts the results of a query, then applies its limit, to each group if it has groupBy keys. Ties are broken by
+// name, hostname and id, so the results don't depend on the order of provider responses.
+func (query *PromptQuery) sortAndLimit(prompts []*Prompt) []*Prompt {
+	SortPrompts(prompts, append(append([]SortKey{}, query.sortKeys()...), defaultQuerySortKeys...))
+	if query.Limit == 0 {
+		return prompts
+	}
+	if len(query.GroupBy) == 0 {
+		if len(prompts) > query.Limit {
+			prompts = prompts[:query.Limit]
+		}
+		return prompts
+	}
+	counts := make(map[string]int)
+	var limited []*Prompt
+	for _, p := range prompts {
+		var group []string
+		for _, key := range query.GroupBy {
+			value, _ := p.field(key)
+			group = append(group, value)
+		}
+		groupKey := strings.Join(group, "\x00")
+		if counts[groupKey] < query.Limit {
+			counts[groupKey]++
+			limited = append(limited, p)
+		}
+	}
+	return limited
+}
+
+// The order of Prompts from a query that compare equal on its sort keys, so results don't depend on the order of
+// provider responses.
+var defaultQuerySortKeys = []SortKey{
+	{Key: "name"},
+	{Key: "hostname"},
+	{Key: "id"},
+}
+
+// The default manifest order. Prompts from the same provider keep the order of the queries that produced them.
+var defaultManifestSortKeys = []SortKey{
+	{Key: "provider"},
+}
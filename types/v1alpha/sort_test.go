@@ -0,0 +1,230 @@
+package v1alpha_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cased/jump/providers"
+	jump "github.com/cased/jump/types/v1alpha"
+	"gopkg.in/yaml.v2"
+)
+
+func promptNames(prompts []*jump.Prompt) []string {
+	var names []string
+	for _, p := range prompts {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestSortPrompts(t *testing.T) {
+	prompts := []*jump.Prompt{
+		{
+			Name:        "b",
+			Labels:      map[string]string{"weight": "9"},
+			Annotations: map[string]string{"launchTime": "2021-07-11T00:00:00Z", "startedAt": "2021-07-11 00:00:00 +0000 UTC"},
+		},
+		{
+			Name:        "c",
+			Annotations: map[string]string{"startedAt": "2020-01-01T00:00:00Z"},
+		},
+		{
+			Name:        "a",
+			Labels:      map[string]string{"weight": "10"},
+			Annotations: map[string]string{"launchTime": "2020-07-11T00:00:00Z", "startedAt": "2020-07-11 00:00:00 +0000 UTC"},
+		},
+		{
+			Name:        "d",
+			Labels:      map[string]string{"weight": "1.5"},
+			Annotations: map[string]string{"launchTime": "2022-07-11T00:00:00Z", "startedAt": "2022-07-11T00:00:00Z"},
+		},
+	}
+	tests := []struct {
+		Name string
+		Keys []jump.SortKey
+		Want []string
+	}{
+		{"no keys keeps order", nil, []string{"b", "c", "a", "d"}},
+		{"ascending", []jump.SortKey{{Key: "name"}}, []string{"a", "b", "c", "d"}},
+		{"descending", []jump.SortKey{{Key: "name", Order: "desc"}}, []string{"d", "c", "b", "a"}},
+		{"missing values sort last", []jump.SortKey{{Key: "annotations.launchTime", Order: "desc"}}, []string{"d", "b", "a", "c"}},
+		{"numbers", []jump.SortKey{{Key: "labels.weight"}}, []string{"d", "b", "a", "c"}},
+		{"times in different formats", []jump.SortKey{{Key: "annotations.startedAt"}}, []string{"c", "a", "b", "d"}},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			sorted := append([]*jump.Prompt{}, prompts...)
+			jump.SortPrompts(sorted, test.Keys)
+			if got := promptNames(sorted); !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("got %v, want %v", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestManifestSortBy(t *testing.T) {
+	providers.Register()
+	config, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/sort/config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompts, err := config.DiscoverPrompts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"featured", "prod", "staging-a", "staging-b", "no-environment"}
+	if got := promptNames(prompts); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestManifestSortByInvalid(t *testing.T) {
+	providers.Register()
+	tests := []struct {
+		ConfigPaths []string
+		WantErrors  []string
+	}{
+		{
+			ConfigPaths: []string{"testdata/sort/config.yaml", "testdata/sort/duplicate_manifest.yaml"},
+			WantErrors:  []string{"manifest options are already set in testdata/sort/config.yaml"},
+		},
+		{
+			ConfigPaths: []string{"testdata/sort/invalid_key.yaml"},
+			WantErrors:  []string{`"labels." is missing a key`, `prompt field "principals" can't be used here`, `order must be asc or desc`},
+		},
+		{
+			ConfigPaths: []string{"testdata/sort/invalid_query.yaml"},
+			WantErrors: []string{
+				"invalid_query.yaml:2: use either sort or sortBy and sortOrder, not both",
+				`invalid_query.yaml:6: sort: order must be asc or desc, got "newest"`,
+				`invalid_query.yaml:6: groupBy: unknown prompt field "zone"`,
+				"invalid_query.yaml:6: groupBy has no effect without a limit",
+			},
+		},
+	}
+	for _, test := range tests {
+		_, err := jump.LoadAutoDiscoveryConfigFromPaths(test.ConfigPaths)
+		if err == nil {
+			t.Fatalf("%v: expected error", test.ConfigPaths)
+		}
+		for _, want := range test.WantErrors {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("got %q, want it to contain %q", err, want)
+			}
+		}
+	}
+}
+
+// A Provider that returns a fixed list of Prompts, and records the limit it was asked to apply.
+type fixedProvider struct {
+	prompts []*jump.Prompt
+	limit   int
+}
+
+func (provider *fixedProvider) Initialize(interface{}) {}
+
+func (provider *fixedProvider) Describe() *jump.ProviderSchema {
+	return &jump.ProviderSchema{
+		SortKeys: []jump.SchemaKey{{Name: "launchTime"}},
+	}
+}
+
+func (provider *fixedProvider) Discover(queries []*jump.PromptQuery) ([]*jump.Prompt, error) {
+	provider.limit = queries[0].ProviderLimit()
+	var prompts []*jump.Prompt
+	for _, p := range provider.prompts {
+		prompt := *p
+		prompts = append(prompts, prompt.DecorateWithQuery(queries[0]))
+	}
+	return prompts, nil
+}
+
+func TestQuerySortAndLimit(t *testing.T) {
+	provider := &fixedProvider{
+		prompts: []*jump.Prompt{
+			{Name: "a1-old", Labels: map[string]string{"zone": "a", "weight": "10"}, Annotations: map[string]string{"launchTime": "2020-01-01T00:00:00Z"}},
+			{Name: "b-new", Labels: map[string]string{"zone": "b", "weight": "9"}, Annotations: map[string]string{"launchTime": "2022-01-01T00:00:00Z"}},
+			{Name: "a2-new", Labels: map[string]string{"zone": "a", "weight": "10"}, Annotations: map[string]string{"launchTime": "2021-01-01T00:00:00Z"}},
+			{Name: "b-old", Labels: map[string]string{"zone": "b", "weight": "2"}, Annotations: map[string]string{"launchTime": "2019-01-01T00:00:00Z"}},
+		},
+	}
+	jump.RegisterProvider("fixed", provider, nil)
+	tests := []struct {
+		Name          string
+		Query         string
+		Want          []string
+		ProviderLimit int
+	}{
+		{
+			Name:  "default order",
+			Query: "provider: fixed",
+			Want:  []string{"a1-old", "a2-new", "b-new", "b-old"},
+		},
+		{
+			Name:          "native sortBy is pushed down",
+			Query:         "{provider: fixed, sortBy: launchTime, sortOrder: desc, limit: 2}",
+			Want:          []string{"b-new", "a2-new"},
+			ProviderLimit: 2,
+		},
+		{
+			Name:  "sortBy any field",
+			Query: "{provider: fixed, sortBy: labels.weight, limit: 3}",
+			Want:  []string{"b-old", "b-new", "a1-old"},
+		},
+		{
+			Name:  "multiple keys",
+			Query: "{provider: fixed, sort: [{key: labels.weight, order: desc}, {key: annotations.launchTime, order: desc}]}",
+			Want:  []string{"a2-new", "a1-old", "b-new", "b-old"},
+		},
+		{
+			Name:  "newest per zone",
+			Query: "{provider: fixed, sort: [{key: annotations.launchTime, order: desc}], groupBy: [labels.zone], limit: 1}",
+			Want:  []string{"b-new", "a2-new"},
+		},
+		{
+			Name:  "limit after where",
+			Query: `{provider: fixed, sortBy: launchTime, where: 'labels.zone == "a"', limit: 1}`,
+			Want:  []string{"a1-old"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var query jump.PromptQuery
+			if err := yaml.UnmarshalStrict([]byte(test.Query), &query); err != nil {
+				t.Fatal(err)
+			}
+			config := &jump.AutoDiscoveryConfig{Queries: []*jump.PromptQuery{&query}}
+			prompts, err := config.DiscoverPrompts()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := promptNames(prompts); !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("got %v, want %v", got, test.Want)
+			}
+			if provider.limit != test.ProviderLimit {
+				t.Errorf("got provider limit %d, want %d", provider.limit, test.ProviderLimit)
+			}
+		})
+	}
+}
+
+func TestProviderLimitDoesNotDependOnDiscovery(t *testing.T) {
+	provider := &fixedProvider{}
+	jump.RegisterProvider("fixed", provider, nil)
+	query := &jump.PromptQuery{Provider: "fixed", SortBy: "labels.weight", Limit: 3}
+	config := &jump.AutoDiscoveryConfig{Queries: []*jump.PromptQuery{query}}
+	if _, err := config.DiscoverPrompts(); err != nil {
+		t.Fatal(err)
+	}
+	if provider.limit != 0 {
+		t.Errorf("got provider limit %d during discovery, want 0", provider.limit)
+	}
+	// Called directly, the Provider is asked to apply the query's limit
+	if _, err := provider.Discover([]*jump.PromptQuery{query}); err != nil {
+		t.Fatal(err)
+	}
+	if provider.limit != 3 {
+		t.Errorf("got provider limit %d, want 3", provider.limit)
+	}
+}
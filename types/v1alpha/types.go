@@ -1,36 +1,62 @@
 package v1alpha
 
+import (
+	"strings"
+	"time"
+)
+
 // A PromptQuery is a query for a Prompt.
 type PromptQuery struct {
-	Provider  string            `yaml:"provider"`            // The name of a registered Provider to use to perform this query.
-	Filters   map[string]string `yaml:"filters,omitempty"`   // A map of filters. Each Provider defines its own filters.
-	Limit     int               `yaml:"limit,omitempty"`     // The maximum number of results to return.
-	SortBy    string            `yaml:"sortBy,omitempty"`    // The field to sort results by, passed to the Provider.
-	SortOrder string            `yaml:"sortOrder,omitempty"` // The order in which to sort results, passed to the Provider.
-	Prompt    *Prompt           `yaml:"prompt,omitempty"`    // A Prompt template, which can be used to give all returned results a common name, description, etc.
+	Name           string            `json:"name,omitempty" yaml:"name,omitempty"`                     // Optional: a name for this query, which must be unique across all loaded config files.
+	Provider       string            `json:"provider,omitempty" yaml:"provider"`                       // The name of a registered Provider to use to perform this query.
+	Filters        map[string]string `json:"filters,omitempty" yaml:"filters,omitempty"`               // A map of filters. Each Provider defines its own filters.
+	Options        map[string]string `json:"options,omitempty" yaml:"options,omitempty"`               // A map of options that change how the Provider discovers or connects to resources, rather than which it returns. Each Provider defines its own options.
+	Limit          int               `json:"limit,omitempty" yaml:"limit,omitempty"`                   // The maximum number of results to return, or to return per group if GroupBy is set.
+	SortBy         string            `json:"sortBy,omitempty" yaml:"sortBy,omitempty"`                 // A single key to sort results by: a Prompt field, label or annotation, or a sort key supported by the Provider, which refers to the annotation of the same name.
+	SortOrder      string            `json:"sortOrder,omitempty" yaml:"sortOrder,omitempty"`           // The order in which to sort results by SortBy: asc (the default) or desc.
+	Sort           []SortKey         `json:"sort,omitempty" yaml:"sort,omitempty"`                     // Keys to sort results by, in turn. An alternative to SortBy and SortOrder.
+	GroupBy        []string          `json:"groupBy,omitempty" yaml:"groupBy,omitempty"`               // Optional: Prompt fields, labels or annotations to group results by, so Limit applies to each group, e.g. the newest instance per availability zone.
+	Prompt         *Prompt           `json:"prompt,omitempty" yaml:"prompt,omitempty"`                 // A Prompt template, which can be used to give all returned results a common name, description, etc.
+	Selector       *LabelSelector    `json:"selector,omitempty" yaml:"selector,omitempty"`             // Optional: only keep discovered Prompts whose labels, after applying the Prompt template, match this selector.
+	Where          string            `json:"where,omitempty" yaml:"where,omitempty"`                   // Optional: only keep discovered Prompts matching this Expression, evaluated after Selector.
+	Variants       []*PromptVariant  `json:"variants,omitempty" yaml:"variants,omitempty"`             // Optional: emit one Prompt per variant for each discovered Prompt, after filtering, sorting and limiting.
+	ResourceConfig *ResourceConfig   `json:"resourceConfig,omitempty" yaml:"resourceConfig,omitempty"` // Optional: how Prompt configuration is read from discovered resources, like EC2 tags. See ResourceConfig.
+
+	source string // The config file this query was loaded from.
+	line   int    // The line in source this query starts on, if known.
+
+	limitInCore bool     // Whether jump, rather than the Provider, limits the results, see ProviderLimit. Only set on the copies made by forDiscovery.
+	warnings    []string // Problems reported by the Provider, see Warn.
 }
 
 // A Prompt represents an interactive command line, and can represent the initial shell presented by an SSH connection to a host OR the interactive session presented by a command run on that host.
 type Prompt struct {
-	Hostname            string            `json:"hostname" yaml:"hostname,omitempty"`                                 // The hostname to establish an SSH connection to. Use only for display purposes if IpAddress is provided.
-	Username            string            `json:"username,omitempty" yaml:"username,omitempty"`                       // The username to use to establish an SSH connection to the host.
-	IpAddress           string            `json:"ipAddress,omitempty" yaml:"ipAddress,omitempty"`                     // Optional: the IP address to establish an SSH connection to.
-	Port                string            `json:"port,omitempty" yaml:"port,omitempty"`                               // Optional: the port to use when establishing an SSH connection.
-	Name                string            `json:"name,omitempty" yaml:"name,omitempty"`                               // A descriptive name for this Prompt.
-	Description         string            `json:"description,omitempty" yaml:"description,omitempty"`                 // A longer description of this Prompt. Use this field to explain common use cases.
-	JumpCommand         string            `json:"jumpCommand,omitempty" yaml:"jumpCommand,omitempty"`                 // Optional: the command to run after establishing an SSH connection to the host
-	ShellCommand        string            `json:"shellCommand,omitempty" yaml:"shellCommand,omitempty"`               // Optional: the command to run on the host or container to start the interactive session.
-	PreDownloadCommand  string            `json:"preDownloadCommand,omitempty" yaml:"preDownloadCommand,omitempty"`   // Optional: a command to run before processing a user request to download a file. The tokens `{filepath}` and `{filename}` will be replaced with the filepath and filename of the file to download. The command is expected to output the path to the file to download to stdout.
-	Kind                string            `json:"kind,omitempty" yaml:"kind,omitempty"`                               // The kind of prompt. Currently valid values are "host" and "container".
-	Provider            string            `json:"provider,omitempty" yaml:"provider,omitempty"`                       // The name of the provider that created this prompt.
-	Labels              map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`                           // Optional: a map of key-value pairs containing additional information about this Prompt. The Cased Shell Dashboard may in the future provide functionality to filter Prompts by label values.
-	Annotations         map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`                 // Optional: a map of key-value pairs containing additional information about this Prompt. The Cased Shell Dashboard may in the future display these values alongside the Prompt, but is not expected to use them for filtering.
-	Principals          []string          `json:"principals,omitempty" yaml:"principals,omitempty"`                   // Optional: a list of users and groups that should have access to this Prompt. The Cased Shell Dashboard will use this information to conditionally display this Prompt.
-	Featured            bool              `json:"featured,omitempty" yaml:"featured,omitempty"`                       // Optional: whether this Prompt should be featured in the Cased Shell Dashboard.
-	PromptForKey        bool              `json:"promptForKey,omitempty" yaml:"promptForKey,omitempty"`               // Set to true to tell the Cased Shell Dashboard to prompt the user for a key.
-	PromptForUsername   bool              `json:"promptForUsername,omitempty" yaml:"promptForUsername,omitempty"`     // Set to true to tell the Cased Shell Dashboard to prompt the user for a username.
-	CloseTerminalOnExit *bool             `json:"closeTerminalOnExit,omitempty" yaml:"closeTerminalOnExit,omitempty"` // Set to false to retain the terminal window after the remote command completes.
-	ProxyJumpSelector   map[string]string `json:"proxyJumpSelector,omitempty" yaml:"proxyJumpSelector,omitempty"`     // Optional: a map of key-value pairs matching the labels on an existing prompt. If a matching prompt is found, connections to the prompt containing the ProxyHostJump attribute will be proxied via the matching prompt, similar to SSH's `ProxyJump` option.
+	ID                        string                     `json:"id,omitempty" yaml:"-" merge:"-"`                                                // A deterministic id, set by the Provider. Stable across discovery cycles as long as the query and resource are the same, see PromptID.
+	Hostname                  string                     `json:"hostname" yaml:"hostname,omitempty"`                                             // The hostname to establish an SSH connection to. Use only for display purposes if IpAddress is provided.
+	Username                  string                     `json:"username,omitempty" yaml:"username,omitempty"`                                   // The username to use to establish an SSH connection to the host.
+	IpAddress                 string                     `json:"ipAddress,omitempty" yaml:"ipAddress,omitempty"`                                 // Optional: the IP address to establish an SSH connection to.
+	Port                      string                     `json:"port,omitempty" yaml:"port,omitempty"`                                           // Optional: the port to use when establishing an SSH connection.
+	Name                      string                     `json:"name,omitempty" yaml:"name,omitempty"`                                           // A descriptive name for this Prompt.
+	Description               string                     `json:"description,omitempty" yaml:"description,omitempty"`                             // A longer description of this Prompt. Use this field to explain common use cases.
+	JumpCommand               string                     `json:"jumpCommand,omitempty" yaml:"jumpCommand,omitempty"`                             // Optional: the command to run after establishing an SSH connection to the host
+	ShellCommand              string                     `json:"shellCommand,omitempty" yaml:"shellCommand,omitempty"`                           // Optional: the command to run on the host or container to start the interactive session.
+	PreDownloadCommand        string                     `json:"preDownloadCommand,omitempty" yaml:"preDownloadCommand,omitempty"`               // Optional: a command to run before processing a user request to download a file. The tokens `{filepath}` and `{filename}` will be replaced with the filepath and filename of the file to download. The command is expected to output the path to the file to download to stdout.
+	ConnectCommand            string                     `json:"connectCommand,omitempty" yaml:"connectCommand,omitempty"`                       // Optional: a command the Cased Shell host runs itself to open the session, instead of establishing an SSH connection, e.g. `aws ssm start-session --target i-1234`. Hostname and IpAddress are then only displayed, Port and proxy jumps aren't used, and JumpCommand and ShellCommand are run in the session it opens.
+	Kind                      string                     `json:"kind,omitempty" yaml:"kind,omitempty"`                                           // The kind of prompt. Currently valid values are "host", "container" and "database".
+	Provider                  string                     `json:"provider,omitempty" yaml:"provider,omitempty" merge:"-"`                         // The name of the provider that created this prompt.
+	Labels                    map[string]string          `json:"labels,omitempty" yaml:"labels,omitempty" merge:"keys"`                          // Optional: a map of key-value pairs containing additional information about this Prompt. The Cased Shell Dashboard may in the future provide functionality to filter Prompts by label values.
+	Annotations               map[string]string          `json:"annotations,omitempty" yaml:"annotations,omitempty" merge:"keys"`                // Optional: a map of key-value pairs containing additional information about this Prompt. The Cased Shell Dashboard may in the future display these values alongside the Prompt, but is not expected to use them for filtering.
+	Principals                []string                   `json:"principals,omitempty" yaml:"principals,omitempty"`                               // Optional: a list of users and groups that should have access to this Prompt. The Cased Shell Dashboard will use this information to conditionally display this Prompt.
+	Featured                  *bool                      `json:"featured,omitempty" yaml:"featured,omitempty"`                                   // Optional: whether this Prompt should be featured in the Cased Shell Dashboard.
+	PromptForKey              *bool                      `json:"promptForKey,omitempty" yaml:"promptForKey,omitempty"`                           // Set to true to tell the Cased Shell Dashboard to prompt the user for a key.
+	PromptForUsername         *bool                      `json:"promptForUsername,omitempty" yaml:"promptForUsername,omitempty"`                 // Set to true to tell the Cased Shell Dashboard to prompt the user for a username.
+	CloseTerminalOnExit       *bool                      `json:"closeTerminalOnExit,omitempty" yaml:"closeTerminalOnExit,omitempty"`             // Set to false to retain the terminal window after the remote command completes.
+	Disabled                  *bool                      `json:"disabled,omitempty" yaml:"disabled,omitempty"`                                   // Set to true to tell the Cased Shell Dashboard to list this Prompt without allowing connections to it, e.g. for a stopped instance.
+	ProxyJumpSelector         map[string]string          `json:"proxyJumpSelector,omitempty" yaml:"proxyJumpSelector,omitempty"`                 // Optional: a map of key-value pairs matching the labels on an existing prompt. If a matching prompt is found, connections to the prompt containing the ProxyHostJump attribute will be proxied via the matching prompt, similar to SSH's `ProxyJump` option.
+	ProxyJumpMatchExpressions []LabelSelectorRequirement `json:"proxyJumpMatchExpressions,omitempty" yaml:"proxyJumpMatchExpressions,omitempty"` // Optional: set-based requirements on the labels of the proxy prompt, e.g. `zone In (us-west-2a, us-west-2b)`. Combined with ProxyJumpSelector, see ProxyJump.
+	ProxyJumpChain            []string                   `json:"proxyJumpChain,omitempty" yaml:"-" merge:"-"`                                    // The resolved hops to connections to this Prompt, outermost first, as ids or hostnames. Only set by jump, when enabled with the manifest's proxyJump chain option.
+	RunOnProxy                bool                       `json:"-" yaml:"-" merge:"-"`                                                           // Only set by Providers: connect to the Prompt's resolved proxy jump instead of Hostname, and run JumpCommand and ShellCommand there, e.g. for a database that is only reachable from a bastion. Resolved by jump before the manifest is written.
+	Unset                     []string                   `json:"unset,omitempty" yaml:"unset,omitempty" merge:"-"`                               // Only valid in a PromptQuery template: a list of fields to clear on discovered Prompts, e.g. `jumpCommand` or `labels.region`. See DecorateWithQuery.
 
 	// TODO combine JumpCommand and ShellCommand into a single InitialCommand when serializing to JSON
 	// InitialCommand    string            `json:"initialCommand,omitempty" yaml:"initialCommand,omitempty"`
@@ -42,10 +68,75 @@ type Provider interface {
 	Discover([]*PromptQuery) ([]*Prompt, error)
 }
 
-// An AutoDiscoveryManifest is a JSON-encoded list of Prompts.
+// A Describer is a Provider that can describe the queries it supports.
+// Queries for Providers that implement Describer are validated against their ProviderSchema when config is loaded.
+// A Describer that returns a nil ProviderSchema is treated like a Provider without a schema.
+type Describer interface {
+	Describe() *ProviderSchema
+}
+
+// Returns the schema of the named Provider, or nil if it isn't a Describer or describes itself with a nil schema.
+func describeProvider(name string) *ProviderSchema {
+	describer, ok := Providers[name].(Describer)
+	if !ok {
+		return nil
+	}
+	return describer.Describe()
+}
+
+// A ProviderSchema describes the filters, sort keys, labels and annotations supported by a Provider.
+type ProviderSchema struct {
+	Description string
+	Filters     []SchemaKey // Supported filter keys. A key ending in `*` matches any key with that prefix, e.g. `tag:*`.
+	Options     []SchemaKey // Supported option keys.
+	SortKeys    []SchemaKey // Values of sortBy the Provider sorts by natively, each stored in the annotation of the same name. Other keys are sorted by jump.
+	Labels      []SchemaKey // Labels the Provider adds to each Prompt, in addition to those derived from filters.
+	Annotations []SchemaKey // Annotations the Provider adds to each Prompt.
+}
+
+// A SchemaKey describes a single filter key, sort key, label or annotation.
+type SchemaKey struct {
+	Name        string
+	Description string
+	Values      []string // Optional: the only valid values for this key.
+}
+
+// Returns the SchemaKey matching name, or nil.
+func findSchemaKey(keys []SchemaKey, name string) *SchemaKey {
+	for i, key := range keys {
+		if key.Name == name {
+			return &keys[i]
+		}
+		if prefix := strings.TrimSuffix(key.Name, "*"); prefix != key.Name && strings.HasPrefix(name, prefix) && name != prefix {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+// An AutoDiscoveryManifest is a JSON-encoded list of Prompts, with metadata describing how it was produced.
 // The Cased Shell application reads this manifest and uses it to display a list of Prompts to the user.
+// Readers that only need the list of Prompts can ignore every other field. The manifest is described by a JSON
+// Schema in manifest.schema.json.
 type AutoDiscoveryManifest struct {
-	Prompts []*Prompt `json:"prompts"`
+	APIVersion  string          `json:"apiVersion"`           // Always ManifestAPIVersion.
+	Kind        string          `json:"kind"`                 // Always ManifestKind.
+	GeneratedAt time.Time       `json:"generatedAt"`          // When discovery finished. Use this to detect a stale manifest.
+	JumpVersion string          `json:"jumpVersion"`          // The version of jump that wrote the manifest.
+	ConfigHash  string          `json:"configHash,omitempty"` // A hash of the loaded config files, before interpolation, see AutoDiscoveryConfig.Hash.
+	Queries     []*QuerySummary `json:"queries,omitempty"`    // One entry per query, in the order queries were loaded.
+	Checksum    string          `json:"checksum"`             // The SHA-256 of the compact JSON encoding of Prompts, as `sha256:<hex>`.
+	Warnings    []string        `json:"warnings,omitempty"`   // Problems found in the manifest, like selectors that match no Prompts.
+	Prompts     []*Prompt       `json:"prompts"`
+}
+
+// A QuerySummary describes the results of a single query.
+type QuerySummary struct {
+	Name     string `json:"name,omitempty"`   // The name of the query, if it has one.
+	Provider string `json:"provider"`         // The provider that ran the query.
+	Source   string `json:"source,omitempty"` // The config file, and line if known, the query was loaded from.
+	Prompts  int    `json:"prompts"`          // The number of Prompts in the manifest produced by the query.
+	Error    string `json:"error,omitempty"`  // The error returned by the provider, if any.
 }
 
 func PromptWithDefaults(p *Prompt) *Prompt {
@@ -68,57 +159,3 @@ func Prompts(ps []*Prompt) []*Prompt {
 	}
 	return ps
 }
-
-// Merges any fields provided here with fields returned by their respective searches.
-// Each Provider is expected to call this function at the right time for their use case.
-func (p *Prompt) DecorateWithQuery(query *PromptQuery) *Prompt {
-	p = PromptWithDefaults(p)
-	if query.Prompt != nil {
-		if query.Prompt.Hostname != "" {
-			p.Hostname = query.Prompt.Hostname
-		}
-		if query.Prompt.IpAddress != "" {
-			p.IpAddress = query.Prompt.IpAddress
-		}
-		if query.Prompt.Port != "" {
-			p.Port = query.Prompt.Port
-		}
-		if query.Prompt.Name != "" {
-			p.Name = query.Prompt.Name
-		}
-		if query.Prompt.Description != "" {
-			p.Description = query.Prompt.Description
-		}
-		if query.Prompt.Username != "" {
-			p.Username = query.Prompt.Username
-		}
-		if query.Prompt.JumpCommand != "" {
-			p.JumpCommand = query.Prompt.JumpCommand
-		}
-		if query.Prompt.ShellCommand != "" {
-			p.ShellCommand = query.Prompt.ShellCommand
-		}
-		if query.Prompt.PreDownloadCommand != "" {
-			p.PreDownloadCommand = query.Prompt.PreDownloadCommand
-		}
-		if query.Prompt.Kind != "" {
-			p.Kind = query.Prompt.Kind
-		}
-		if query.Prompt.Labels != nil {
-			p.Labels = query.Prompt.Labels
-		}
-		if query.Prompt.Principals != nil {
-			p.Principals = query.Prompt.Principals
-		}
-		p.Featured = query.Prompt.Featured
-		p.PromptForKey = query.Prompt.PromptForKey
-		p.PromptForUsername = query.Prompt.PromptForUsername
-		if query.Prompt.CloseTerminalOnExit != nil {
-			p.CloseTerminalOnExit = query.Prompt.CloseTerminalOnExit
-		}
-		if query.Prompt.ProxyJumpSelector != nil {
-			p.ProxyJumpSelector = query.Prompt.ProxyJumpSelector
-		}
-	}
-	return p
-}
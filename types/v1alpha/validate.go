@@ -0,0 +1,173 @@
+package v1alpha
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	yamlQueriesKey = regexp.MustCompile(`^queries:\s*(#.*)?$`)
+	yamlListItem   = regexp.MustCompile(`^(\s*)- `)
+)
+
+// Returns the 1-based line on which each item of the top-level `queries` list starts, or nil if they can't be found.
+// yaml.v2 doesn't expose node positions, so this scans the document for list items at the indentation of the first one.
+func queryLines(data []byte) []int {
+	var lines []int
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	inQueries := false
+	indent := -1
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if !strings.HasPrefix(text, " ") && !strings.HasPrefix(text, "-") {
+			inQueries = yamlQueriesKey.MatchString(text)
+			continue
+		}
+		if !inQueries {
+			continue
+		}
+		match := yamlListItem.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+		if indent == -1 {
+			indent = len(match[1])
+		}
+		if len(match[1]) == indent {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Returns the location of a query for use in error messages, e.g. `queries.yaml:12`.
+func (query *PromptQuery) location() string {
+	if query.line > 0 {
+		return fmt.Sprintf("%s:%d", query.source, query.line)
+	}
+	if query.source != "" {
+		return query.source
+	}
+	return "<config>"
+}
+
+// Returns a list of problems with the query, checked against its provider's schema if it has one.
+func (query *PromptQuery) validate() []string {
+	var problems []string
+	if query.Limit < 0 {
+		problems = append(problems, fmt.Sprintf("limit must not be negative, got %d", query.Limit))
+	}
+	switch query.SortOrder {
+	case "", "asc", "desc":
+	default:
+		problems = append(problems, fmt.Sprintf("sortOrder must be asc or desc, got %q", query.SortOrder))
+	}
+	if len(query.Sort) > 0 && (query.SortBy != "" || query.SortOrder != "") {
+		problems = append(problems, "use either sort or sortBy and sortOrder, not both")
+	}
+	for _, key := range query.Sort {
+		if err := key.validate(); err != nil {
+			problems = append(problems, "sort: "+err.Error())
+		}
+	}
+	for _, key := range query.GroupBy {
+		if err := validateFieldKey(key); err != nil {
+			problems = append(problems, "groupBy: "+err.Error())
+		}
+	}
+	if len(query.GroupBy) > 0 && query.Limit == 0 {
+		problems = append(problems, "groupBy has no effect without a limit")
+	}
+	if query.Prompt != nil {
+		if err := validateUnset(query.Prompt.Unset); err != nil {
+			problems = append(problems, err.Error())
+		}
+		for _, r := range query.Prompt.ProxyJumpMatchExpressions {
+			if err := r.validate(); err != nil {
+				problems = append(problems, "proxyJumpMatchExpressions: "+err.Error())
+			}
+		}
+	}
+	for _, problem := range query.Selector.validate() {
+		problems = append(problems, "selector: "+problem)
+	}
+	problems = append(problems, query.ResourceConfig.validate()...)
+	variantNames := make(map[string]bool)
+	for _, variant := range query.Variants {
+		problems = append(problems, variant.validate()...)
+		if variant.Name != "" && variantNames[variant.Name] {
+			problems = append(problems, fmt.Sprintf("duplicate variant name %q", variant.Name))
+		}
+		variantNames[variant.Name] = true
+	}
+	if query.Where != "" {
+		if _, err := ParseExpression(query.Where); err != nil {
+			problems = append(problems, "where: "+err.Error())
+		}
+	}
+
+	schema := describeProvider(query.Provider)
+	if schema == nil {
+		return problems
+	}
+	problems = append(problems, validateSchemaKeys(query.Provider, "filter", query.Filters, schema.Filters)...)
+	problems = append(problems, validateSchemaKeys(query.Provider, "option", query.Options, schema.Options)...)
+	if query.SortBy != "" && findSchemaKey(schema.SortKeys, query.SortBy) == nil {
+		if err := validateFieldKey(query.SortBy); err != nil {
+			if len(schema.SortKeys) == 0 {
+				problems = append(problems, fmt.Sprintf("sortBy: %s", err))
+			} else {
+				problems = append(problems, fmt.Sprintf("sortBy: %s, and provider %s only supports sort keys %s", err, query.Provider, schemaKeyNames(schema.SortKeys)))
+			}
+		}
+	}
+	return problems
+}
+
+// Returns a problem for each key in values, a query's filters or options, that isn't in schemaKeys or has a value the
+// schema doesn't allow. Problems are sorted by key, so they are reported in the same order every time.
+func validateSchemaKeys(provider, kind string, values map[string]string, schemaKeys []SchemaKey) []string {
+	var problems []string
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := values[key]
+		schemaKey := findSchemaKey(schemaKeys, key)
+		if schemaKey == nil {
+			problems = append(problems, fmt.Sprintf("provider %s does not support %s %q", provider, kind, key))
+			continue
+		}
+		if len(schemaKey.Values) > 0 && !containsString(schemaKey.Values, value) {
+			problems = append(problems, fmt.Sprintf("%s %s must be one of %s, got %q", kind, key, strings.Join(schemaKey.Values, ", "), value))
+		}
+	}
+	return problems
+}
+
+func schemaKeyNames(keys []SchemaKey) string {
+	var names []string
+	for _, key := range keys {
+		names = append(names, key.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
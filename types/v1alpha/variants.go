@@ -0,0 +1,108 @@
+package v1alpha
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// A PromptVariant turns each Prompt discovered by a query into several, like a shell, a console and a log tail for
+// the same container, without querying the Provider more than once.
+type PromptVariant struct {
+	Name       string  `json:"name" yaml:"name"`                                 // Identifies the variant. Must be unique within the query, and is part of the id of each Prompt it produces.
+	NameSuffix string  `json:"nameSuffix,omitempty" yaml:"nameSuffix,omitempty"` // Optional: appended to the name of each Prompt, e.g. ` (console)`.
+	Prompt     *Prompt `json:"prompt,omitempty" yaml:"prompt,omitempty"`         // Optional: a Prompt template merged with each Prompt, after the query's template. See DecorateWithQuery.
+}
+
+func (variant *PromptVariant) validate() []string {
+	var problems []string
+	if variant.Name == "" {
+		problems = append(problems, "variant is missing a name")
+	}
+	if variant.Prompt != nil {
+		if err := validateUnset(variant.Prompt.Unset); err != nil {
+			problems = append(problems, fmt.Sprintf("variant %s: %s", variant.Name, err))
+		}
+		for _, r := range variant.Prompt.ProxyJumpMatchExpressions {
+			if err := r.validate(); err != nil {
+				problems = append(problems, fmt.Sprintf("variant %s: proxyJumpMatchExpressions: %s", variant.Name, err))
+			}
+		}
+	}
+	return problems
+}
+
+// Returns one Prompt per variant of the query for each Prompt in prompts, keeping the variants of each Prompt
+// together, in the order they are declared. Returns prompts unchanged if the query has no variants.
+func (query *PromptQuery) expandVariants(prompts []*Prompt) []*Prompt {
+	if len(query.Variants) == 0 {
+		return prompts
+	}
+	expanded := make([]*Prompt, 0, len(prompts)*len(query.Variants))
+	for _, p := range prompts {
+		for _, variant := range query.Variants {
+			expanded = append(expanded, variant.apply(p))
+		}
+	}
+	return expanded
+}
+
+// Returns a copy of p with the variant applied.
+func (variant *PromptVariant) apply(p *Prompt) *Prompt {
+	v := clonePrompt(p)
+	if variant.Prompt != nil {
+		mergePrompt(v, variant.Prompt)
+		unsetPromptFields(v, variant.Prompt.Unset)
+	}
+	v.Name += variant.NameSuffix
+	if p.ID != "" {
+		v.ID = variantID(p.ID, variant.Name)
+	}
+	return v
+}
+
+// Returns the id of a variant of the Prompt with the given id. Keeps the provider prefix, see PromptID.
+func variantID(id, variant string) string {
+	provider := id
+	if i := strings.LastIndex(id, "-"); i != -1 {
+		provider = id[:i]
+	}
+	sum := sha256.Sum256([]byte(id + "\x00variant:" + variant))
+	return provider + "-" + hex.EncodeToString(sum[:])[:16]
+}
+
+// Returns a deep copy of p.
+func clonePrompt(p *Prompt) *Prompt {
+	clone := *p
+	v := reflect.ValueOf(&clone).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.Ptr:
+			if !field.IsNil() {
+				copied := reflect.New(field.Type().Elem())
+				copied.Elem().Set(field.Elem())
+				field.Set(copied)
+			}
+		case reflect.Slice:
+			if !field.IsNil() {
+				field.Set(reflect.AppendSlice(reflect.MakeSlice(field.Type(), 0, field.Len()), field))
+			}
+		case reflect.Map:
+			if !field.IsNil() {
+				copied := reflect.MakeMap(field.Type())
+				iter := field.MapRange()
+				for iter.Next() {
+					copied.SetMapIndex(iter.Key(), iter.Value())
+				}
+				field.Set(copied)
+			}
+		}
+	}
+	return &clone
+}
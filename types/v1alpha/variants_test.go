@@ -0,0 +1,100 @@
+package v1alpha_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cased/jump/providers"
+	jump "github.com/cased/jump/types/v1alpha"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestQueryVariants(t *testing.T) {
+	providers.Register()
+	config, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/variants/config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := config.DiscoverManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeTerminal := false
+	want := jump.Prompts([]*jump.Prompt{
+		{
+			Name:     "app",
+			Hostname: "app.example.com",
+			Provider: "static",
+			Labels:   map[string]string{"environment": "prod"},
+		},
+		{
+			Name:         "app (console)",
+			Hostname:     "app.example.com",
+			Provider:     "static",
+			Description:  "Rails console",
+			ShellCommand: "./bin/rails console",
+			Labels:       map[string]string{"environment": "prod", "variant": "console"},
+		},
+		{
+			Name:                "app (logs)",
+			Hostname:            "app.example.com",
+			Provider:            "static",
+			ShellCommand:        "tail -f log/production.log",
+			Labels:              map[string]string{},
+			CloseTerminalOnExit: &closeTerminal,
+		},
+	})
+	ids := make(map[string]bool)
+	for _, p := range manifest.Prompts {
+		if !strings.HasPrefix(p.ID, "static-") || ids[p.ID] {
+			t.Errorf("expected a unique static id, got %q", p.ID)
+		}
+		ids[p.ID] = true
+		p.ID = ""
+	}
+	if diff := pretty.Compare(manifest.Prompts, want); diff != "" {
+		t.Errorf("unexpected prompts:\n%s", diff)
+	}
+	if manifest.Queries[0].Prompts != 3 {
+		t.Errorf("expected the query summary to count 3 prompts, got %d", manifest.Queries[0].Prompts)
+	}
+}
+
+func TestQueryVariantsAreLimitedByResource(t *testing.T) {
+	provider := &fixedProvider{
+		prompts: []*jump.Prompt{
+			{ID: "fixed-1", Name: "a"},
+			{ID: "fixed-2", Name: "b"},
+		},
+	}
+	jump.RegisterProvider("fixed", provider, nil)
+	config := &jump.AutoDiscoveryConfig{Queries: []*jump.PromptQuery{{
+		Provider: "fixed",
+		Limit:    1,
+		Variants: []*jump.PromptVariant{{Name: "shell"}, {Name: "console", NameSuffix: " console"}},
+	}}}
+	prompts, err := config.DiscoverPrompts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(promptNames(prompts), ","); got != "a,a console" {
+		t.Errorf("got %s, want a,a console", got)
+	}
+}
+
+func TestQueryVariantsInvalid(t *testing.T) {
+	providers.Register()
+	_, err := jump.LoadAutoDiscoveryConfigFromPaths([]string{"testdata/variants/invalid.yaml"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		"invalid.yaml:2: variant is missing a name",
+		`invalid.yaml:2: variant logs: unset: unknown prompt field "logs"`,
+		`invalid.yaml:2: duplicate variant name "logs"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got:\n%s", want, err)
+		}
+	}
+}